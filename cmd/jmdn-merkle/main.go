@@ -0,0 +1,456 @@
+// Command jmdn-merkle builds, inspects, verifies, converts and diffs Merkle tree
+// snapshots from the command line.
+//
+//	jmdn-merkle build   [-in FILE] [-input hex|binary] [-start H] [-block-merge N] [-domain D] [-out FILE] [-json]
+//	jmdn-merkle root    SNAPSHOT
+//	jmdn-merkle inspect [-format text|tree|json|dot|mermaid] [-depth N] [-diff OTHER] SNAPSHOT
+//	jmdn-merkle diff    [-traversal root|peaks] [-merge] [-concurrency N] [-json] LOCAL REMOTE
+//	jmdn-merkle bisect  [-traversal root|peaks] LOCAL REMOTE
+//	jmdn-merkle report  [-out FILE] [-title T] [-depth N] LOCAL REMOTE
+//	jmdn-merkle verify  SNAPSHOT
+//	jmdn-merkle convert [-to json|binary] IN OUT
+//
+// Snapshots may be binary (Builder.Snapshot) or JSON (MerkleTreeSnapshot); the format
+// is detected from the content. "-" reads stdin or writes stdout. Trees are assumed to
+// use the default hash function.
+//
+// Exit status is 0 on success, 1 when diff or bisect find differences or verify
+// rejects a snapshot, and 2 on any other error.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+const (
+	exitOK      = 0
+	exitDiffers = 1
+	exitTrouble = 2
+)
+
+type env struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+type command struct {
+	usage string
+	run   func(e *env, args []string) (int, error)
+}
+
+var commands = map[string]command{
+	"build":   {"build block hashes into a snapshot", runBuild},
+	"root":    {"print the root of a snapshot", runRoot},
+	"inspect": {"show the state and statistics of a snapshot", runInspect},
+	"diff":    {"list the ranges that differ between two snapshots", runDiff},
+	"bisect":  {"find the first range that differs between two snapshots", runBisect},
+	"report":  {"write an HTML report of the differences between two snapshots", runReport},
+	"verify":  {"check that a snapshot is internally consistent", runVerify},
+	"convert": {"convert a snapshot between the binary and JSON formats", runConvert},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}))
+}
+
+func run(args []string, e *env) int {
+	if len(args) == 0 {
+		usage(e.stderr)
+		return exitTrouble
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(e.stderr, "jmdn-merkle: unknown command %q\n", args[0])
+		usage(e.stderr)
+		return exitTrouble
+	}
+	code, err := cmd.run(e, args[1:])
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(e.stderr, "jmdn-merkle %s: %v\n", args[0], err)
+		}
+		return exitTrouble
+	}
+	return code
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: jmdn-merkle <command> [flags] [args]")
+	fmt.Fprintln(w)
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].usage)
+	}
+}
+
+// parse parses flags and checks the number of positional arguments.
+func parse(fs *flag.FlagSet, args []string, nargs int, argsUsage string) error {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: jmdn-merkle %s [flags] %s\n", fs.Name(), argsUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return fmt.Errorf("expected %d argument(s), got %d", nargs, fs.NArg())
+	}
+	return nil
+}
+
+func newFlagSet(e *env, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	return fs
+}
+
+func runBuild(e *env, args []string) (int, error) {
+	fs := newFlagSet(e, "build")
+	in := fs.String("in", "-", "file with block hashes (- for stdin)")
+	input := fs.String("input", "hex", "input format: hex (one hash per line) or binary (32-byte hashes)")
+	start := fs.Uint64("start", 0, "height of the first block")
+	blockMerge := fs.Int("block-merge", 0, "blocks per chunk (default derived from -expected-total)")
+	expected := fs.Uint64("expected-total", 0, "expected number of blocks (default: the number read)")
+	retain := fs.Bool("retain", false, "retain per-block element hashes (JSON snapshots only)")
+	domain := fs.String("domain", "", "chain ID or namespace mixed into every digest")
+	out := fs.String("out", "-", "snapshot file to write (- for stdout)")
+	asJSON := fs.Bool("json", false, "write a JSON snapshot instead of a binary one")
+	if err := parse(fs, args, 0, ""); err != nil {
+		return 0, err
+	}
+
+	data, err := readInput(*in, e.stdin)
+	if err != nil {
+		return 0, err
+	}
+	hashes, err := readHashes(data, *input)
+	if err != nil {
+		return 0, err
+	}
+	if *expected == 0 {
+		*expected = uint64(len(hashes))
+	}
+
+	b, err := merkletree.NewBuilder(merkletree.Config{
+		BlockMerge:     *blockMerge,
+		ExpectedTotal:  *expected,
+		StartHeight:    start,
+		RetainElements: *retain,
+		Domain:         []byte(*domain),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := b.Push(*start, hashes); err != nil {
+		return 0, err
+	}
+	return exitOK, writeSnapshot(*out, e.stdout, b, *asJSON)
+}
+
+func runRoot(e *env, args []string) (int, error) {
+	fs := newFlagSet(e, "root")
+	if err := parse(fs, args, 1, "SNAPSHOT"); err != nil {
+		return 0, err
+	}
+	f, err := readSnapshot(fs.Arg(0), e.stdin)
+	if err != nil {
+		return 0, err
+	}
+
+	var root merkletree.Hash32
+	if f.binary != nil {
+		r, err := merkletree.NewSnapshotReader(f.binary, nil)
+		if err != nil {
+			return 0, err
+		}
+		if root, err = r.Root(); err != nil {
+			return 0, err
+		}
+	} else {
+		b, err := f.builder()
+		if err != nil {
+			return 0, err
+		}
+		if root, err = b.Finalize(); err != nil {
+			return 0, err
+		}
+	}
+	fmt.Fprintf(e.stdout, "%x\n", root)
+	return exitOK, nil
+}
+
+func runInspect(e *env, args []string) (int, error) {
+	fs := newFlagSet(e, "inspect")
+	var format merkletree.RenderFormat
+	fs.TextVar(&format, "format", merkletree.RenderText, "output: text, tree, json, dot or mermaid")
+	depth := fs.Int("depth", 0, "levels drawn below each peak (0: down to the chunk leaves)")
+	against := fs.String("diff", "", "snapshot to diff against; differing nodes are highlighted")
+	if err := parse(fs, args, 1, "SNAPSHOT"); err != nil {
+		return 0, err
+	}
+	f, err := readSnapshot(fs.Arg(0), e.stdin)
+	if err != nil {
+		return 0, err
+	}
+	b, err := f.builder()
+	if err != nil {
+		return 0, err
+	}
+
+	opts := merkletree.RenderOptions{MaxDepth: *depth}
+	if *against != "" {
+		res, err := diffSnapshots(e, merkletree.Differ{}, fs.Arg(0), *against)
+		if err != nil {
+			return 0, err
+		}
+		opts.Highlight = res.Ranges
+	}
+	if err := b.Render(e.stdout, format, opts); err != nil {
+		return 0, err
+	}
+	if format != merkletree.RenderText {
+		return exitOK, nil
+	}
+
+	st := b.Stats()
+	levels := make([]int, len(st.Peaks))
+	for i, p := range st.Peaks {
+		levels[i] = p.Level
+	}
+	root, err := b.Fork().Finalize()
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(e.stdout, "Format                 : %s\n", f.format())
+	fmt.Fprintf(e.stdout, "Block Merge            : %d\n", st.BlockMerge)
+	fmt.Fprintf(e.stdout, "Total Blocks           : %d\n", st.TotalBlocks)
+	fmt.Fprintf(e.stdout, "Committed Chunks       : %d\n", st.CommittedChunks)
+	fmt.Fprintf(e.stdout, "Partial Chunk Fill     : %d / %d\n", st.PartialChunkFill, st.BlockMerge)
+	fmt.Fprintf(e.stdout, "Peak Levels            : %v\n", levels)
+	fmt.Fprintf(e.stdout, "Nodes                  : %d\n", st.Nodes)
+	fmt.Fprintf(e.stdout, "Memory (approx.)       : %d bytes\n", st.MemoryBytes)
+	fmt.Fprintf(e.stdout, "Snapshot Size          : %d bytes binary, %d bytes JSON\n", st.BinarySnapshotBytes, st.JSONSnapshotBytes)
+	fmt.Fprintf(e.stdout, "Root                   : %x\n", root)
+	return exitOK, nil
+}
+
+// diffFlags are the flags shared by diff and bisect.
+type diffFlags struct {
+	traversal *string
+	json      *bool
+}
+
+func addDiffFlags(fs *flag.FlagSet, traversal string) diffFlags {
+	return diffFlags{
+		traversal: fs.String("traversal", traversal, "start from the finalized root or from the peaks: root or peaks"),
+		json:      fs.Bool("json", false, "print the result as JSON"),
+	}
+}
+
+func (f diffFlags) differ() (merkletree.Differ, error) {
+	var d merkletree.Differ
+	switch *f.traversal {
+	case "root":
+		d.Traversal = merkletree.TraverseRoot
+	case "peaks":
+		d.Traversal = merkletree.TraversePeaks
+	default:
+		return d, fmt.Errorf("unknown traversal %q (want root or peaks)", *f.traversal)
+	}
+	return d, nil
+}
+
+// diffSnapshots compares the local snapshot, restored in full, against the remote
+// one, which is read lazily.
+func diffSnapshots(e *env, d merkletree.Differ, localPath, remotePath string) (merkletree.DiffResult, error) {
+	lf, err := readSnapshot(localPath, e.stdin)
+	if err != nil {
+		return merkletree.DiffResult{}, err
+	}
+	local, err := lf.builder()
+	if err != nil {
+		return merkletree.DiffResult{}, err
+	}
+	rf, err := readSnapshot(remotePath, e.stdin)
+	if err != nil {
+		return merkletree.DiffResult{}, err
+	}
+
+	ctx := context.Background()
+	if rf.json != nil {
+		return d.DiffSnapshot(ctx, local, rf.json)
+	}
+	r, err := merkletree.NewSnapshotReader(rf.binary, nil)
+	if err != nil {
+		return merkletree.DiffResult{}, fmt.Errorf("%s: %w", remotePath, err)
+	}
+	return d.DiffReader(ctx, local, r)
+}
+
+func printResult(e *env, res merkletree.DiffResult, asJSON bool) (int, error) {
+	if asJSON {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			return 0, err
+		}
+	} else {
+		for _, r := range res.Ranges {
+			fmt.Fprintf(e.stdout, "[%d … %d]\t%d blocks\t%s\n", r.Start, r.Start+uint64(r.Count)-1, r.Count, r.Kind)
+		}
+		if res.Truncated {
+			fmt.Fprintf(e.stdout, "truncated: %s\n", res.TruncatedBy)
+		}
+	}
+	if len(res.Ranges) > 0 || res.Truncated {
+		return exitDiffers, nil
+	}
+	return exitOK, nil
+}
+
+func runDiff(e *env, args []string) (int, error) {
+	fs := newFlagSet(e, "diff")
+	df := addDiffFlags(fs, "root")
+	merge := fs.Bool("merge", false, "merge adjacent ranges of the same kind")
+	concurrency := fs.Int("concurrency", 1, "number of workers")
+	maxRanges := fs.Int("max-ranges", 0, "stop after this many ranges (0: no limit)")
+	maxNodes := fs.Uint64("max-nodes", 0, "stop after visiting this many nodes (0: no limit)")
+	if err := parse(fs, args, 2, "LOCAL REMOTE"); err != nil {
+		return 0, err
+	}
+	d, err := df.differ()
+	if err != nil {
+		return 0, err
+	}
+	d.Merge = *merge
+	d.Concurrency = *concurrency
+	d.Options = merkletree.DiffOptions{MaxRanges: *maxRanges, MaxNodesVisited: *maxNodes}
+
+	res, err := diffSnapshots(e, d, fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return 0, err
+	}
+	return printResult(e, res, *df.json)
+}
+
+func runBisect(e *env, args []string) (int, error) {
+	fs := newFlagSet(e, "bisect")
+	df := addDiffFlags(fs, "peaks")
+	if err := parse(fs, args, 2, "LOCAL REMOTE"); err != nil {
+		return 0, err
+	}
+	d, err := df.differ()
+	if err != nil {
+		return 0, err
+	}
+	d.Strategy = merkletree.DiffFirst
+
+	res, err := diffSnapshots(e, d, fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return 0, err
+	}
+	return printResult(e, res, *df.json)
+}
+
+func runReport(e *env, args []string) (int, error) {
+	fs := newFlagSet(e, "report")
+	out := fs.String("out", "-", "HTML file to write (- for stdout)")
+	title := fs.String("title", "", "page title")
+	depth := fs.Int("depth", 0, "levels drawn below each peak (0: down to the chunk leaves)")
+	if err := parse(fs, args, 2, "LOCAL REMOTE"); err != nil {
+		return 0, err
+	}
+	var sides [2]*merkletree.Builder
+	for i := range sides {
+		f, err := readSnapshot(fs.Arg(i), e.stdin)
+		if err != nil {
+			return 0, err
+		}
+		if sides[i], err = f.builder(); err != nil {
+			return 0, err
+		}
+	}
+
+	var buf bytes.Buffer
+	opts := merkletree.ReportOptions{
+		Title:      *title,
+		LocalName:  fs.Arg(0),
+		RemoteName: fs.Arg(1),
+		MaxDepth:   *depth,
+	}
+	if err := merkletree.WriteDiffReport(context.Background(), &buf, sides[0], sides[1], opts); err != nil {
+		return 0, err
+	}
+	if *out == "-" {
+		_, err := e.stdout.Write(buf.Bytes())
+		return exitOK, err
+	}
+	return exitOK, os.WriteFile(*out, buf.Bytes(), 0644)
+}
+
+func runVerify(e *env, args []string) (int, error) {
+	fs := newFlagSet(e, "verify")
+	if err := parse(fs, args, 1, "SNAPSHOT"); err != nil {
+		return 0, err
+	}
+	f, err := readSnapshot(fs.Arg(0), e.stdin)
+	if err != nil {
+		return 0, err
+	}
+	b, err := f.builder()
+	if err == nil {
+		err = b.Verify()
+	}
+	if err != nil {
+		fmt.Fprintf(e.stdout, "INVALID: %v\n", err)
+		return exitDiffers, nil
+	}
+	root, err := b.Fork().Finalize()
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(e.stdout, "OK: %d blocks, root %x\n", b.State().TotalBlocks, root)
+	return exitOK, nil
+}
+
+func runConvert(e *env, args []string) (int, error) {
+	fs := newFlagSet(e, "convert")
+	to := fs.String("to", "", "output format: json or binary (default: the other one)")
+	if err := parse(fs, args, 2, "IN OUT"); err != nil {
+		return 0, err
+	}
+	f, err := readSnapshot(fs.Arg(0), e.stdin)
+	if err != nil {
+		return 0, err
+	}
+	if *to == "" {
+		*to = "json"
+		if f.json != nil {
+			*to = "binary"
+		}
+	}
+	if *to != "json" && *to != "binary" {
+		return 0, fmt.Errorf("unknown format %q (want json or binary)", *to)
+	}
+
+	b, err := f.builder()
+	if err != nil {
+		return 0, err
+	}
+	return exitOK, writeSnapshot(fs.Arg(1), e.stdout, b, *to == "json")
+}
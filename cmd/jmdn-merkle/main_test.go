@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// runCLI runs the tool with stdin and returns its exit code and stdout.
+func runCLI(t *testing.T, stdin string, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &env{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr})
+	if code == exitTrouble {
+		t.Logf("jmdn-merkle %v: %s", args, stderr.String())
+	}
+	return code, stdout.String()
+}
+
+func hexHashes(n int, mutate int) (string, []merkletree.Hash32) {
+	var sb strings.Builder
+	hashes := make([]merkletree.Hash32, n)
+	for i := range hashes {
+		hashes[i][0], hashes[i][1] = byte(i), byte(i>>8)
+		if i == mutate {
+			hashes[i][31] = 0xFF
+		}
+		fmt.Fprintf(&sb, "%s\n", hex.EncodeToString(hashes[i][:]))
+	}
+	return sb.String(), hashes
+}
+
+func TestBuildRootConvertVerify(t *testing.T) {
+	dir := t.TempDir()
+	input, hashes := hexHashes(1234, -1)
+	bin := filepath.Join(dir, "tree.bin")
+	js := filepath.Join(dir, "tree.json")
+
+	if code, _ := runCLI(t, "# header comment\n"+input, "build", "-start", "100", "-block-merge", "10", "-out", bin); code != exitOK {
+		t.Fatalf("build exit %d", code)
+	}
+
+	start := uint64(100)
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, StartHeight: &start})
+	b.Push(100, hashes)
+	want, _ := b.Finalize()
+
+	_, out := runCLI(t, "", "root", bin)
+	if strings.TrimSpace(out) != hex.EncodeToString(want[:]) {
+		t.Errorf("root = %s, want %x", out, want)
+	}
+
+	if code, _ := runCLI(t, "", "convert", bin, js); code != exitOK {
+		t.Fatalf("convert exit %d", code)
+	}
+	_, out = runCLI(t, "", "root", js)
+	if strings.TrimSpace(out) != hex.EncodeToString(want[:]) {
+		t.Errorf("root of converted snapshot = %s, want %x", out, want)
+	}
+
+	if code, out := runCLI(t, "", "verify", js); code != exitOK || !strings.HasPrefix(out, "OK: 1234 blocks") {
+		t.Errorf("verify = %d %q", code, out)
+	}
+	if code, out := runCLI(t, "", "inspect", bin); code != exitOK || !strings.Contains(out, "Partial Chunk Fill     : 4 / 10") {
+		t.Errorf("inspect = %d %q", code, out)
+	}
+}
+
+func TestBuildWithDomain(t *testing.T) {
+	dir := t.TempDir()
+	input, hashes := hexHashes(300, -1)
+	bin := filepath.Join(dir, "tree.bin")
+	if code, _ := runCLI(t, input, "build", "-block-merge", "10", "-domain", "testnet", "-out", bin); code != exitOK {
+		t.Fatalf("build exit %d", code)
+	}
+
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, Domain: []byte("testnet")})
+	b.Push(0, hashes)
+	want, _ := b.Finalize()
+	if _, out := runCLI(t, "", "root", bin); strings.TrimSpace(out) != hex.EncodeToString(want[:]) {
+		t.Errorf("root = %s, want %x", out, want)
+	}
+	if code, out := runCLI(t, "", "verify", bin); code != exitOK {
+		t.Errorf("verify = %d %q", code, out)
+	}
+}
+
+func TestGapSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	_, hashes := hexHashes(100, -1)
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, AllowGaps: true})
+	b.Push(0, hashes[:35])
+	b.Push(60, hashes[60:])
+	want, _ := b.Fork().Finalize()
+	data, err := b.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, js := filepath.Join(dir, "gaps.bin"), filepath.Join(dir, "gaps.json")
+	os.WriteFile(bin, data, 0644)
+
+	if code, out := runCLI(t, "", "verify", bin); code != exitOK {
+		t.Errorf("verify = %d %q", code, out)
+	}
+	if code, _ := runCLI(t, "", "inspect", bin); code != exitOK {
+		t.Errorf("inspect exit %d", code)
+	}
+	if code, _ := runCLI(t, "", "convert", bin, js); code != exitOK {
+		t.Fatalf("convert exit %d", code)
+	}
+	if code, _ := runCLI(t, "", "convert", js, bin); code != exitOK {
+		t.Fatalf("convert back exit %d", code)
+	}
+	if round, _ := os.ReadFile(bin); !bytes.Equal(round, data) {
+		t.Error("binary snapshot changed across a JSON round trip")
+	}
+	if _, out := runCLI(t, "", "root", bin); strings.TrimSpace(out) != hex.EncodeToString(want[:]) {
+		t.Errorf("root = %s, want %x", out, want)
+	}
+	if code, out := runCLI(t, "", "diff", bin, js); code != exitOK || out != "" {
+		t.Errorf("diff = %d %q", code, out)
+	}
+}
+
+func TestVerifyRejectsTamperedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	input, _ := hexHashes(640, -1)
+	js := filepath.Join(dir, "tree.json")
+	if code, _ := runCLI(t, input, "build", "-block-merge", "10", "-json", "-out", js); code != exitOK {
+		t.Fatalf("build exit %d", code)
+	}
+
+	data, _ := os.ReadFile(js)
+	var s merkletree.MerkleTreeSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	s.Peaks[6].Left.Right.Root[0] ^= 0xFF
+	data, _ = json.Marshal(&s)
+	os.WriteFile(js, data, 0644)
+
+	if code, out := runCLI(t, "", "verify", js); code != exitDiffers || !strings.Contains(out, "INVALID") {
+		t.Errorf("verify = %d %q, want a rejection", code, out)
+	}
+}
+
+func TestDiffAndBisect(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.bin"), filepath.Join(dir, "b.json")
+	inA, _ := hexHashes(1000, -1)
+	inB, _ := hexHashes(1000, 512)
+	runCLI(t, inA, "build", "-block-merge", "10", "-out", a)
+	runCLI(t, inB, "build", "-block-merge", "10", "-json", "-out", b)
+
+	code, out := runCLI(t, "", "diff", a, b)
+	if code != exitDiffers || !strings.Contains(out, "[510 … 519]") {
+		t.Errorf("diff = %d %q", code, out)
+	}
+	code, out = runCLI(t, "", "bisect", "-json", b, a)
+	var res merkletree.DiffResult
+	if err := json.Unmarshal([]byte(out), &res); err != nil || code != exitDiffers {
+		t.Fatalf("bisect = %d %q (%v)", code, out, err)
+	}
+	if len(res.Ranges) != 1 || res.Ranges[0].Start != 510 {
+		t.Errorf("bisect ranges = %v", res.Ranges)
+	}
+
+	if code, out := runCLI(t, "", "diff", "-traversal", "peaks", "-concurrency", "4", a, a); code != exitOK || out != "" {
+		t.Errorf("diff of identical snapshots = %d %q", code, out)
+	}
+
+	code, out = runCLI(t, "", "inspect", "-format", "dot", "-diff", b, a)
+	if code != exitOK || !strings.HasPrefix(out, "digraph") || !strings.Contains(out, `chunk [510 … 519]\n10 blocks\n`) || !strings.Contains(out, "fillcolor") {
+		t.Errorf("inspect -format dot -diff = %d %q", code, out)
+	}
+
+	html := filepath.Join(dir, "report.html")
+	if code, _ := runCLI(t, "", "report", "-out", html, a, b); code != exitOK {
+		t.Fatalf("report exit %d", code)
+	}
+	if page, _ := os.ReadFile(html); !strings.Contains(string(page), "1 differing range(s)") {
+		t.Errorf("report:\n%s", page)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"frobnicate"},
+		{"diff", "only-one"},
+		{"build", "-input", "base64"},
+		{"root", filepath.Join(t.TempDir(), "missing")},
+	} {
+		if code, _ := runCLI(t, "", args...); code != exitTrouble {
+			t.Errorf("%v: exit %d, want %d", args, code, exitTrouble)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// snapshotFile is a snapshot loaded from disk, in whichever format it was stored.
+type snapshotFile struct {
+	path   string
+	binary []byte                         // set for binary snapshots
+	json   *merkletree.MerkleTreeSnapshot // set for JSON snapshots
+}
+
+// readSnapshot loads a binary or JSON snapshot, telling them apart by content.
+func readSnapshot(path string, stdin io.Reader) (*snapshotFile, error) {
+	data, err := readInput(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+	f := &snapshotFile{path: path}
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		f.json = new(merkletree.MerkleTreeSnapshot)
+		if err := json.Unmarshal(trimmed, f.json); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return f, nil
+	}
+	f.binary = data
+	return f, nil
+}
+
+func (f *snapshotFile) format() string {
+	if f.json != nil {
+		return "json"
+	}
+	return "binary"
+}
+
+// builder restores the full Builder held by the snapshot.
+func (f *snapshotFile) builder() (*merkletree.Builder, error) {
+	if f.json != nil {
+		b, err := f.json.FromSnapshot(nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.path, err)
+		}
+		return b, nil
+	}
+
+	r, err := merkletree.NewSnapshotReader(f.binary, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.path, err)
+	}
+	b, err := merkletree.NewBuilder(merkletree.Config{BlockMerge: r.BlockMerge(), Domain: r.Domain(), AllowGaps: r.AllowGaps()})
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Restore(f.binary); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.path, err)
+	}
+	return b, nil
+}
+
+// writeSnapshot writes b as a binary or JSON snapshot.
+func writeSnapshot(path string, stdout io.Writer, b *merkletree.Builder, asJSON bool) error {
+	var data []byte
+	var err error
+	if asJSON {
+		data, err = json.MarshalIndent(b.ToSnapshot(), "", "  ")
+	} else {
+		data, err = b.Snapshot()
+	}
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		_, err = stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func readInput(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// readHashes parses block hashes: one hex hash per line (optional 0x prefix, blank
+// lines and # comments ignored), or raw concatenated 32-byte hashes.
+func readHashes(data []byte, format string) ([]merkletree.Hash32, error) {
+	var out []merkletree.Hash32
+	switch format {
+	case "binary":
+		if len(data)%32 != 0 {
+			return nil, fmt.Errorf("binary input is %d bytes, not a multiple of 32", len(data))
+		}
+		out = make([]merkletree.Hash32, len(data)/32)
+		for i := range out {
+			copy(out[i][:], data[i*32:])
+		}
+		return out, nil
+
+	case "hex":
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; sc.Scan(); line++ {
+			s := strings.TrimSpace(sc.Text())
+			if s == "" || strings.HasPrefix(s, "#") {
+				continue
+			}
+			raw, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+			if err == nil && len(raw) != 32 {
+				err = fmt.Errorf("invalid hash length: %d bytes", len(raw))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			out = append(out, merkletree.Hash32(raw))
+		}
+		return out, sc.Err()
+	}
+	return nil, fmt.Errorf("unknown input format %q (want hex or binary)", format)
+}
@@ -0,0 +1,213 @@
+package merklehttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// Client talks to a Handler. It implements merkletree.NodeSource, so a local
+// builder can be diffed or bisected against the remote tree node by node.
+type Client struct {
+	BaseURL string       // e.g. "http://peer:8080/merkle", without a trailing slash
+	HTTP    *http.Client // nil means http.DefaultClient
+}
+
+// NewClient returns a client for the handler mounted at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+var _ merkletree.NodeSource = (*Client)(nil)
+
+// StatusError is returned for non-2xx responses.
+type StatusError struct {
+	StatusCode int
+	Message    string // the "error" field of the body, if any
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("merklehttp: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("merklehttp: %s: %s", http.StatusText(e.StatusCode), e.Message)
+}
+
+// Root returns the remote root and total block count.
+func (c *Client) Root(ctx context.Context) (RootResponse, error) {
+	var res RootResponse
+	err := c.getJSON(ctx, "/root", nil, &res)
+	return res, err
+}
+
+// State returns the remote builder's statistics.
+func (c *Client) State(ctx context.Context) (merkletree.Stats, error) {
+	var res merkletree.Stats
+	err := c.getJSON(ctx, "/state", nil, &res)
+	return res, err
+}
+
+// Snapshot returns the remote binary snapshot.
+func (c *Client) Snapshot(ctx context.Context) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/snapshot", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Node returns the remote node covering exactly [start, start+count), with its
+// children if it is internal.
+func (c *Client) Node(ctx context.Context, start uint64, count uint32) (NodeInfo, error) {
+	var res NodeInfo
+	q := url.Values{"start": {strconv.FormatUint(start, 10)}, "count": {strconv.FormatUint(uint64(count), 10)}}
+	err := c.getJSON(ctx, "/node", q, &res)
+	return res, err
+}
+
+// ProveBlock returns the remote proof for the block at height. Check it with
+// BlockProof.Verify against a root obtained independently.
+func (c *Client) ProveBlock(ctx context.Context, height uint64) (*merkletree.BlockProof, error) {
+	var res merkletree.BlockProof
+	if err := c.getJSON(ctx, "/proof/block/"+strconv.FormatUint(height, 10), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DiffSnapshot posts a binary or JSON snapshot and returns the server's diff of
+// its tree (as local) against it. Query parameters are built from d: DiffFirst,
+// MaxRanges and MaxNodesVisited are forwarded; the rest of the configuration is
+// the server's.
+func (c *Client) DiffSnapshot(ctx context.Context, snapshot []byte, d merkletree.Differ) (merkletree.DiffResult, error) {
+	q := url.Values{}
+	if d.Strategy == merkletree.DiffFirst {
+		q.Set("first", "1")
+	}
+	if d.Options.MaxRanges > 0 {
+		q.Set("max_ranges", strconv.Itoa(d.Options.MaxRanges))
+	}
+	if d.Options.MaxNodesVisited > 0 {
+		q.Set("max_nodes", strconv.FormatUint(d.Options.MaxNodesVisited, 10))
+	}
+	var res merkletree.DiffResult
+	resp, err := c.do(ctx, http.MethodPost, "/diff", q, bytes.NewReader(snapshot))
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	return res, err
+}
+
+// Diff compares local against the remote tree, fetching only the nodes on
+// differing paths. Kinds and roots are given from local's point of view; a
+// remote tree of another domain is rejected with merkletree.ErrDomainMismatch.
+func (c *Client) Diff(ctx context.Context, local *merkletree.Builder) (merkletree.DiffResult, error) {
+	return merkletree.Differ{}.DiffSource(ctx, local, c)
+}
+
+// Bisect returns the first range where local and the remote tree differ, or
+// count 0 if they are equal. It fetches one node pair per level.
+func (c *Client) Bisect(ctx context.Context, local *merkletree.Builder) (start uint64, count uint32, err error) {
+	res, err := merkletree.Differ{Strategy: merkletree.DiffFirst}.DiffSource(ctx, local, c)
+	if err != nil || len(res.Ranges) == 0 {
+		return 0, 0, err
+	}
+	return res.Ranges[0].Start, res.Ranges[0].Count, nil
+}
+
+// Domain implements merkletree.NodeSource.
+func (c *Client) Domain(ctx context.Context) ([]byte, error) {
+	res, err := c.Root(ctx)
+	return res.Domain, err
+}
+
+// RootNode implements merkletree.NodeSource.
+func (c *Client) RootNode(ctx context.Context) (*merkletree.Node, error) {
+	var info NodeInfo
+	if err := c.getJSON(ctx, "/node", nil, &info); err != nil {
+		var se *StatusError
+		if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+			return nil, nil // empty tree
+		}
+		return nil, err
+	}
+	return info.node(), nil
+}
+
+// Children implements merkletree.NodeSource.
+func (c *Client) Children(ctx context.Context, n *merkletree.Node) (left, right *merkletree.Node, err error) {
+	info, err := c.Node(ctx, n.Metadata.Start, n.Metadata.Count)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Root != n.Root {
+		return nil, nil, fmt.Errorf("merklehttp: node [%d, +%d) changed while diffing", n.Metadata.Start, n.Metadata.Count)
+	}
+	return info.Left.node(), info.Right.node(), nil
+}
+
+// node converts i to a Node without children.
+func (i *NodeInfo) node() *merkletree.Node {
+	if i == nil {
+		return nil
+	}
+	return &merkletree.Node{
+		Root:     i.Root,
+		Metadata: merkletree.Metadata{Start: i.Start, Count: i.Count},
+		HasData:  i.Leaf,
+		Gap:      i.Gap,
+	}
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, q url.Values, v any) error {
+	resp, err := c.do(ctx, http.MethodGet, path, q, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// do sends a request and turns non-2xx responses into a *StatusError.
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, body io.Reader) (*http.Response, error) {
+	u := c.BaseURL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&e)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: e.Error}
+	}
+	return resp, nil
+}
@@ -0,0 +1,294 @@
+// Package merklehttp serves a merkletree.Builder over HTTP and provides the
+// matching client, which can diff and bisect a local tree against a remote one
+// while fetching only the nodes on differing paths.
+//
+// Endpoints:
+//
+//	GET  /root                    root and total blocks
+//	GET  /state                   merkletree.Stats
+//	GET  /snapshot[?format=json]  binary (default) or JSON snapshot
+//	GET  /node[?start=&count=]    a node and its children (default: the root)
+//	GET  /proof/block/{height}    merkletree.BlockProof
+//	POST /diff[?first=1&max_ranges=&max_nodes=]
+//	                              diff against the snapshot in the body
+//
+// Responses other than binary snapshots are JSON; errors are {"error": "..."}.
+// Hashes are encoded as merkletree encodes them: arrays of 32 bytes, except the
+// hex roots of diff ranges. Roots and nodes describe the tree Finalize would
+// produce, without committing the partial chunk.
+package merklehttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// DefaultMaxSnapshotBytes bounds the body of POST /diff when Options leaves it 0.
+const DefaultMaxSnapshotBytes = 64 << 20
+
+// Options configures a Handler.
+type Options struct {
+	// Lock, if set, is held while the handler reads the builder. Pass the read
+	// side of the lock that guards Push, e.g. mu.RLocker().
+	Lock sync.Locker
+	// HashFactory must match the builder's Config.HashFactory; nil means the
+	// default hash function. Snapshot domains are applied to it.
+	HashFactory merkletree.HashFactory
+	// MaxSnapshotBytes bounds the body of POST /diff (default DefaultMaxSnapshotBytes).
+	MaxSnapshotBytes int64
+	// Diff configures POST /diff; its Strategy and Options are overridden by the
+	// query parameters.
+	Diff merkletree.Differ
+}
+
+// Handler serves a Builder. Create it with NewHandler.
+type Handler struct {
+	b    *merkletree.Builder
+	opts Options
+	mux  *http.ServeMux
+}
+
+// NewHandler returns a handler serving b.
+func NewHandler(b *merkletree.Builder, opts Options) *Handler {
+	if opts.MaxSnapshotBytes <= 0 {
+		opts.MaxSnapshotBytes = DefaultMaxSnapshotBytes
+	}
+	h := &Handler{b: b, opts: opts, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /root", h.serveRoot)
+	h.mux.HandleFunc("GET /state", h.serveState)
+	h.mux.HandleFunc("GET /snapshot", h.serveSnapshot)
+	h.mux.HandleFunc("GET /node", h.serveNode)
+	h.mux.HandleFunc("GET /proof/block/{height}", h.serveProof)
+	h.mux.HandleFunc("POST /diff", h.serveDiff)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// RootResponse is the body of GET /root.
+type RootResponse struct {
+	Root        merkletree.Hash32 `json:"root"`
+	TotalBlocks uint64            `json:"total_blocks"`
+	Domain      []byte            `json:"domain,omitempty"`
+}
+
+// NodeInfo describes a node; GET /node fills in Left and Right (one level deep)
+// for internal nodes.
+type NodeInfo struct {
+	Start uint64            `json:"start"`
+	Count uint32            `json:"count"`
+	Root  merkletree.Hash32 `json:"root"`
+	Leaf  bool              `json:"leaf"`
+	Gap   bool              `json:"gap,omitempty"` // a gap leaf (Config.AllowGaps)
+	Left  *NodeInfo         `json:"left,omitempty"`
+	Right *NodeInfo         `json:"right,omitempty"`
+}
+
+// view returns a fork of the builder, which can be read without holding the lock:
+// forks share only immutable nodes with the original.
+func (h *Handler) view() *merkletree.Builder {
+	if h.opts.Lock != nil {
+		h.opts.Lock.Lock()
+		defer h.opts.Lock.Unlock()
+	}
+	return h.b.Fork()
+}
+
+func (h *Handler) serveRoot(w http.ResponseWriter, r *http.Request) {
+	v := h.view()
+	root, err := v.RootView()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	res := RootResponse{TotalBlocks: v.State().TotalBlocks, Domain: v.Domain()}
+	if root != nil {
+		res.Root = root.Root
+	}
+	writeJSON(w, res)
+}
+
+func (h *Handler) serveState(w http.ResponseWriter, r *http.Request) {
+	// Read the builder itself: forks start with zero hashing counters.
+	if h.opts.Lock != nil {
+		h.opts.Lock.Lock()
+		defer h.opts.Lock.Unlock()
+	}
+	writeJSON(w, h.b.Stats())
+}
+
+func (h *Handler) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	v := h.view()
+	switch r.URL.Query().Get("format") {
+	case "", "binary":
+		data, err := v.Snapshot()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	case "json":
+		writeJSON(w, v.ToSnapshot())
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown snapshot format %q", r.URL.Query().Get("format")))
+	}
+}
+
+func (h *Handler) serveNode(w http.ResponseWriter, r *http.Request) {
+	root, err := h.view().RootView()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if root == nil {
+		writeError(w, http.StatusNotFound, errors.New("empty tree"))
+		return
+	}
+
+	n := root
+	if q := r.URL.Query(); q.Has("start") || q.Has("count") {
+		start, err1 := strconv.ParseUint(q.Get("start"), 10, 64)
+		count, err2 := strconv.ParseUint(q.Get("count"), 10, 32)
+		if err := errors.Join(err1, err2); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if n = findNode(root, start, uint32(count)); n == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no node covers exactly [%d, +%d)", start, count))
+			return
+		}
+	}
+
+	info := nodeInfo(n)
+	if !n.HasData {
+		info.Left, info.Right = nodeInfo(n.Left), nodeInfo(n.Right)
+	}
+	writeJSON(w, info)
+}
+
+// findNode descends from n to the node covering exactly [start, start+count).
+func findNode(n *merkletree.Node, start uint64, count uint32) *merkletree.Node {
+	for n != nil {
+		if n.Metadata.Start == start && n.Metadata.Count == count {
+			return n
+		}
+		if n.HasData || start < n.Metadata.Start || start+uint64(count) > n.Metadata.Start+uint64(n.Metadata.Count) {
+			return nil
+		}
+		if start < n.Right.Metadata.Start {
+			n = n.Left
+		} else {
+			n = n.Right
+		}
+	}
+	return nil
+}
+
+func nodeInfo(n *merkletree.Node) *NodeInfo {
+	if n == nil {
+		return nil
+	}
+	return &NodeInfo{Start: n.Metadata.Start, Count: n.Metadata.Count, Root: n.Root, Leaf: n.HasData, Gap: n.Gap}
+}
+
+func (h *Handler) serveProof(w http.ResponseWriter, r *http.Request) {
+	height, err := strconv.ParseUint(r.PathValue("height"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	p, err := h.view().ProveBlock(height)
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, merkletree.ErrElementsNotRetained) {
+			status = http.StatusUnprocessableEntity
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, p)
+}
+
+func (h *Handler) serveDiff(w http.ResponseWriter, r *http.Request) {
+	d := h.opts.Diff
+	q := r.URL.Query()
+	if first, _ := strconv.ParseBool(q.Get("first")); first {
+		d.Strategy = merkletree.DiffFirst
+	}
+	if s := q.Get("max_ranges"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		d.Options.MaxRanges = n
+	}
+	if s := q.Get("max_nodes"); s != "" {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		d.Options.MaxNodesVisited = n
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.opts.MaxSnapshotBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	res, err := diffSnapshot(r.Context(), d, h.view(), data, h.opts.HashFactory)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, res)
+}
+
+// diffSnapshot diffs local against a binary or JSON snapshot, read lazily.
+func diffSnapshot(ctx context.Context, d merkletree.Differ, local *merkletree.Builder, data []byte, hf merkletree.HashFactory) (merkletree.DiffResult, error) {
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		var s merkletree.MerkleTreeSnapshot
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return merkletree.DiffResult{}, err
+		}
+		return d.DiffSnapshot(ctx, local, &s)
+	}
+	sr, err := merkletree.NewSnapshotReader(data, hf)
+	if err != nil {
+		return merkletree.DiffResult{}, err
+	}
+	return d.DiffReader(ctx, local, sr)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// MetricsHandler serves m in the Prometheus text format
+// (merkletree.Metrics.WritePrometheus), for mounting as a scrape endpoint.
+func MetricsHandler(m *merkletree.Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WritePrometheus(w)
+	})
+}
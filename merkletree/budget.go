@@ -0,0 +1,203 @@
+package merkletree
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+)
+
+// DiffOptions bounds the work done by a diff or bisect. Zero values mean "no limit".
+// Logger, Tracer and Metrics observe the run.
+type DiffOptions struct {
+	// MaxRanges stops the diff once this many ranges have been found and another
+	// one turns up.
+	MaxRanges int
+	// MaxNodesVisited caps the number of node examinations.
+	MaxNodesVisited uint64
+	// MaxBytes caps the node data examined, counted with the binary snapshot
+	// encoding of each node (header, root and, for leaves, the data hash).
+	MaxBytes uint64
+	// StopAtFirst ends the diff after the first differing range. This is a request,
+	// not a budget, so it does not mark the result as truncated.
+	StopAtFirst bool
+
+	// Logger receives debug records for each descent into a subtree, each
+	// reported range and the outcome. Defaults to the local builder's
+	// Config.Logger.
+	Logger *slog.Logger
+	// Tracer traces the run as one span. Defaults to the local builder's
+	// Config.Tracer.
+	Tracer Tracer
+	// Metrics counts the run, its node visits and its ranges. Defaults to the
+	// local builder's Config.Metrics.
+	Metrics *Metrics
+}
+
+// DiffLimit identifies the budget that truncated a diff.
+type DiffLimit uint8
+
+const (
+	LimitNone DiffLimit = iota
+	LimitMaxRanges
+	LimitMaxNodes
+	LimitMaxBytes
+)
+
+var diffLimitNames = [...]string{
+	LimitNone:      "none",
+	LimitMaxRanges: "max_ranges",
+	LimitMaxNodes:  "max_nodes",
+	LimitMaxBytes:  "max_bytes",
+}
+
+func (l DiffLimit) String() string {
+	if int(l) < len(diffLimitNames) {
+		return diffLimitNames[l]
+	}
+	return fmt.Sprintf("DiffLimit(%d)", uint8(l))
+}
+
+func (l DiffLimit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *DiffLimit) UnmarshalText(text []byte) error {
+	for i, name := range diffLimitNames {
+		if name == string(text) {
+			*l = DiffLimit(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown diff limit %q", text)
+}
+
+// DiffResult is the outcome of a diff run with DiffOptions.
+//
+// Truncated reports that a budget was exhausted before the traversal completed:
+// Ranges is then only a prefix of the differences, and the trees should be treated
+// as "too different" (e.g. trigger a full resync instead of a partial repair).
+type DiffResult struct {
+	Ranges       []DiffRange `json:"ranges"`
+	Truncated    bool        `json:"truncated"`
+	TruncatedBy  DiffLimit   `json:"truncated_by"`
+	NodesVisited uint64      `json:"nodes_visited"`
+	BytesRead    uint64      `json:"bytes_read"`
+}
+
+// Encoded node sizes in the binary snapshot format: tag, start, count, root (+ data).
+const (
+	encodedInternalSize = 1 + 8 + 4 + 32
+	encodedLeafSize     = encodedInternalSize + 32
+)
+
+// diffBudget tracks DiffOptions limits. It is safe for concurrent use, and a nil
+// *diffBudget imposes no limits.
+type diffBudget struct {
+	opts   DiffOptions
+	nodes  atomic.Uint64
+	bytes  atomic.Uint64
+	ranges atomic.Int64
+	limit  atomic.Uint32
+}
+
+func newDiffBudget(opts DiffOptions) *diffBudget {
+	return &diffBudget{opts: opts}
+}
+
+// visit accounts for examining n and reports whether the traversal may go on.
+func (d *diffBudget) visit(n *Node) bool {
+	if d == nil {
+		return true
+	}
+	if d.exhausted() {
+		return false
+	}
+	if n == nil {
+		return true
+	}
+	size := uint64(encodedInternalSize)
+	if n.HasData {
+		size = encodedLeafSize
+	}
+	nodes := d.nodes.Add(1)
+	bytes := d.bytes.Add(size)
+	if d.opts.MaxNodesVisited > 0 && nodes > d.opts.MaxNodesVisited {
+		d.hit(LimitMaxNodes)
+		return false
+	}
+	if d.opts.MaxBytes > 0 && bytes > d.opts.MaxBytes {
+		d.hit(LimitMaxBytes)
+		return false
+	}
+	return true
+}
+
+// take reserves room for one more range and reports whether it may be reported.
+// Ranges found before a node or byte limit was hit are still accepted.
+func (d *diffBudget) take() bool {
+	if d == nil {
+		return true
+	}
+	n := d.ranges.Add(1)
+	if d.opts.StopAtFirst && n > 1 {
+		return false
+	}
+	if d.opts.MaxRanges > 0 && n > int64(d.opts.MaxRanges) {
+		d.hit(LimitMaxRanges)
+		return false
+	}
+	return true
+}
+
+// done reports whether the traversal should stop: a budget was hit, or the first
+// range has been found with StopAtFirst.
+func (d *diffBudget) done() bool {
+	if d == nil {
+		return false
+	}
+	return d.exhausted() || (d.opts.StopAtFirst && d.ranges.Load() >= 1)
+}
+
+func (d *diffBudget) exhausted() bool {
+	return d != nil && d.limit.Load() != uint32(LimitNone)
+}
+
+func (d *diffBudget) hit(l DiffLimit) {
+	d.limit.CompareAndSwap(uint32(LimitNone), uint32(l))
+}
+
+// result wraps ranges with the budget's counters.
+func (d *diffBudget) result(ranges []DiffRange) DiffResult {
+	return DiffResult{
+		Ranges:       ranges,
+		Truncated:    d.exhausted(),
+		TruncatedBy:  DiffLimit(d.limit.Load()),
+		NodesVisited: d.nodes.Load(),
+		BytesRead:    d.bytes.Load(),
+	}
+}
+
+// TreeDiffWithOptions is TreeDiff bounded by opts.
+func (b *Builder) TreeDiffWithOptions(other *Builder, opts DiffOptions) (DiffResult, error) {
+	return Differ{Strategy: DiffAll, Traversal: TraverseRoot, Options: opts}.Diff(context.Background(), b, other)
+}
+
+// TreeBisectWithOptions is TreeBisect bounded by opts. The result holds at most one
+// range; MaxRanges and StopAtFirst are implied.
+func (b *Builder) TreeBisectWithOptions(other *Builder, opts DiffOptions) (DiffResult, error) {
+	return Differ{Strategy: DiffFirst, Traversal: TraverseRoot, Options: opts}.Diff(context.Background(), b, other)
+}
+
+// BisectWithOptions is Bisect bounded by opts. The result holds at most one range;
+// MaxRanges and StopAtFirst are implied.
+func (b *Builder) BisectWithOptions(other *Builder, opts DiffOptions) (DiffResult, error) {
+	return Differ{Strategy: DiffFirst, Traversal: TraversePeaks, Options: opts}.Diff(context.Background(), b, other)
+}
+
+// MultiBisectWithOptions is MultiBisectWithContext bounded by opts. The budget is
+// shared by all workers, so with concurrency > 1 the ranges found before a limit is
+// hit may vary between runs; they are always returned in ascending order.
+func (b *Builder) MultiBisectWithOptions(ctx context.Context, other *Builder, concurrency int, opts DiffOptions) (DiffResult, error) {
+	return multiBisectDiffer(concurrency, opts).Diff(ctx, b, other)
+}
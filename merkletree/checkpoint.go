@@ -0,0 +1,236 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const tagCheckpointV1 = byte(0xC1) // checkpoint encoding version
+
+// checkpointContext prefixes every signed message, so a checkpoint signature can
+// never be mistaken for a signature over anything else made with the same key.
+const checkpointContext = "JMDN-Merkletree checkpoint v1\x00"
+
+// HashSuiteSHA256 names the default hash function in Checkpoint.HashSuite.
+const HashSuiteSHA256 = "sha256"
+
+var (
+	// ErrInvalidSignature is returned when a checkpoint signature does not verify.
+	ErrInvalidSignature = errors.New("invalid checkpoint signature")
+	// ErrInsufficientSignatures is returned when a bundle has fewer than k valid
+	// signatures from trusted keys.
+	ErrInsufficientSignatures = errors.New("insufficient checkpoint signatures")
+)
+
+// Checkpoint is a root attested at a point in time: validators sign it so peers
+// can decide which roots to trust. Height is the last block included (meaningless
+// when TotalBlocks is 0), HashSuite names the hash function that produced Root and
+// Domain is the tree's Config.Domain.
+//
+// Signatures cover the canonical encoding (MarshalBinary) prefixed by a fixed
+// context string, never the JSON form.
+type Checkpoint struct {
+	Root        Hash32    `json:"root"`
+	TotalBlocks uint64    `json:"total_blocks"`
+	Height      uint64    `json:"height"`
+	HashSuite   string    `json:"hash_suite"`
+	Timestamp   time.Time `json:"timestamp"`
+	Domain      []byte    `json:"domain,omitempty"`
+}
+
+// Checkpoint returns a checkpoint of the root Finalize would return now, without
+// committing the partial chunk. suite names b's hash function (HashSuiteSHA256 for
+// the default).
+func (b *Builder) Checkpoint(suite string, at time.Time) (Checkpoint, error) {
+	n, err := b.RootView()
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	c := Checkpoint{TotalBlocks: b.totalBlocks, HashSuite: suite, Timestamp: at, Domain: bytes.Clone(b.cfg.Domain)}
+	if n != nil {
+		c.Root = n.Root
+		c.Height = n.Metadata.Start + uint64(n.Metadata.Count) - 1
+	}
+	return c, nil
+}
+
+// MarshalBinary returns the canonical encoding:
+//
+//	tag(0xC1) || root || totalBlocks || height || len(suite) (1 byte) || suite ||
+//	unix seconds (int64) || nanoseconds (uint32) || len(domain) (uint32) || domain
+//
+// Integers are little-endian. The timestamp is encoded to the nanosecond, so time
+// zones and monotonic clock readings do not affect it.
+func (c Checkpoint) MarshalBinary() ([]byte, error) {
+	if len(c.HashSuite) > 255 {
+		return nil, fmt.Errorf("hash suite name too long (%d bytes)", len(c.HashSuite))
+	}
+	buf := make([]byte, 0, 1+32+8+8+1+len(c.HashSuite)+8+4+4+len(c.Domain))
+	buf = append(buf, tagCheckpointV1)
+	buf = append(buf, c.Root[:]...)
+	buf = binary.LittleEndian.AppendUint64(buf, c.TotalBlocks)
+	buf = binary.LittleEndian.AppendUint64(buf, c.Height)
+	buf = append(buf, byte(len(c.HashSuite)))
+	buf = append(buf, c.HashSuite...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(c.Timestamp.Unix()))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(c.Timestamp.Nanosecond()))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(c.Domain)))
+	buf = append(buf, c.Domain...)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes the canonical encoding. The timestamp is returned in UTC.
+func (c *Checkpoint) UnmarshalBinary(data []byte) error {
+	const fixed = 1 + 32 + 8 + 8 + 1 + 8 + 4 + 4
+	if len(data) < fixed || data[0] != tagCheckpointV1 {
+		return errors.New("invalid checkpoint encoding")
+	}
+	suiteLen := int(data[1+32+8+8])
+	if len(data) < fixed+suiteLen {
+		return errors.New("invalid checkpoint encoding length")
+	}
+	domainLen := binary.LittleEndian.Uint32(data[fixed-4+suiteLen:])
+	if uint64(len(data)) != uint64(fixed+suiteLen)+uint64(domainLen) {
+		return errors.New("invalid checkpoint encoding length")
+	}
+	var out Checkpoint
+	copy(out.Root[:], data[1:33])
+	out.TotalBlocks = binary.LittleEndian.Uint64(data[33:41])
+	out.Height = binary.LittleEndian.Uint64(data[41:49])
+	rest := data[50:]
+	out.HashSuite = string(rest[:suiteLen])
+	rest = rest[suiteLen:]
+	nsec := binary.LittleEndian.Uint32(rest[8:12])
+	if nsec >= 1e9 {
+		return errors.New("invalid checkpoint timestamp")
+	}
+	out.Timestamp = time.Unix(int64(binary.LittleEndian.Uint64(rest)), int64(nsec)).UTC()
+	if domainLen > 0 {
+		out.Domain = bytes.Clone(rest[16:])
+	}
+	*c = out
+	return nil
+}
+
+// Equal reports whether c and o have the same canonical encoding.
+func (c Checkpoint) Equal(o Checkpoint) bool {
+	a, err1 := c.MarshalBinary()
+	b, err2 := o.MarshalBinary()
+	return err1 == nil && err2 == nil && bytes.Equal(a, b)
+}
+
+// VerifyProof checks that p proves blockHash against c's root and domain, hashing
+// with hf (nil for the default hash function). It does not check signatures.
+func (c Checkpoint) VerifyProof(p *BlockProof, hf HashFactory, blockHash Hash32) error {
+	if err := checkDomain("proof", p.Domain, c.Domain); err != nil {
+		return err
+	}
+	return p.Verify(hf, c.Root, blockHash)
+}
+
+// signingMessage returns the bytes a signature covers.
+func (c Checkpoint) signingMessage() ([]byte, error) {
+	enc, err := c.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(checkpointContext), enc...), nil
+}
+
+// CheckpointSignature is one signer's Ed25519 signature over a checkpoint.
+type CheckpointSignature struct {
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	Signature []byte            `json:"signature"`
+}
+
+// Sign signs c with key.
+func (c Checkpoint) Sign(key ed25519.PrivateKey) (CheckpointSignature, error) {
+	msg, err := c.signingMessage()
+	if err != nil {
+		return CheckpointSignature{}, err
+	}
+	return CheckpointSignature{
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(key, msg),
+	}, nil
+}
+
+// Verify checks that s is a valid signature over c by s.PublicKey. It does not
+// decide whether that key is trusted.
+func (c Checkpoint) Verify(s CheckpointSignature) error {
+	if len(s.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: public key is %d bytes", ErrInvalidSignature, len(s.PublicKey))
+	}
+	msg, err := c.signingMessage()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(s.PublicKey, msg, s.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// CheckpointBundle is a checkpoint with signatures from several signers, checked
+// against a k-of-n trusted set with Verify.
+type CheckpointBundle struct {
+	Checkpoint Checkpoint            `json:"checkpoint"`
+	Signatures []CheckpointSignature `json:"signatures"`
+}
+
+// Sign adds a signature by key. A key that already signed is not added twice.
+func (bn *CheckpointBundle) Sign(key ed25519.PrivateKey) error {
+	s, err := bn.Checkpoint.Sign(key)
+	if err != nil {
+		return err
+	}
+	return bn.Add(s)
+}
+
+// Add adds a signature made by someone else after checking it, so that bundles
+// gathered from several signers can be combined. Duplicate signers are ignored.
+func (bn *CheckpointBundle) Add(s CheckpointSignature) error {
+	if err := bn.Checkpoint.Verify(s); err != nil {
+		return err
+	}
+	for _, o := range bn.Signatures {
+		if bytes.Equal(o.PublicKey, s.PublicKey) {
+			return nil
+		}
+	}
+	bn.Signatures = append(bn.Signatures, s)
+	return nil
+}
+
+// Verify checks that at least k distinct keys of trusted produced valid
+// signatures, and returns the indices into trusted of the keys that did.
+// Signatures from untrusted keys and invalid signatures are ignored, so a bundle
+// may carry signatures for several trust sets. ErrInsufficientSignatures is
+// returned when fewer than k remain.
+func (bn *CheckpointBundle) Verify(trusted []ed25519.PublicKey, k int) ([]int, error) {
+	if k <= 0 || k > len(trusted) {
+		return nil, fmt.Errorf("threshold %d out of range for %d trusted keys", k, len(trusted))
+	}
+	var signers []int
+	counted := make(map[string]bool, len(trusted))
+	for i, key := range trusted {
+		if counted[string(key)] {
+			continue // listed twice; count it once
+		}
+		for _, s := range bn.Signatures {
+			if bytes.Equal(s.PublicKey, key) && bn.Checkpoint.Verify(s) == nil {
+				signers = append(signers, i)
+				counted[string(key)] = true
+				break
+			}
+		}
+	}
+	if len(signers) < k {
+		return signers, fmt.Errorf("%w: %d of %d required", ErrInsufficientSignatures, len(signers), k)
+	}
+	return signers, nil
+}
@@ -0,0 +1,96 @@
+package merkletree
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Concat returns a Builder holding the blocks of left followed by those of right,
+// in the state left would reach by pushing right's blocks itself: same root,
+// snapshot and partial chunk. right must start where left ends (at any height if
+// left is empty and has no Config.StartHeight) and use the same BlockMerge and
+// Domain (ErrConfigMismatch, ErrDomainMismatch). The result takes left's Config
+// without its Observer; neither builder is modified.
+//
+// When left ends on a chunk boundary, right's chunks are already the chunks of
+// the sequential build, and its outer subtrees are reused wherever they line up
+// with the combined leaf index, so only nodes spanning the seam are hashed.
+// Otherwise right's blocks are re-chunked from its element hashes, which needs
+// Config.RetainElements on right (ErrElementsNotRetained).
+//
+// left must not have been finalized with a partial chunk, since pushing after
+// Finalize would not continue the sequential build either.
+func Concat(left, right *Builder) (*Builder, error) {
+	if left.cfg.BlockMerge != right.cfg.BlockMerge {
+		return nil, fmt.Errorf("blockMerge %d != %d: %w", left.cfg.BlockMerge, right.cfg.BlockMerge, ErrConfigMismatch)
+	}
+	if err := checkDomain("right", right.cfg.Domain, left.cfg.Domain); err != nil {
+		return nil, err
+	}
+	if right.gaps > 0 && !left.cfg.AllowGaps {
+		return nil, fmt.Errorf("right has gaps but left does not allow them: %w", ErrConfigMismatch)
+	}
+
+	out := left.Fork()
+	if right.totalBlocks+right.gaps == 0 {
+		return out, nil
+	}
+	if end, ok := left.nextHeight(); ok && right.startHeight() != end {
+		return nil, fmt.Errorf("right starts at %d, left ends at %d", right.startHeight(), end)
+	}
+	if last := left.lastLeaf(); last != nil && len(left.inChunkElems) == 0 &&
+		!last.Gap && int(last.Metadata.Count) != left.cfg.BlockMerge {
+		return nil, fmt.Errorf("left was finalized with a partial chunk of %d blocks", last.Metadata.Count)
+	}
+
+	if len(out.inChunkElems) > 0 {
+		if err := out.appendLeaves("concat", right); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	// Add right's leaves in order, each time as the largest subtree of right that
+	// is also aligned in the combined tree.
+	for i, n := uint64(0), right.outer.leafCount; i < n; {
+		pos := out.outer.leafCount
+		level := bits.TrailingZeros64(i | pos | 1<<63)
+		for i+1<<uint(level) > n {
+			level--
+		}
+		sub := right.outer.subtree(i, level)
+		for sub == nil {
+			level--
+			sub = right.outer.subtree(i, level)
+		}
+		if err := out.outer.addSubtree(sub, level); err != nil {
+			return nil, err
+		}
+		merges := uint64(bits.TrailingZeros64(^(pos >> uint(level))))
+		out.hashing.NodeDigests += merges
+		out.hashing.BytesHashed += merges * nodeDigestInput
+		i += 1 << uint(level)
+	}
+	out.inChunkElems = append(out.inChunkElems, right.inChunkElems...)
+	out.inChunkStart = right.inChunkStart
+	out.totalBlocks += right.totalBlocks
+	out.gaps += right.gaps
+	if out.enforceHeights {
+		_, out.expectedNextHeight = out.heightSpan()
+	}
+	return out, nil
+}
+
+// lastLeaf returns the last committed leaf, or nil if there is none.
+func (b *Builder) lastLeaf() *Node {
+	for _, n := range b.outer.peaks {
+		if n == nil {
+			continue
+		}
+		for !n.HasData {
+			n = n.Right
+		}
+		return n
+	}
+	return nil
+}
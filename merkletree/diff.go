@@ -1,36 +1,64 @@
 package merkletree
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
 )
 
-// TreeDiff traverses the entire structure of two trees (starting from RootNode)
-// and returns ALL ranges that differ or are missing.
+// TreeDiff traverses the entire structure of two trees (starting from the root
+// Finalize would produce) and returns ALL ranges that differ or are missing.
 //
 // It is useful for full synchronization where you want to identify all
-// discrepancies in one pass, rather than just the first one.
+// discrepancies in one pass, rather than just the first one. Neither builder is
+// modified: partial chunks are compared without being committed.
 func (b *Builder) TreeDiff(other *Builder) ([]DiffRange, error) {
-	root1, err := b.RootNode()
+	res, err := Differ{Strategy: DiffAll, Traversal: TraverseRoot}.Diff(context.Background(), b, other)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get root node for self: %w", err)
-	}
-	root2, err := other.RootNode()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get root node for other: %w", err)
+		return nil, err
 	}
+	return res.Ranges, nil
+}
 
-	return b.diffIterative(root1, root2)
+// diffWalker is the traversal shared by every diff entry point (see Differ).
+type diffWalker struct {
+	ctx    context.Context
+	budget *diffBudget // optional
+	// split, if set, is offered every pair of aligned internal nodes whose roots
+	// differ; returning true hands the pair off instead of descending into it.
+	split func(n1, n2 *Node) bool
+	// expand reads the children of a node, per side; nil means they are in memory.
+	expand [2]nodeExpander
+	// log, if set, receives a debug record for every descent.
+	log *slog.Logger
 }
 
-func (b *Builder) diffIterative(root1, root2 *Node) ([]DiffRange, error) {
-	var diffs []DiffRange
+// nodeExpander returns the children of an internal node that is not (fully)
+// held in memory, such as a node decoded lazily from a snapshot.
+type nodeExpander func(n *Node) (left, right *Node, err error)
+
+// walk compares two forests of subtrees, each given in ascending height order, and
+// passes each differing range to emit in ascending height order. The walk stops
+// early when emit returns false, the budget is exhausted or ctx is done; it only
+// fails if a node cannot be expanded.
+//
+// Nodes are matched by range rather than by position: when the two sides cover the
+// same start with different sizes, the larger node is broken down until the sizes
+// line up, so trees of different lengths (and hence different shapes) compare
+// correctly.
+func (w diffWalker) walk(forest1, forest2 []*Node, emit func(DiffRange) bool) error {
+	// Stacks hold the pending nodes of each side, leftmost on top.
+	stack1 := reverseForest(forest1)
+	stack2 := reverseForest(forest2)
+	var err error
+	// A node stays on top of its stack while the other side catches up; it is
+	// charged to the budget only the first time it is examined.
+	var seen1, seen2 *Node
 
-	// Stack for Tree 1
-	stack1 := []*Node{root1}
-	// Stack for Tree 2
-	stack2 := []*Node{root2}
+	for steps := 0; len(stack1) > 0 || len(stack2) > 0; steps++ {
+		if steps%64 == 0 && w.ctx.Err() != nil {
+			return nil
+		}
 
-	for len(stack1) > 0 || len(stack2) > 0 {
 		var n1, n2 *Node
 
 		// Peek from stacks
@@ -40,6 +68,18 @@ func (b *Builder) diffIterative(root1, root2 *Node) ([]DiffRange, error) {
 		if len(stack2) > 0 {
 			n2 = stack2[len(stack2)-1]
 		}
+		if n1 != seen1 {
+			if !w.budget.visit(n1) {
+				return nil
+			}
+			seen1 = n1
+		}
+		if n2 != seen2 {
+			if !w.budget.visit(n2) {
+				return nil
+			}
+			seen2 = n2
+		}
 
 		// 1. Handle Nil/Empty Tree cases
 		if n1 == nil && n2 == nil {
@@ -56,14 +96,18 @@ func (b *Builder) diffIterative(root1, root2 *Node) ([]DiffRange, error) {
 		// If one is nil, the other is "extra content" (diff)
 		if n1 == nil {
 			// n2 is extra
-			diffs = append(diffs, DiffRange{Start: n2.Metadata.Start, Count: n2.Metadata.Count})
+			if !emit(newDiffRange(DiffRemoteOnly, nil, n2)) {
+				return nil
+			}
 			stack2 = stack2[:len(stack2)-1] // Pop n2
 			// stack1 stays same (empty/nil)
 			continue
 		}
 		if n2 == nil {
 			// n1 is extra
-			diffs = append(diffs, DiffRange{Start: n1.Metadata.Start, Count: n1.Metadata.Count})
+			if !emit(newDiffRange(DiffLocalOnly, n1, nil)) {
+				return nil
+			}
 			stack1 = stack1[:len(stack1)-1] // Pop n1
 			// stack2 stays same
 			continue
@@ -81,14 +125,18 @@ func (b *Builder) diffIterative(root1, root2 *Node) ([]DiffRange, error) {
 		// If starts differ, the one starting earlier is "extra" until the other starts.
 		if n1.Metadata.Start < n2.Metadata.Start {
 			// n1 is earlier. It's a diff.
-			diffs = append(diffs, DiffRange{Start: n1.Metadata.Start, Count: n1.Metadata.Count})
+			if !emit(newDiffRange(DiffLocalOnly, n1, nil)) {
+				return nil
+			}
 			stack1 = stack1[:len(stack1)-1] // Pop n1
 			// Keep n2 to compare with next n1
 			continue
 		}
 		if n2.Metadata.Start < n1.Metadata.Start {
 			// n2 is earlier.
-			diffs = append(diffs, DiffRange{Start: n2.Metadata.Start, Count: n2.Metadata.Count})
+			if !emit(newDiffRange(DiffRemoteOnly, nil, n2)) {
+				return nil
+			}
 			stack2 = stack2[:len(stack2)-1] // Pop n2
 			// Keep n1
 			continue
@@ -103,7 +151,9 @@ func (b *Builder) diffIterative(root1, root2 *Node) ([]DiffRange, error) {
 				// And since starts match, n2 is a subset of n1 range.
 				// n1 says "I am a single block/chunk covering X". n2 says "I am smaller X-epsilon".
 				// Structure incompatible.
-				diffs = append(diffs, DiffRange{Start: n1.Metadata.Start, Count: n1.Metadata.Count})
+				if !emit(newDiffRange(DiffShapeMismatch, n1, n2)) {
+					return nil
+				}
 				stack1 = stack1[:len(stack1)-1]
 				// We must also consume n2 because n1 "covered" it and more.
 				// Wait, if n1 covers [100..200] and n2 covers [100..150].
@@ -117,11 +167,8 @@ func (b *Builder) diffIterative(root1, root2 *Node) ([]DiffRange, error) {
 			// Break down n1
 			stack1 = stack1[:len(stack1)-1]
 			// Push children in reverse order
-			if n1.Right != nil {
-				stack1 = append(stack1, n1.Right)
-			}
-			if n1.Left != nil {
-				stack1 = append(stack1, n1.Left)
+			if stack1, err = w.push(0, stack1, n1); err != nil {
+				return err
 			}
 			continue
 		}
@@ -129,7 +176,11 @@ func (b *Builder) diffIterative(root1, root2 *Node) ([]DiffRange, error) {
 		if n2.Metadata.Count > n1.Metadata.Count {
 			if n2.HasData {
 				// n2 is Leaf and Larger
-				diffs = append(diffs, DiffRange{Start: n2.Metadata.Start, Count: n2.Metadata.Count})
+				d := newDiffRange(DiffShapeMismatch, n1, n2)
+				d.Start, d.Count = n2.Metadata.Start, n2.Metadata.Count
+				if !emit(d) {
+					return nil
+				}
 				stack2 = stack2[:len(stack2)-1]
 				stack1 = stack1[:len(stack1)-1] // Consume n1 too
 				continue
@@ -137,11 +188,8 @@ func (b *Builder) diffIterative(root1, root2 *Node) ([]DiffRange, error) {
 
 			// Break down n2
 			stack2 = stack2[:len(stack2)-1]
-			if n2.Right != nil {
-				stack2 = append(stack2, n2.Right)
-			}
-			if n2.Left != nil {
-				stack2 = append(stack2, n2.Left)
+			if stack2, err = w.push(1, stack2, n2); err != nil {
+				return err
 			}
 			continue
 		}
@@ -151,31 +199,64 @@ func (b *Builder) diffIterative(root1, root2 *Node) ([]DiffRange, error) {
 		// If Hash Different -> Content Mismatch
 		if n1.HasData || n2.HasData {
 			// Mismatching leaves or leaf-vs-node
-			diffs = append(diffs, DiffRange{Start: n1.Metadata.Start, Count: n1.Metadata.Count})
+			if !emit(newDiffRange(pairKind(n1, n2), n1, n2)) {
+				return nil
+			}
 			stack1 = stack1[:len(stack1)-1]
 			stack2 = stack2[:len(stack2)-1]
 			continue
 		}
 
 		// Both Internal, same size, different hash.
-		// Break down BOTH to find sub-diffs.
+		// Break down BOTH to find sub-diffs, unless the pair is handed off.
 		stack1 = stack1[:len(stack1)-1]
 		stack2 = stack2[:len(stack2)-1]
+		if w.split != nil && w.split(n1, n2) {
+			continue
+		}
 
-		if n1.Right != nil {
-			stack1 = append(stack1, n1.Right)
+		if stack1, err = w.push(0, stack1, n1); err != nil {
+			return err
 		}
-		if n1.Left != nil {
-			stack1 = append(stack1, n1.Left)
+		if stack2, err = w.push(1, stack2, n2); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if n2.Right != nil {
-			stack2 = append(stack2, n2.Right)
-		}
-		if n2.Left != nil {
-			stack2 = append(stack2, n2.Left)
+var diffSideNames = [2]string{"local", "remote"}
+
+// reverseForest returns the non-nil nodes of forest in reverse order, ready to be
+// used as a stack.
+func reverseForest(forest []*Node) []*Node {
+	stack := make([]*Node, 0, len(forest))
+	for i := len(forest) - 1; i >= 0; i-- {
+		if forest[i] != nil {
+			stack = append(stack, forest[i])
 		}
 	}
+	return stack
+}
 
-	return diffs, nil
+// push replaces n, already popped from stack, with its children.
+func (w diffWalker) push(side int, stack []*Node, n *Node) ([]*Node, error) {
+	if w.log != nil {
+		w.log.LogAttrs(w.ctx, slog.LevelDebug, "diff descend",
+			append(rangeAttrs(n.Metadata.Start, n.Metadata.Count), slog.String("side", diffSideNames[side]))...)
+	}
+	left, right := n.Left, n.Right
+	if expand := w.expand[side]; expand != nil {
+		var err error
+		if left, right, err = expand(n); err != nil {
+			return stack, err
+		}
+	}
+	if right != nil {
+		stack = append(stack, right)
+	}
+	if left != nil {
+		stack = append(stack, left)
+	}
+	return stack, nil
 }
@@ -0,0 +1,150 @@
+package merkletree
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// DiffKind classifies a differing range from the local tree's point of view.
+type DiffKind uint8
+
+const (
+	// DiffMismatch: both trees cover the range with the same shape but different contents.
+	DiffMismatch DiffKind = iota
+	// DiffLocalOnly: the range exists in the local tree but not in the remote one.
+	DiffLocalOnly
+	// DiffRemoteOnly: the range exists in the remote tree but not in the local one.
+	DiffRemoteOnly
+	// DiffShapeMismatch: both trees cover the range but their node structure is
+	// incompatible (e.g. a chunk leaf against a larger or smaller subtree).
+	DiffShapeMismatch
+	// DiffGap: at least one side has a gap leaf (Config.AllowGaps) over the range,
+	// i.e. no blocks, and the other side differs from it.
+	DiffGap
+)
+
+var diffKindNames = [...]string{
+	DiffMismatch:      "mismatch",
+	DiffLocalOnly:     "local_only",
+	DiffRemoteOnly:    "remote_only",
+	DiffShapeMismatch: "shape_mismatch",
+	DiffGap:           "gap",
+}
+
+func (k DiffKind) String() string {
+	if int(k) < len(diffKindNames) {
+		return diffKindNames[k]
+	}
+	return fmt.Sprintf("DiffKind(%d)", uint8(k))
+}
+
+func (k DiffKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *DiffKind) UnmarshalText(text []byte) error {
+	for i, name := range diffKindNames {
+		if name == string(text) {
+			*k = DiffKind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown diff kind %q", text)
+}
+
+// DiffRange represents a range of blocks that differ between two trees.
+//
+// LocalRoot and RemoteRoot are the subtree commitments on each side when the range
+// corresponds to a single node there; they are zero for the absent side and for
+// ranges that were merged from several nodes. In JSON they are hex strings.
+type DiffRange struct {
+	Start      uint64   `json:"start"`
+	Count      uint32   `json:"count"`
+	Kind       DiffKind `json:"kind"`
+	LocalRoot  Hash32   `json:"local_root"`
+	RemoteRoot Hash32   `json:"remote_root"`
+}
+
+// newDiffRange builds a DiffRange for a local/remote node pair. The range is taken
+// from the local node when present, otherwise from the remote node. Ranges
+// involving a gap leaf are reported as DiffGap whatever kind is passed.
+func newDiffRange(kind DiffKind, local, remote *Node) DiffRange {
+	if (local != nil && local.Gap) || (remote != nil && remote.Gap) {
+		kind = DiffGap
+	}
+	d := DiffRange{Kind: kind}
+	if local != nil {
+		d.Start, d.Count = local.Metadata.Start, local.Metadata.Count
+		d.LocalRoot = local.Root
+	}
+	if remote != nil {
+		if local == nil {
+			d.Start, d.Count = remote.Metadata.Start, remote.Metadata.Count
+		}
+		d.RemoteRoot = remote.Root
+	}
+	return d
+}
+
+// pairKind classifies two nodes covering the same start height.
+func pairKind(local, remote *Node) DiffKind {
+	switch {
+	case local == nil:
+		return DiffRemoteOnly
+	case remote == nil:
+		return DiffLocalOnly
+	case local.Metadata != remote.Metadata || local.HasData != remote.HasData:
+		return DiffShapeMismatch
+	default:
+		return DiffMismatch
+	}
+}
+
+// hexHash is a Hash32 that encodes as lowercase hex text. It is used for the
+// roots in DiffRange's JSON only; Hash32 itself keeps the default encoding.
+type hexHash Hash32
+
+func (h hexHash) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h[:])), nil
+}
+
+func (h *hexHash) UnmarshalText(text []byte) error {
+	if hex.DecodedLen(len(text)) != len(h) {
+		return fmt.Errorf("invalid hash length: %d hex chars", len(text))
+	}
+	_, err := hex.Decode(h[:], text)
+	return err
+}
+
+// diffRangeJSON is the JSON form of DiffRange, with hex roots.
+type diffRangeJSON struct {
+	Start      uint64   `json:"start"`
+	Count      uint32   `json:"count"`
+	Kind       DiffKind `json:"kind"`
+	LocalRoot  hexHash  `json:"local_root"`
+	RemoteRoot hexHash  `json:"remote_root"`
+}
+
+func (d DiffRange) toJSON() diffRangeJSON {
+	return diffRangeJSON{d.Start, d.Count, d.Kind, hexHash(d.LocalRoot), hexHash(d.RemoteRoot)}
+}
+
+func (j diffRangeJSON) diffRange() DiffRange {
+	return DiffRange{j.Start, j.Count, j.Kind, Hash32(j.LocalRoot), Hash32(j.RemoteRoot)}
+}
+
+// MarshalJSON encodes the range with its roots as hex strings.
+func (d DiffRange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.toJSON())
+}
+
+// UnmarshalJSON decodes a range encoded by MarshalJSON.
+func (d *DiffRange) UnmarshalJSON(data []byte) error {
+	var j diffRangeJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*d = j.diffRange()
+	return nil
+}
@@ -0,0 +1,543 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"sync"
+)
+
+// DiffStrategy selects how many differing ranges a Differ reports.
+type DiffStrategy uint8
+
+const (
+	// DiffAll reports every differing range (TreeDiff, MultiBisect).
+	DiffAll DiffStrategy = iota
+	// DiffFirst reports only the leftmost differing range (Bisect, TreeBisect).
+	DiffFirst
+)
+
+// DiffTraversal selects the nodes a Differ starts comparing from.
+type DiffTraversal uint8
+
+const (
+	// TraverseRoot starts from the root Finalize would produce (TreeDiff, TreeBisect).
+	TraverseRoot DiffTraversal = iota
+	// TraversePeaks starts from the committed peaks, oldest first, followed by a leaf
+	// for the uncommitted partial chunk (Bisect, MultiBisect). It skips the fold nodes
+	// above the peaks, so ranges never span more than one peak.
+	TraversePeaks
+)
+
+// Differ is the diff engine behind Bisect, TreeBisect, TreeDiff, MultiBisect and
+// their streaming and budgeted variants. All of them walk the two trees the same
+// way: nodes are matched by the height range they cover, so builders of different
+// lengths are compared correctly, and uncommitted partial chunks are included
+// without being committed. Only the reporting differs:
+//
+//   - Strategy chooses between the first differing range and all of them.
+//   - Traversal chooses the starting nodes; both find the same differing blocks, but
+//     TraverseRoot may report a missing tail as fewer, larger ranges.
+//   - Concurrency > 1 lets DiffAll traverse independent subtrees in parallel;
+//     results are identical to a sequential run.
+//   - Merge joins adjacent ranges of the same kind (as MultiBisect does).
+//   - Options bounds the work done (see DiffOptions).
+//
+// The zero Differ behaves like TreeDiff.
+type Differ struct {
+	Strategy    DiffStrategy
+	Traversal   DiffTraversal
+	Concurrency int
+	Merge       bool
+	Options     DiffOptions
+}
+
+// Diff compares local against remote. Ranges are in ascending height order; kinds
+// and roots are given from local's point of view. If ctx is cancelled, ctx.Err()
+// is returned.
+func (d Differ) Diff(ctx context.Context, local, remote *Builder) (DiffResult, error) {
+	d = d.observed(local)
+	s1, s2, err := d.builderSides(local, remote)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	return d.run(ctx, s1, s2)
+}
+
+// run collects the ranges between two sides.
+func (d Differ) run(ctx context.Context, s1, s2 diffSide) (DiffResult, error) {
+	budget := newDiffBudget(d.options())
+	var ranges []DiffRange
+	if d.parallel() {
+		out, errc := d.stream(ctx, s1, s2, budget)
+		for r := range out {
+			ranges = append(ranges, r)
+		}
+		if err := <-errc; err != nil {
+			return DiffResult{}, err
+		}
+		return budget.result(ranges), nil
+	}
+
+	ctx, done := d.trace(ctx)
+	sink := d.sink(budget, func(r DiffRange) bool {
+		ranges = append(ranges, r)
+		return true
+	})
+	err := d.walker(ctx, budget, s1, s2).walk(s1.forest, s2.forest, sink.add)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		sink.flush()
+	}
+	done(budget, len(ranges), err)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	return budget.result(ranges), nil
+}
+
+// Stream is the channel form of Diff: ranges are sent in ascending height order as
+// soon as every range before them is known. The range channel is closed when the
+// traversal completes or ctx is cancelled; the error channel then receives the
+// error (ctx.Err() if cancelled), if any, and is closed.
+func (d Differ) Stream(ctx context.Context, local, remote *Builder) (<-chan DiffRange, <-chan error) {
+	d = d.observed(local)
+	s1, s2, err := d.builderSides(local, remote)
+	if err != nil {
+		out := make(chan DiffRange)
+		errc := make(chan error, 1)
+		close(out)
+		errc <- err
+		close(errc)
+		return out, errc
+	}
+	return d.stream(ctx, s1, s2, newDiffBudget(d.options()))
+}
+
+// Seq is the iterator form of Diff. Without concurrency the traversal runs in the
+// caller's goroutine and advances only as ranges are consumed.
+func (d Differ) Seq(local, remote *Builder) iter.Seq2[DiffRange, error] {
+	d = d.observed(local)
+	return func(yield func(DiffRange, error) bool) {
+		if d.parallel() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			out, errc := d.Stream(ctx, local, remote)
+			for r := range out {
+				if !yield(r, nil) {
+					// Wait for the workers to wind down before returning.
+					cancel()
+					for range errc {
+					}
+					return
+				}
+			}
+			if err := <-errc; err != nil {
+				yield(DiffRange{}, err)
+			}
+			return
+		}
+
+		s1, s2, err := d.builderSides(local, remote)
+		if err != nil {
+			yield(DiffRange{}, err)
+			return
+		}
+		budget := newDiffBudget(d.options())
+		ctx, done := d.trace(context.Background())
+		reported := 0
+		defer func() { done(budget, reported, err) }()
+		sink := d.sink(budget, func(r DiffRange) bool {
+			reported++
+			return yield(r, nil)
+		})
+		if err = d.walker(ctx, budget, s1, s2).walk(s1.forest, s2.forest, sink.add); err != nil {
+			if !sink.closed {
+				yield(DiffRange{}, err)
+			}
+			return
+		}
+		sink.flush()
+	}
+}
+
+// first runs d and returns its first range, or (0, 0) if there is none.
+func (d Differ) first(local, remote *Builder) (uint64, uint32, error) {
+	res, err := d.Diff(context.Background(), local, remote)
+	if err != nil || len(res.Ranges) == 0 {
+		return 0, 0, err
+	}
+	return res.Ranges[0].Start, res.Ranges[0].Count, nil
+}
+
+func (d Differ) options() DiffOptions {
+	opts := d.Options
+	if d.Strategy == DiffFirst {
+		opts.StopAtFirst = true
+	}
+	return opts
+}
+
+func (d Differ) parallel() bool {
+	return d.Strategy == DiffAll && d.Concurrency > 1
+}
+
+// diffSide is one tree as seen by the walk: the nodes to start from, in ascending
+// height order, and how to reach the children of a node.
+type diffSide struct {
+	forest []*Node
+	expand nodeExpander // nil when the whole tree is in memory
+}
+
+func (d Differ) builderSides(local, remote *Builder) (diffSide, diffSide, error) {
+	if err := checkDomain("remote", remote.cfg.Domain, local.cfg.Domain); err != nil {
+		return diffSide{}, diffSide{}, err
+	}
+	s1, err := d.localSide(local)
+	if err != nil {
+		return diffSide{}, diffSide{}, err
+	}
+	f2, err := d.forest(remote.outer.peaks, remote.outer.leafCount, remote.partialLeaf(), remote.hf)
+	if err != nil {
+		return diffSide{}, diffSide{}, fmt.Errorf("failed to get root node for other: %w", err)
+	}
+	return s1, diffSide{forest: f2}, nil
+}
+
+// forest returns the starting nodes for d.Traversal of a tree with the given peaks
+// (indexed by level) and uncommitted partial chunk leaf (optional). Only the roots
+// and ranges of the peaks are read.
+func (d Differ) forest(peaks []*Node, leafCount uint64, partial *Node, hf HashFactory) ([]*Node, error) {
+	if d.Traversal == TraversePeaks {
+		var f []*Node
+		for level := len(peaks) - 1; level >= 0; level-- {
+			if peaks[level] != nil {
+				f = append(f, peaks[level])
+			}
+		}
+		if partial != nil {
+			f = append(f, partial)
+		}
+		return f, nil
+	}
+
+	acc := newPeaksAccumulator(hf, outerNodeDigest)
+	acc.peaks = append(acc.peaks, peaks...)
+	acc.leafCount = leafCount
+	if partial != nil {
+		if err := acc.AddLeaf(partial); err != nil {
+			return nil, err
+		}
+	}
+	return []*Node{acc.RootNode()}, nil
+}
+
+func (d Differ) walker(ctx context.Context, budget *diffBudget, s1, s2 diffSide) diffWalker {
+	return diffWalker{
+		ctx:    ctx,
+		budget: budget,
+		expand: [2]nodeExpander{s1.expand, s2.expand},
+		log:    debugLogger(ctx, d.Options.Logger),
+	}
+}
+
+// sink returns a rangeSink applying d's merging and the budget before send.
+func (d Differ) sink(budget *diffBudget, send func(DiffRange) bool) *rangeSink {
+	return &rangeSink{merge: d.Merge, budget: budget, send: send, log: debugLogger(context.Background(), d.Options.Logger)}
+}
+
+// observed returns d with local's logger, tracer and metrics filled in where
+// d.Options has none.
+func (d Differ) observed(local *Builder) Differ {
+	if d.Options.Logger == nil {
+		d.Options.Logger = local.cfg.Logger
+	}
+	if d.Options.Tracer == nil {
+		d.Options.Tracer = local.cfg.Tracer
+	}
+	if d.Options.Metrics == nil {
+		d.Options.Metrics = local.cfg.Metrics
+	}
+	return d
+}
+
+// trace starts the span of a diff run; the returned function records the outcome
+// (span, log and metrics) and ends it.
+func (d Differ) trace(ctx context.Context) (context.Context, func(budget *diffBudget, ranges int, err error)) {
+	strategy, traversal := "all", "root"
+	if d.Strategy == DiffFirst {
+		strategy = "first"
+	}
+	if d.Traversal == TraversePeaks {
+		traversal = "peaks"
+	}
+	ctx, span := startSpan(ctx, d.Options.Tracer, "merkletree.Diff",
+		slog.String("strategy", strategy), slog.String("traversal", traversal), slog.Int("concurrency", max(d.Concurrency, 1)))
+	return ctx, func(budget *diffBudget, ranges int, err error) {
+		res := budget.result(nil)
+		attrs := []slog.Attr{
+			slog.Int("ranges", ranges),
+			slog.Uint64("nodes_visited", res.NodesVisited),
+			slog.Uint64("bytes_read", res.BytesRead),
+		}
+		if res.Truncated {
+			attrs = append(attrs, slog.String("truncated_by", res.TruncatedBy.String()))
+		}
+		span.SetAttributes(attrs...)
+		endSpan(span, err)
+		d.Options.Metrics.diffed(res.NodesVisited, ranges)
+		if l := debugLogger(ctx, d.Options.Logger); l != nil {
+			if err != nil {
+				attrs = append(attrs, slog.Any("error", err))
+			}
+			l.LogAttrs(ctx, slog.LevelDebug, "diff done", attrs...)
+		}
+	}
+}
+
+// rangeSink receives ranges in ascending order, merges them if requested, and
+// charges each reported range to the budget.
+type rangeSink struct {
+	merge   bool
+	budget  *diffBudget
+	send    func(DiffRange) bool
+	pending *DiffRange
+	// stopped is set when the budget refuses a range; that ends the diff without
+	// an error (DiffResult reports the truncation).
+	stopped bool
+	// closed is set when send returns false.
+	closed bool
+	// log, if set, receives a debug record for every reported range.
+	log *slog.Logger
+}
+
+// add reports whether the traversal should go on.
+func (s *rangeSink) add(r DiffRange) bool {
+	if !s.merge {
+		return s.report(r) && !s.budget.done()
+	}
+	if p := s.pending; p != nil && r.Kind == p.Kind && r.Start <= p.Start+uint64(p.Count) {
+		if end := r.Start + uint64(r.Count); end > p.Start+uint64(p.Count) {
+			p.Count = uint32(end - p.Start)
+			p.LocalRoot, p.RemoteRoot = Hash32{}, Hash32{}
+		}
+		return !s.budget.exhausted()
+	}
+	if !s.flush() {
+		return false
+	}
+	s.pending = &r
+	return !s.budget.done()
+}
+
+// flush reports the merged range still pending, if any.
+func (s *rangeSink) flush() bool {
+	if s.stopped || s.closed {
+		return false
+	}
+	if s.pending == nil {
+		return true
+	}
+	r := *s.pending
+	s.pending = nil
+	return s.report(r)
+}
+
+func (s *rangeSink) report(r DiffRange) bool {
+	if !s.budget.take() {
+		s.stopped = true
+		return false
+	}
+	if s.log != nil {
+		s.log.LogAttrs(context.Background(), slog.LevelDebug, "diff range",
+			append(rangeAttrs(r.Start, r.Count), slog.String("kind", r.Kind.String()),
+				slog.Any("local_root", hexHash(r.LocalRoot)), slog.Any("remote_root", hexHash(r.RemoteRoot)))...)
+	}
+	if !s.send(r) {
+		s.closed = true
+		return false
+	}
+	return true
+}
+
+// differTask is one unit of parallel diff work: a pair of aligned subtrees to walk,
+// or ranges the planning walk already found between two such pairs.
+type differTask struct {
+	n1, n2 *Node
+	ranges []DiffRange
+	done   chan struct{}
+}
+
+// stream runs the traversal in the background. With concurrency, a planning walk
+// first descends the differing paths until aligned subtree pairs are small enough
+// to share out; workers then walk those pairs while the emitter drains their
+// results in order.
+func (d Differ) stream(ctx context.Context, s1, s2 diffSide, budget *diffBudget) (<-chan DiffRange, <-chan error) {
+	workers := max(d.Concurrency, 1)
+	out := make(chan DiffRange, workers)
+	errc := make(chan error, 1)
+
+	ctx, done := d.trace(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	var sent int
+	send := func(r DiffRange) bool {
+		select {
+		case out <- r:
+			sent++
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	finish := func(sink *rangeSink, failErr *error) {
+		if ctx.Err() == nil {
+			sink.flush()
+		}
+		close(out)
+		var err error
+		switch {
+		case *failErr != nil:
+			err = *failErr
+		case ctx.Err() != nil && !sink.stopped:
+			err = ctx.Err()
+		}
+		done(budget, sent, err)
+		if err != nil {
+			errc <- err
+		}
+		cancel()
+		close(errc)
+	}
+
+	// fail records the first walk error and stops the diff.
+	var failOnce sync.Once
+	var failErr error
+	fail := func(err error) {
+		failOnce.Do(func() { failErr = err })
+		cancel()
+	}
+
+	if !d.parallel() {
+		go func() {
+			sink := d.sink(budget, send)
+			defer finish(sink, &failErr)
+			if err := d.walker(ctx, budget, s1, s2).walk(s1.forest, s2.forest, sink.add); err != nil {
+				fail(err)
+			}
+		}()
+		return out, errc
+	}
+
+	tasks, err := d.plan(ctx, s1, s2, budget, workers*4)
+	if err != nil {
+		fail(err)
+		tasks = nil
+	}
+
+	jobs := make(chan *differTask)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				// The planning walk already compared the pair itself.
+				w := d.walker(ctx, budget, s1, s2)
+				f1, err1 := w.push(0, nil, t.n1)
+				f2, err2 := w.push(1, nil, t.n2)
+				err := errors.Join(err1, err2)
+				if err == nil {
+					err = w.walk(reverseForest(f1), reverseForest(f2), func(r DiffRange) bool {
+						t.ranges = append(t.ranges, r)
+						return true
+					})
+				}
+				if err != nil {
+					fail(err)
+				}
+				close(t.done)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, t := range tasks {
+			if t.done == nil {
+				continue
+			}
+			select {
+			case jobs <- t:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		sink := d.sink(budget, send)
+		defer func() {
+			wg.Wait()
+			finish(sink, &failErr)
+		}()
+		for _, t := range tasks {
+			if ctx.Err() != nil {
+				return
+			}
+			if t.done != nil {
+				select {
+				case <-t.done:
+				case <-ctx.Done():
+					return
+				}
+			}
+			for _, r := range t.ranges {
+				if !sink.add(r) {
+					if sink.stopped {
+						cancel()
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	return out, errc
+}
+
+// plan walks the differing paths of the two forests down to aligned subtree pairs
+// covering at most 1/want of the compared span, and returns the work in height
+// order: subtree pairs for the workers, interleaved with the ranges found on the way.
+func (d Differ) plan(ctx context.Context, s1, s2 diffSide, budget *diffBudget, want int) ([]*differTask, error) {
+	var span uint64
+	for _, f := range [][]*Node{s1.forest, s2.forest} {
+		for _, n := range f {
+			span += uint64(n.Metadata.Count)
+		}
+	}
+	grain := max(span/uint64(2*want), 1)
+
+	var tasks []*differTask
+	var found *differTask
+	w := d.walker(ctx, budget, s1, s2)
+	w.split = func(n1, n2 *Node) bool {
+		if uint64(n1.Metadata.Count) > grain {
+			return false
+		}
+		tasks = append(tasks, &differTask{n1: n1, n2: n2, done: make(chan struct{})})
+		found = nil
+		return true
+	}
+	err := w.walk(s1.forest, s2.forest, func(r DiffRange) bool {
+		if found == nil {
+			found = &differTask{}
+			tasks = append(tasks, found)
+		}
+		found.ranges = append(found.ranges, r)
+		return true
+	})
+	return tasks, err
+}
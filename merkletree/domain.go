@@ -0,0 +1,64 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// tagDomain starts the prefix written into every digest of a tree with a
+// Config.Domain: H(tagDomain||len(domain)||domain||...).
+const tagDomain = byte(0x40)
+
+// ErrDomainMismatch is returned when a snapshot, proof, checkpoint or peer tree
+// belongs to a different domain than the builder it is used with.
+var ErrDomainMismatch = errors.New("domain mismatch")
+
+// DomainHashFactory returns hf (nil for the default hash function) with domain
+// mixed into every digest it computes, as NewBuilder does for Config.Domain. An
+// empty domain returns hf unchanged, so trees without a domain keep their roots.
+//
+// Use it to hash outside a Builder, e.g. with InnerMerkleForRange or
+// ComputeChunkDigest. APIs that take a HashFactory next to data recording its
+// domain (snapshots, proofs) expect the plain factory and apply the domain
+// themselves.
+func DomainHashFactory(hf HashFactory, domain []byte) HashFactory {
+	if hf == nil {
+		hf = func() hash.Hash { return DefaultHashFactory() }
+	}
+	if len(domain) == 0 {
+		return hf
+	}
+	prefix := make([]byte, 0, 1+4+len(domain))
+	prefix = append(prefix, tagDomain)
+	prefix = append(prefix, byte(len(domain)), byte(len(domain)>>8), byte(len(domain)>>16), byte(len(domain)>>24))
+	prefix = append(prefix, domain...)
+	return func() hash.Hash {
+		h := &domainHash{Hash: hf(), prefix: prefix}
+		h.Hash.Write(prefix)
+		return h
+	}
+}
+
+// domainHash writes its prefix again whenever it is reset.
+type domainHash struct {
+	hash.Hash
+	prefix []byte
+}
+
+func (h *domainHash) Reset() {
+	h.Hash.Reset()
+	h.Hash.Write(h.prefix)
+}
+
+// Domain returns a copy of the builder's Config.Domain (nil if unset).
+func (b *Builder) Domain() []byte { return bytes.Clone(b.cfg.Domain) }
+
+// checkDomain returns ErrDomainMismatch, naming what, if got is not want.
+func checkDomain(what string, got, want []byte) error {
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("%s domain %q != %q: %w", what, got, want, ErrDomainMismatch)
+	}
+	return nil
+}
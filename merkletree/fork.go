@@ -0,0 +1,41 @@
+package merkletree
+
+// Fork returns an independent Builder that starts from the current state of b.
+//
+// Committed outer nodes are immutable once merged, so the fork shares them
+// structurally with b instead of copying the tree. Only the peak slice and the
+// partial chunk buffer are copied, which makes Fork O(log #chunks + blockMerge).
+//
+// Pushing to (or finalizing) either builder afterwards never affects the other,
+// so a fork can be used to speculatively apply a candidate branch, compare
+// roots, and then simply be dropped. The fork has no Observer.
+func (b *Builder) Fork() *Builder {
+	f := &Builder{
+		cfg:                b.cfg,
+		hf:                 b.hf,
+		expectedNextHeight: b.expectedNextHeight,
+		enforceHeights:     b.enforceHeights,
+		inChunkElems:       make([]Hash32, len(b.inChunkElems), b.cfg.BlockMerge),
+		inChunkStart:       b.inChunkStart,
+		outer:              b.outer.fork(),
+		totalBlocks:        b.totalBlocks,
+		gaps:               b.gaps,
+	}
+	f.cfg.Observer = nil
+	copy(f.inChunkElems, b.inChunkElems)
+	return f
+}
+
+// fork copies the peak slots while sharing the (immutable) nodes they point to.
+func (a *peaksAccumulator) fork() peaksAccumulator {
+	f := peaksAccumulator{
+		hf:        a.hf,
+		combiner:  a.combiner,
+		leafCount: a.leafCount,
+	}
+	if a.peaks != nil {
+		f.peaks = make([]*Node, len(a.peaks))
+		copy(f.peaks, a.peaks)
+	}
+	return f
+}
@@ -0,0 +1,125 @@
+package merkletree
+
+import (
+	"fmt"
+	"hash"
+	"math"
+)
+
+// GapDigest returns the root of a gap leaf covering [start, start+count), hashing
+// with hf (nil for the default hash function).
+func GapDigest(hf HashFactory, start uint64, count uint32) Hash32 {
+	if hf == nil {
+		hf = func() hash.Hash { return DefaultHashFactory() }
+	}
+	return gapDigest(hf, start, count)
+}
+
+func gapDigest(hf HashFactory, start uint64, count uint32) Hash32 {
+	h := hf()
+	h.Write([]byte{tagGap})
+	writeU64ToHash(h, start)
+	writeU32ToHash(h, count)
+	return sumTo32(h)
+}
+
+func newGapLeaf(hf HashFactory, start uint64, count uint32) *Node {
+	root := gapDigest(hf, start, count)
+	return &Node{
+		Root:     root,
+		Metadata: Metadata{Start: start, Count: count},
+		Data:     root,
+		HasData:  true,
+		Gap:      true,
+	}
+}
+
+// PushSparse ingests blocks at strictly increasing, possibly non-contiguous
+// heights. It requires Config.AllowGaps: every skipped range, including one
+// between the previous batch and heights[0], is committed as a gap leaf. The
+// resulting tree depends only on the heights and hashes pushed, not on how they
+// were split into batches.
+func (b *Builder) PushSparse(heights []uint64, blockHashes []Hash32) (accepted int, err error) {
+	if !b.cfg.AllowGaps {
+		return 0, fmt.Errorf("PushSparse requires Config.AllowGaps")
+	}
+	if len(heights) != len(blockHashes) {
+		return 0, fmt.Errorf("%d heights for %d block hashes", len(heights), len(blockHashes))
+	}
+	for i := 1; i < len(heights); i++ {
+		if heights[i] <= heights[i-1] {
+			return 0, fmt.Errorf("height %d at index %d does not follow %d", heights[i], i, heights[i-1])
+		}
+	}
+
+	// Push each contiguous run; Push commits the gap before it.
+	for i := 0; i < len(heights); {
+		j := i + 1
+		for j < len(heights) && heights[j] == heights[j-1]+1 {
+			j++
+		}
+		n, err := b.Push(heights[i], blockHashes[i:j])
+		accepted += n
+		if err != nil {
+			return accepted, err
+		}
+		i = j
+	}
+	return accepted, nil
+}
+
+// nextHeight returns the height the next block must have to extend the tree
+// without a gap, or false if the tree is empty and does not enforce heights.
+func (b *Builder) nextHeight() (uint64, bool) {
+	switch {
+	case b.enforceHeights:
+		return b.expectedNextHeight, true
+	case len(b.inChunkElems) > 0:
+		return b.inChunkStart + uint64(len(b.inChunkElems)), true
+	}
+	for _, p := range b.outer.peaks {
+		if p != nil {
+			return p.Metadata.Start + uint64(p.Metadata.Count), true
+		}
+	}
+	return 0, false
+}
+
+// addGap closes the partial chunk and commits [start, start+count) as a gap leaf.
+//
+// Node counts are 32-bit and hashed into every outer node, so no tree, with or
+// without gaps, can span more than MaxUint32 heights; splitting a longer gap into
+// several leaves would only move the failure to the merge above them. A gap that
+// would take the tree past that span is rejected before anything is changed.
+func (b *Builder) addGap(start, count uint64) error {
+	from := start
+	if b.totalBlocks+b.gaps > 0 {
+		from = b.startHeight()
+	}
+	if span := start + count - from; count > math.MaxUint32 || span > math.MaxUint32 || span < count {
+		return fmt.Errorf("gap of %d heights at %d would make the tree span more than %d heights", count, start, uint32(math.MaxUint32))
+	}
+	if err := b.commitCurrentChunk(); err != nil {
+		return err
+	}
+	if err := b.commitLeaf(newGapLeaf(b.hf, start, uint32(count))); err != nil {
+		return err
+	}
+	b.gaps += count
+	if b.enforceHeights {
+		b.expectedNextHeight = start + count
+	}
+	return nil
+}
+
+// countGaps returns the number of heights covered by gap leaves.
+func (b *Builder) countGaps() uint64 {
+	var gaps uint64
+	b.walkLeaves(func(leaf *Node) bool {
+		if leaf.Gap {
+			gaps += uint64(leaf.Metadata.Count)
+		}
+		return true
+	})
+	return gaps
+}
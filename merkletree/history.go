@@ -0,0 +1,161 @@
+package merkletree
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// ErrElementsNotRetained is returned when an operation needs the per-block element
+// hashes of an already committed chunk, but the Builder was not configured with
+// Config.RetainElements (or the elements were lost through a binary snapshot).
+var ErrElementsNotRetained = errors.New("element hashes not retained")
+
+// RootAt returns the root the tree had when exactly n blocks had been pushed,
+// i.e. what Finalize() would have returned at that point.
+//
+// The committed prefix is assembled from retained outer nodes: the peaks of an
+// accumulator with k chunks are aligned subtrees that still exist in the current
+// tree, so no chunk is re-hashed. If n falls inside a chunk, that partial chunk is
+// recomputed from its element hashes: always possible for the current partial
+// buffer, and for committed chunks only with Config.RetainElements.
+//
+// RootAt does not modify the Builder.
+func (b *Builder) RootAt(n uint64) (Hash32, error) {
+	if n > b.totalBlocks {
+		return Hash32{}, fmt.Errorf("RootAt(%d) beyond total blocks %d", n, b.totalBlocks)
+	}
+	if n == 0 {
+		return Hash32{}, nil
+	}
+	if b.gaps > 0 {
+		return Hash32{}, fmt.Errorf("RootAt(%d): block counts do not map to heights in a tree with gaps", n)
+	}
+
+	target := b.startHeight() + n
+	k, leaf := b.outer.locate(target)
+
+	acc := newPeaksAccumulator(b.hf, outerNodeDigest)
+	acc.peaks = make([]*Node, bits.Len64(k))
+	var offset uint64
+	for level := len(acc.peaks) - 1; level >= 0; level-- {
+		if k&(1<<uint(level)) == 0 {
+			continue
+		}
+		p := b.outer.subtree(offset, level)
+		if p == nil {
+			return Hash32{}, fmt.Errorf("missing subtree at chunk %d level %d", offset, level)
+		}
+		acc.peaks[level] = p
+		offset += 1 << uint(level)
+	}
+	acc.leafCount = k
+
+	// Recompute the partial chunk covering [start, target), if any.
+	var start uint64
+	var elems []Hash32
+	switch {
+	case leaf != nil:
+		start, elems = leaf.Metadata.Start, leaf.Elems
+	case k == b.outer.leafCount && len(b.inChunkElems) > 0:
+		start, elems = b.inChunkStart, b.inChunkElems
+	default:
+		return acc.Root(), nil
+	}
+	r := target - start
+	if r == 0 {
+		return acc.Root(), nil
+	}
+	if uint64(len(elems)) < r {
+		return Hash32{}, fmt.Errorf("RootAt(%d): %w", n, ErrElementsNotRetained)
+	}
+	if err := acc.AddLeaf(newChunkLeaf(b.hf, start, elems[:r], false)); err != nil {
+		return Hash32{}, err
+	}
+
+	return acc.Root(), nil
+}
+
+// startHeight returns the height of the first block in the tree.
+func (b *Builder) startHeight() uint64 {
+	for i := len(b.outer.peaks) - 1; i >= 0; i-- {
+		if p := b.outer.peaks[i]; p != nil {
+			return p.Metadata.Start
+		}
+	}
+	return b.inChunkStart
+}
+
+// locate finds how many committed leaves end at or before height target.
+// If target falls strictly inside a committed leaf, that leaf is returned as well;
+// a nil leaf means target lies at or beyond the end of the committed leaves.
+func (a *peaksAccumulator) locate(target uint64) (uint64, *Node) {
+	var offset uint64
+	for level := len(a.peaks) - 1; level >= 0; level-- {
+		p := a.peaks[level]
+		if p == nil {
+			continue
+		}
+		if p.Metadata.Start+uint64(p.Metadata.Count) <= target {
+			offset += 1 << uint(level)
+			continue
+		}
+
+		// target is inside this peak: descend to the leaf containing it.
+		n, l := p, level
+		for !n.HasData && n.Left != nil && l > 0 {
+			left := n.Left
+			if left.Metadata.Start+uint64(left.Metadata.Count) <= target {
+				offset += 1 << uint(l-1)
+				n = n.Right
+			} else {
+				n = left
+			}
+			l--
+		}
+		if n.Metadata.Start >= target {
+			return offset, nil
+		}
+		return offset, n
+	}
+	return offset, nil
+}
+
+// subtree returns the node covering the 2^level leaves starting at leaf index offset,
+// or nil if no such aligned subtree exists in the accumulator.
+func (a *peaksAccumulator) subtree(offset uint64, level int) *Node {
+	var base uint64
+	for l := len(a.peaks) - 1; l >= 0; l-- {
+		p := a.peaks[l]
+		if p == nil {
+			continue
+		}
+		size := uint64(1) << uint(l)
+		if offset >= base+size {
+			base += size
+			continue
+		}
+		if l < level {
+			return nil
+		}
+
+		n := p
+		for ; l > level; l-- {
+			if n == nil {
+				return nil
+			}
+			half := uint64(1) << uint(l-1)
+			if offset < base+half {
+				n = n.Left
+			} else {
+				base += half
+				n = n.Right
+			}
+		}
+		if base != offset {
+			return nil
+		}
+		return n
+	}
+	return nil
+}
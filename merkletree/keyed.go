@@ -0,0 +1,401 @@
+package merkletree
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"sort"
+)
+
+// tagKeyedElem binds a key to its value hash: H(tagKeyedElem||len(key)||key||valueHash).
+const tagKeyedElem = byte(0x50)
+
+// keyedElemInput is the fixed part of a keyed element digest's input; the key and
+// value follow.
+const keyedElemInput = 1 + 4
+
+// tagKeyedBucket hashes the entries of one bucket, in key order:
+// H(tagKeyedBucket||elem1||...||elemN), each elem a keyed element hash.
+const tagKeyedBucket = byte(0x51)
+
+// KeyCodec describes an ordered key type: Encode gives the bytes committed into
+// the tree, and Compare orders keys (negative, zero or positive, as cmp.Compare).
+// For KeyedBuilder, the encoded bytes must sort lexically in key order. Size is
+// the length of every encoded key, or 0 if it varies.
+type KeyCodec[K any] struct {
+	Encode  func(K) []byte
+	Compare func(a, b K) int
+	Size    int
+}
+
+// StringKeys orders strings lexically and commits their bytes.
+func StringKeys() KeyCodec[string] {
+	return KeyCodec[string]{Encode: func(k string) []byte { return []byte(k) }, Compare: cmp.Compare[string]}
+}
+
+// Uint64Keys orders integers numerically and commits them big-endian.
+func Uint64Keys() KeyCodec[uint64] {
+	return KeyCodec[uint64]{Encode: func(k uint64) []byte { return binary.BigEndian.AppendUint64(nil, k) }, Compare: cmp.Compare[uint64], Size: 8}
+}
+
+// BytesKeys orders byte strings lexically (e.g. storage slots, object IDs).
+func BytesKeys() KeyCodec[[]byte] {
+	return KeyCodec[[]byte]{Encode: func(k []byte) []byte { return k }, Compare: bytes.Compare}
+}
+
+// KeyBounds is the smallest and largest key of a run of entries.
+type KeyBounds[K any] struct {
+	First K `json:"first"`
+	Last  K `json:"last"`
+}
+
+// KeyBuckets assigns encoded keys to buckets: a key's bucket is the Bytes bytes
+// (1 to 3) that follow its first Skip bytes, read big-endian, with bytes past the
+// end of the key read as zero. Skip drops a prefix all keys share, such as
+// "acct/" or the zero high bytes of small integers.
+//
+// A keyed tree has one leaf per BlockMerge buckets up to the last key's bucket,
+// chunks without keys included, so it costs O(buckets/BlockMerge) leaves however
+// few keys it holds. NewKeyedBuilder rejects buckets allowing more than
+// maxKeyedLeaves leaves.
+type KeyBuckets struct {
+	Skip  int
+	Bytes int
+}
+
+// maxKeyedLeaves bounds the leaves a keyed tree can have: 1<<24 three-byte
+// buckets need a BlockMerge of at least 16.
+const maxKeyedLeaves = 1 << 20
+
+func (kbk KeyBuckets) bucket(key []byte) uint64 {
+	var v uint64
+	for i := kbk.Skip; i < kbk.Skip+kbk.Bytes; i++ {
+		v <<= 8
+		if i < len(key) {
+			v |= uint64(key[i])
+		}
+	}
+	return v
+}
+
+// KeyedBuilder builds the same chunk/outer tree as Builder over a sorted, sparse
+// keyspace (accounts, storage slots, object IDs) instead of contiguous heights.
+//
+// Entries are pushed in strictly increasing key order and grouped into fixed key
+// ranges (KeyBuckets): position p of the tree holds the digest of the entries of
+// bucket p, and committing each key with its value, so two replicas have equal
+// roots exactly when they hold the same entries. Empty buckets in a chunk with
+// entries are zero, and every chunk without entries is a gap leaf of its own, so
+// a chunk's position depends only on the keys it may hold: a key present on one
+// side only changes that chunk, and diffs report just it. The tree spans every
+// chunk up to the last key's, so choose buckets that the keys fill densely.
+//
+// Diffs and bisects run on positions with the usual Differ and are mapped back to
+// key intervals through the first and last key kept for each chunk holding
+// entries (O(#chunks) keys of memory).
+//
+// Stats and Metrics count one element digest and one pushed block per entry;
+// empty buckets are not counted. Chunk commits, to Metrics and the Observer, are
+// those of the position tree, gap leaves included.
+type KeyedBuilder[K any] struct {
+	b       *Builder // every bucket before the open one
+	codec   KeyCodec[K]
+	buckets KeyBuckets
+	entries uint64
+	open    uint64    // bucket of the last entry pushed
+	openSum hash.Hash // digest of the open bucket so far; nil before the first entry
+	chunks  []keyedChunk[K]
+}
+
+// keyedChunk holds the key bounds of the chunk at position index*BlockMerge.
+type keyedChunk[K any] struct {
+	index uint64
+	KeyBounds[K]
+}
+
+// NewKeyedBuilder returns an empty keyed builder. cfg is used as for NewBuilder,
+// except that StartHeight is ignored (positions always start at 0) and AllowGaps
+// is set for the empty chunks. Two keyed trees are only comparable if they use
+// the same BlockMerge and buckets.
+//
+// The zero KeyBuckets picks the last three bytes of fixed-size keys (Uint64Keys:
+// one bucket per key below 1<<24); keys of varying length need explicit buckets.
+// Buckets reaching past the end of fixed-size keys, or allowing more than
+// maxKeyedLeaves leaves for cfg's BlockMerge, are rejected.
+func NewKeyedBuilder[K any](cfg Config, codec KeyCodec[K], buckets KeyBuckets) (*KeyedBuilder[K], error) {
+	if codec.Encode == nil || codec.Compare == nil {
+		return nil, fmt.Errorf("key codec needs Encode and Compare")
+	}
+	if buckets == (KeyBuckets{}) {
+		if codec.Size == 0 {
+			return nil, fmt.Errorf("keys of varying length need explicit key buckets")
+		}
+		buckets.Bytes = min(codec.Size, 3)
+		buckets.Skip = codec.Size - buckets.Bytes
+	}
+	if buckets.Skip < 0 || buckets.Bytes < 1 || buckets.Bytes > 3 {
+		return nil, fmt.Errorf("invalid key buckets %+v: need Skip >= 0 and 1 to 3 Bytes", buckets)
+	}
+	if codec.Size > 0 && buckets.Skip+buckets.Bytes > codec.Size {
+		return nil, fmt.Errorf("key buckets %+v reach past the end of %d-byte keys", buckets, codec.Size)
+	}
+	var zero uint64
+	cfg.StartHeight = &zero
+	cfg.AllowGaps = true
+	b, err := NewBuilder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	bm := uint64(b.cfg.BlockMerge)
+	if leaves := (uint64(1)<<(8*buckets.Bytes) + bm - 1) / bm; leaves > maxKeyedLeaves {
+		return nil, fmt.Errorf("key buckets %+v allow %d chunks of %d buckets, more than %d: raise BlockMerge or use fewer bucket bytes",
+			buckets, leaves, bm, maxKeyedLeaves)
+	}
+	return &KeyedBuilder[K]{b: b, codec: codec, buckets: buckets}, nil
+}
+
+// Len returns the number of entries pushed.
+func (kb *KeyedBuilder[K]) Len() uint64 { return kb.entries }
+
+// Push appends entries with values[i] the hash of the value stored at keys[i],
+// computed however the caller likes. Keys must be strictly increasing, also
+// across batches, and their buckets must not decrease (keys whose encoding is
+// not in key order, or that do not share the skipped prefix, break that); the
+// batch is rejected as a whole otherwise.
+func (kb *KeyedBuilder[K]) Push(keys []K, values []Hash32) (int, error) {
+	if len(keys) != len(values) {
+		return 0, fmt.Errorf("%d keys for %d values", len(keys), len(values))
+	}
+	encoded := make([][]byte, len(keys))
+	buckets := make([]uint64, len(keys))
+	for i, k := range keys {
+		encoded[i] = kb.codec.Encode(k)
+		buckets[i] = kb.buckets.bucket(encoded[i])
+		var prev K
+		var prevBucket uint64
+		switch {
+		case i > 0:
+			prev, prevBucket = keys[i-1], buckets[i-1]
+		case len(kb.chunks) > 0:
+			prev, prevBucket = kb.chunks[len(kb.chunks)-1].Last, kb.open
+		default:
+			continue
+		}
+		if kb.codec.Compare(prev, k) >= 0 {
+			return 0, fmt.Errorf("key %d is not greater than the previous key", i)
+		}
+		if buckets[i] < prevBucket {
+			return 0, fmt.Errorf("key %d is in bucket %d, before the previous key's bucket %d", i, buckets[i], prevBucket)
+		}
+	}
+
+	bm := uint64(kb.b.cfg.BlockMerge)
+	for i, k := range keys {
+		if kb.openSum == nil || buckets[i] != kb.open {
+			if kb.openSum != nil {
+				if err := placeBucket(kb.b, kb.open, sumTo32(kb.openSum)); err != nil {
+					return i, err
+				}
+			}
+			kb.open, kb.openSum = buckets[i], kb.b.hf()
+			kb.openSum.Write([]byte{tagKeyedBucket})
+			kb.b.hashing.BytesHashed++
+		}
+		elem := keyedElemHash(kb.b.hf, encoded[i], values[i])
+		kb.openSum.Write(elem[:])
+		kb.entries++
+		kb.b.hashing.ElementDigests++
+		kb.b.hashing.BytesHashed += keyedElemInput + uint64(len(encoded[i])) + 2*hashSize // and into the bucket digest
+
+		if n := len(kb.chunks); n > 0 && kb.chunks[n-1].index == buckets[i]/bm {
+			kb.chunks[n-1].Last = k
+		} else {
+			kb.chunks = append(kb.chunks, keyedChunk[K]{index: buckets[i] / bm, KeyBounds: KeyBounds[K]{First: k, Last: k}})
+		}
+	}
+	kb.b.cfg.Metrics.pushed(len(keys))
+	return len(keys), nil
+}
+
+// placeBucket appends the digest of bucket p to b, after the empty buckets since
+// the last one appended: zero hashes up to p within p's chunk and the end of the
+// previous chunk, and a gap leaf for each whole chunk in between. It bypasses
+// Push, whose counters and logs are for the caller's blocks.
+func placeBucket(b *Builder, p uint64, digest Hash32) error {
+	bm := uint64(b.cfg.BlockMerge)
+	next, _ := b.nextHeight()
+	for ; next < p; next++ {
+		if next%bm == 0 && p-next >= bm {
+			if err := b.addGap(next, bm); err != nil {
+				return err
+			}
+			next += bm - 1
+			continue
+		}
+		if err := b.appendBucket(next, Hash32{}); err != nil {
+			return err
+		}
+	}
+	return b.appendBucket(p, digest)
+}
+
+// appendBucket appends the element of a bucket digest at position p.
+func (b *Builder) appendBucket(p uint64, digest Hash32) error {
+	b.hashing.BytesHashed += elemDigestInput
+	return b.appendElem(p, elemDigest(b.hf, p, digest))
+}
+
+// keyedElemHash commits one entry into its bucket's digest.
+func keyedElemHash(hf HashFactory, key []byte, value Hash32) Hash32 {
+	h := hf()
+	h.Write([]byte{tagKeyedElem})
+	writeU32ToHash(h, uint32(len(key)))
+	h.Write(key)
+	h.Write(value[:])
+	return sumTo32(h)
+}
+
+// tree returns a fork of the position tree with the open bucket placed. Placing
+// it is not reported to kb's Metrics or Logger: it happens again on every call.
+func (kb *KeyedBuilder[K]) tree() (*Builder, error) {
+	b := kb.b.Fork()
+	if kb.openSum == nil {
+		return b, nil
+	}
+	cfg := b.cfg
+	b.cfg.Metrics, b.cfg.Logger, b.cfg.Tracer = nil, nil, nil
+	err := placeBucket(b, kb.open, sumTo32(kb.openSum))
+	b.cfg = cfg
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Root returns the root Finalize would return, without committing the partial
+// chunk (zero for an empty builder).
+func (kb *KeyedBuilder[K]) Root() (Hash32, error) {
+	b, err := kb.tree()
+	if err != nil {
+		return Hash32{}, err
+	}
+	n, err := b.RootView()
+	if err != nil || n == nil {
+		return Hash32{}, err
+	}
+	return n.Root, nil
+}
+
+// Tree returns a fork of the underlying position tree, for snapshots, stats,
+// proofs and the snapshot and remote diff tools. Map the ranges they report back
+// to keys with KeysAt.
+func (kb *KeyedBuilder[K]) Tree() (*Builder, error) { return kb.tree() }
+
+// KeysAt returns the first and last key kb holds in the chunks overlapping the
+// positions [start, start+count), or false if it holds none there. Ranges
+// reported by diffs are chunk aligned, so the bounds are those of the range.
+func (kb *KeyedBuilder[K]) KeysAt(start uint64, count uint32) (KeyBounds[K], bool) {
+	if count == 0 {
+		return KeyBounds[K]{}, false
+	}
+	bm := uint64(kb.b.cfg.BlockMerge)
+	lo, hi := start/bm, (start+uint64(count)-1)/bm
+	i := sort.Search(len(kb.chunks), func(i int) bool { return kb.chunks[i].index >= lo })
+	j := sort.Search(len(kb.chunks), func(j int) bool { return kb.chunks[j].index > hi })
+	if i >= j {
+		return KeyBounds[K]{}, false
+	}
+	return KeyBounds[K]{First: kb.chunks[i].First, Last: kb.chunks[j-1].Last}, true
+}
+
+// KeyedRange is a DiffRange with the keys each side holds in it; a side's keys
+// are nil when it has no entries there.
+type KeyedRange[K any] struct {
+	DiffRange
+	LocalKeys  *KeyBounds[K] `json:"local_keys,omitempty"`
+	RemoteKeys *KeyBounds[K] `json:"remote_keys,omitempty"`
+}
+
+// keyedRangeJSON is the JSON form of KeyedRange: the fields of DiffRange's JSON
+// followed by the keys. KeyedRange needs its own methods, since those it would
+// get from DiffRange drop the keys.
+type keyedRangeJSON[K any] struct {
+	diffRangeJSON
+	LocalKeys  *KeyBounds[K] `json:"local_keys,omitempty"`
+	RemoteKeys *KeyBounds[K] `json:"remote_keys,omitempty"`
+}
+
+// MarshalJSON encodes the range as DiffRange does, with the keys alongside.
+func (r KeyedRange[K]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(keyedRangeJSON[K]{r.DiffRange.toJSON(), r.LocalKeys, r.RemoteKeys})
+}
+
+// UnmarshalJSON decodes a range encoded by MarshalJSON.
+func (r *KeyedRange[K]) UnmarshalJSON(data []byte) error {
+	var j keyedRangeJSON[K]
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*r = KeyedRange[K]{j.diffRange(), j.LocalKeys, j.RemoteKeys}
+	return nil
+}
+
+// Diff compares kb against remote with d and maps the ranges to keys. Both
+// builders must use the same BlockMerge and KeyBuckets (ErrConfigMismatch
+// otherwise).
+func (kb *KeyedBuilder[K]) Diff(ctx context.Context, d Differ, remote *KeyedBuilder[K]) ([]KeyedRange[K], DiffResult, error) {
+	if kb.b.cfg.BlockMerge != remote.b.cfg.BlockMerge {
+		return nil, DiffResult{}, fmt.Errorf("blockMerge %d != %d: %w", kb.b.cfg.BlockMerge, remote.b.cfg.BlockMerge, ErrConfigMismatch)
+	}
+	if kb.buckets != remote.buckets {
+		return nil, DiffResult{}, fmt.Errorf("key buckets %+v != %+v: %w", kb.buckets, remote.buckets, ErrConfigMismatch)
+	}
+	local, err := kb.tree()
+	if err != nil {
+		return nil, DiffResult{}, err
+	}
+	other, err := remote.tree()
+	if err != nil {
+		return nil, DiffResult{}, err
+	}
+	res, err := d.Diff(ctx, local, other)
+	if err != nil {
+		return nil, res, err
+	}
+	out := make([]KeyedRange[K], len(res.Ranges))
+	for i, r := range res.Ranges {
+		out[i] = kb.keyed(r, remote)
+	}
+	return out, res, nil
+}
+
+// TreeDiff reports every differing range between kb and remote, as Builder.TreeDiff.
+func (kb *KeyedBuilder[K]) TreeDiff(remote *KeyedBuilder[K]) ([]KeyedRange[K], error) {
+	ranges, _, err := kb.Diff(context.Background(), Differ{}, remote)
+	return ranges, err
+}
+
+// Bisect returns the first range where kb and remote differ, or false if they hold
+// the same entries.
+func (kb *KeyedBuilder[K]) Bisect(remote *KeyedBuilder[K]) (KeyedRange[K], bool, error) {
+	ranges, _, err := kb.Diff(context.Background(), Differ{Strategy: DiffFirst}, remote)
+	if err != nil || len(ranges) == 0 {
+		return KeyedRange[K]{}, false, err
+	}
+	return ranges[0], true, nil
+}
+
+func (kb *KeyedBuilder[K]) keyed(r DiffRange, remote *KeyedBuilder[K]) KeyedRange[K] {
+	out := KeyedRange[K]{DiffRange: r}
+	if k, ok := kb.KeysAt(r.Start, r.Count); ok {
+		out.LocalKeys = &k
+	}
+	if k, ok := remote.KeysAt(r.Start, r.Count); ok {
+		out.RemoteKeys = &k
+	}
+	return out
+}
@@ -20,14 +20,17 @@ package merkletree
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"hash"
+	"log/slog"
 	"math"
 	"os"
+	"time"
 )
 
 type Hash32 [32]byte
@@ -39,10 +42,18 @@ const (
 	tagElem       = byte(0x21) // per-block element inside chunk digest: H(tagElem||height||blockHash)
 	tagChunk      = byte(0x10) // chunk digest: H(tagChunk||start||count||elem1||...||elemK)
 	tagOuterNode  = byte(0x11) // outer internal node: H(tagOuterNode||start||count||left||right)
+	tagGap        = byte(0x12) // gap leaf (Config.AllowGaps): H(tagGap||start||count)
 	tagInnerLeaf  = byte(0x30) // on-demand inner merkle leaf: H(tagInnerLeaf||height||blockHash)
 	tagInnerNode  = byte(0x31) // on-demand inner merkle node: H(tagInnerNode||start||count||left||right)
 	tagChunkMerk  = byte(0x32) // optional wrapper: H(tagChunkMerk||start||count||innerRoot)
 	tagSnapshotV1 = byte(0xA1) // snapshot format version
+	tagSnapshotV2 = byte(0xA2) // snapshot format version with a domain: v1 header fields follow the domain
+)
+
+// Bits of the snapshot flags byte, which follows BlockMerge.
+const (
+	snapshotEnforceHeights = byte(0x01) // the expected next height follows
+	snapshotAllowGaps      = byte(0x02) // Config.AllowGaps
 )
 
 // HashFactory returns a new streaming hasher. Use SHA-256 by default.
@@ -55,8 +66,35 @@ type Config struct {
 	BlockMerge    int
 	ExpectedTotal uint64 // Hint for calculating BlockMerge
 	HashFactory   HashFactory
+	// Optional: a chain ID or namespace mixed into every digest (see
+	// DomainHashFactory), so identical block hashes from different domains produce
+	// different roots. It is recorded in snapshots, proofs and checkpoints; restores
+	// and diffs across domains fail with ErrDomainMismatch. Empty leaves roots as
+	// they were before domains existed.
+	Domain []byte
 	// Optional: if set, Builder enforces contiguous heights starting at StartHeight.
 	StartHeight *uint64
+	// Optional: if true, committed chunk leaves keep their per-block element hashes
+	// (Node.Elems). Costs 32 bytes per block, but allows RootAt to answer for heights
+	// inside already committed chunks.
+	RetainElements bool
+	// Optional: if true, Push and PushSparse accept heights that skip ahead. Each
+	// skipped range is committed as a gap leaf (Node.Gap) bound to its range, after
+	// closing the partial chunk, so trees over sparse height sets can be built,
+	// proven and diffed; gaps show up as DiffGap in diffs. Heights must still
+	// increase.
+	AllowGaps bool
+	// Optional: receives chunk commits, peak merges, finalized roots and restores.
+	Observer Observer
+	// Optional: receives debug records for push batches, chunk commits, snapshots
+	// and restores, and is the default logger of diffs against this builder.
+	Logger *slog.Logger
+	// Optional: traces Push, Snapshot and Restore, and is the default tracer of
+	// diffs against this builder.
+	Tracer Tracer
+	// Optional: collects pushes, commits, hashes, snapshot sizes and restore
+	// durations, and is the default collector of diffs against this builder.
+	Metrics *Metrics
 }
 
 type Metadata struct {
@@ -71,10 +109,13 @@ type Node struct {
 	Metadata Metadata // range-tag
 	Data     Hash32   // leaf payload hash (for leaves); zero for internal nodes
 	HasData  bool     // true for leaves
+	Elems    []Hash32 // per-block element hashes of a chunk leaf; only set with Config.RetainElements
+	Gap      bool     // leaf covering heights without blocks (Config.AllowGaps)
 }
 
 type Builder struct {
 	cfg Config
+	hf  HashFactory // cfg.HashFactory with cfg.Domain mixed in
 
 	// expectedNextHeight is the next height Builder expects in Push (if StartHeight provided).
 	expectedNextHeight uint64
@@ -88,6 +129,10 @@ type Builder struct {
 	outer peaksAccumulator
 
 	totalBlocks uint64
+	gaps        uint64 // heights covered by gap leaves (Config.AllowGaps)
+
+	// hashing counts the digests computed by Push and chunk commits (see Stats).
+	hashing HashStats
 }
 
 func NewBuilder(cfg Config) (*Builder, error) {
@@ -101,11 +146,13 @@ func NewBuilder(cfg Config) (*Builder, error) {
 	if cfg.HashFactory == nil {
 		cfg.HashFactory = func() hash.Hash { return DefaultHashFactory() }
 	}
+	cfg.Domain = bytes.Clone(cfg.Domain)
 	b := &Builder{
 		cfg:          cfg,
+		hf:           DomainHashFactory(cfg.HashFactory, cfg.Domain),
 		inChunkElems: make([]Hash32, 0, cfg.BlockMerge),
-		outer:        newPeaksAccumulator(cfg.HashFactory, outerNodeDigest),
 	}
+	b.outer = b.newOuter()
 	if cfg.StartHeight != nil {
 		b.enforceHeights = true
 		b.expectedNextHeight = *cfg.StartHeight
@@ -133,11 +180,50 @@ func (b *Builder) State() State {
 // If cfg.StartHeight was provided, Push enforces that hashes correspond to consecutive heights.
 //
 // If you enforce heights, pass startHeight for this batch; otherwise pass anything (ignored).
-func (b *Builder) Push(startHeight uint64, blockHashes []Hash32) (int, error) {
+func (b *Builder) Push(startHeight uint64, blockHashes []Hash32) (accepted int, err error) {
 	if len(blockHashes) == 0 {
 		return 0, nil
 	}
 
+	began := time.Now()
+	if b.cfg.Tracer == nil && debugLogger(context.Background(), b.cfg.Logger) == nil {
+		// Untraced fast path: no span or log attributes are built.
+		accepted, err = b.push(startHeight, blockHashes)
+		b.hashing.PushTime += time.Since(began)
+		b.cfg.Metrics.pushed(accepted)
+		return accepted, err
+	}
+
+	ctx, span := startSpan(context.Background(), b.cfg.Tracer, "merkletree.Push", rangeAttrs(startHeight, uint32(len(blockHashes)))...)
+	accepted, err = b.push(startHeight, blockHashes)
+	elapsed := time.Since(began)
+	b.hashing.PushTime += elapsed
+	b.cfg.Metrics.pushed(accepted)
+	span.SetAttributes(slog.Int("accepted", accepted))
+	endSpan(span, err)
+	if l := debugLogger(ctx, b.cfg.Logger); l != nil {
+		attrs := append(rangeAttrs(startHeight, uint32(len(blockHashes))),
+			slog.Int("accepted", accepted), slog.Duration("elapsed", elapsed))
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+		}
+		l.LogAttrs(ctx, slog.LevelDebug, "push batch", attrs...)
+	}
+	return accepted, err
+}
+
+// push is Push without the timing, tracing and logging around it.
+func (b *Builder) push(startHeight uint64, blockHashes []Hash32) (accepted int, err error) {
+	if b.cfg.AllowGaps {
+		if next, ok := b.nextHeight(); ok && startHeight != next {
+			if startHeight < next {
+				return 0, fmt.Errorf("height %d goes back, next height is %d", startHeight, next)
+			}
+			if err := b.addGap(next, startHeight-next); err != nil {
+				return 0, err
+			}
+		}
+	}
 	if b.enforceHeights {
 		// Ensure the batch starts where we expect.
 		if startHeight != b.expectedNextHeight {
@@ -145,7 +231,6 @@ func (b *Builder) Push(startHeight uint64, blockHashes []Hash32) (int, error) {
 		}
 	}
 
-	accepted := 0
 	for i := 0; i < len(blockHashes); i++ {
 		h := blockHashes[i]
 
@@ -158,38 +243,46 @@ func (b *Builder) Push(startHeight uint64, blockHashes []Hash32) (int, error) {
 			height = startHeight + uint64(i)
 		}
 
-		// If starting a fresh chunk, lock in the chunk start height.
-		if len(b.inChunkElems) == 0 {
-			b.inChunkStart = height
-		} else {
-			// Contiguity inside a chunk is assumed; if enforcing, it's guaranteed.
-			// If not enforcing, we do a best-effort check:
-			expected := b.inChunkStart + uint64(len(b.inChunkElems))
-			if height != expected {
-				return accepted, fmt.Errorf("non-contiguous height inside chunk: got %d want %d", height, expected)
-			}
-		}
-
 		// Compute per-block element hash with metadata binding (height).
-		elem := elemDigest(b.cfg.HashFactory, height, h)
-		b.inChunkElems = append(b.inChunkElems, elem)
-
-		b.totalBlocks++
+		elem := elemDigest(b.hf, height, h)
+		b.hashing.ElementDigests++
+		b.hashing.BytesHashed += elemDigestInput
+		if err := b.appendElem(height, elem); err != nil {
+			return accepted, err
+		}
 		accepted++
+	}
 
-		if b.enforceHeights {
-			b.expectedNextHeight++
-		}
+	return accepted, nil
+}
 
-		// If chunk complete, commit it to the outer accumulator.
-		if len(b.inChunkElems) == b.cfg.BlockMerge {
-			if err := b.commitCurrentChunk(); err != nil {
-				return accepted, err
-			}
+// appendElem adds one element hash at the given height to the partial chunk,
+// committing the chunk once it reaches blockMerge elements.
+func (b *Builder) appendElem(height uint64, elem Hash32) error {
+	// If starting a fresh chunk, lock in the chunk start height.
+	if len(b.inChunkElems) == 0 {
+		b.inChunkStart = height
+	} else {
+		// Contiguity inside a chunk is assumed; if enforcing, it's guaranteed.
+		// If not enforcing, we do a best-effort check:
+		expected := b.inChunkStart + uint64(len(b.inChunkElems))
+		if height != expected {
+			return fmt.Errorf("non-contiguous height inside chunk: got %d want %d", height, expected)
 		}
 	}
 
-	return accepted, nil
+	b.inChunkElems = append(b.inChunkElems, elem)
+	b.totalBlocks++
+
+	if b.enforceHeights {
+		b.expectedNextHeight++
+	}
+
+	// If chunk complete, commit it to the outer accumulator.
+	if len(b.inChunkElems) == b.cfg.BlockMerge {
+		return b.commitCurrentChunk()
+	}
+	return nil
 }
 
 // Finalize commits any partial chunk (if present) and returns the global root.
@@ -201,7 +294,11 @@ func (b *Builder) Finalize() (Hash32, error) {
 			return Hash32{}, err
 		}
 	}
-	return b.outer.Root(), nil
+	root := b.outer.Root()
+	if b.cfg.Observer != nil {
+		b.cfg.Observer.OnFinalize(root)
+	}
+	return root, nil
 }
 
 // RootNode returns the single root Node of the entire tree.
@@ -220,13 +317,56 @@ func (b *Builder) commitCurrentChunk() error {
 		return nil
 	}
 
-	start := b.inChunkStart
-	count := uint32(len(b.inChunkElems))
+	leaf := newChunkLeaf(b.hf, b.inChunkStart, b.inChunkElems, b.cfg.RetainElements)
+	if err := b.commitLeaf(leaf); err != nil {
+		return err
+	}
+
+	// Reset partial chunk buffer.
+	b.inChunkElems = b.inChunkElems[:0]
+	b.inChunkStart = 0
+	return nil
+}
+
+// commitLeaf adds a chunk or gap leaf to the outer accumulator and reports it.
+func (b *Builder) commitLeaf(leaf *Node) error {
+	var merges uint64
+	if leaf.Gap {
+		merges = b.hashing.countGapDigests(b.outer.leafCount)
+	} else {
+		merges = b.hashing.countDigests(b.outer.leafCount)
+	}
+	if err := b.outer.AddLeaf(leaf); err != nil {
+		return err
+	}
+	if leaf.Gap {
+		b.cfg.Metrics.gapCommitted(merges)
+	} else {
+		b.cfg.Metrics.committed(merges)
+	}
+	if b.cfg.Observer != nil {
+		b.cfg.Observer.OnChunkCommitted(leaf.Metadata.Start, leaf.Metadata.Count, leaf.Root)
+	}
+	if l := debugLogger(context.Background(), b.cfg.Logger); l != nil {
+		msg := "chunk committed"
+		if leaf.Gap {
+			msg = "gap committed"
+		}
+		l.LogAttrs(context.Background(), slog.LevelDebug, msg,
+			append(rangeAttrs(leaf.Metadata.Start, leaf.Metadata.Count), slog.Any("digest", hexHash(leaf.Root)))...)
+	}
+	return nil
+}
+
+// newChunkLeaf builds the outer leaf for a chunk (full or partial) from its element hashes.
+// If retain is set, the leaf keeps its own copy of the element hashes.
+func newChunkLeaf(hf HashFactory, start uint64, elems []Hash32, retain bool) *Node {
+	count := uint32(len(elems))
 
 	// Direct chunk digest, tagged with range metadata.
-	chunk := chunkDigest(b.cfg.HashFactory, start, count, b.inChunkElems)
+	chunk := chunkDigest(hf, start, count, elems)
 
-	// Add to outer accumulator as a leaf node with explicit range.
+	// Leaf node with explicit range.
 	leaf := &Node{
 		Root: chunk,
 		Metadata: Metadata{
@@ -236,21 +376,40 @@ func (b *Builder) commitCurrentChunk() error {
 		Data:    chunk,
 		HasData: true,
 	}
-
-	if err := b.outer.AddLeaf(leaf); err != nil {
-		return err
+	if retain {
+		leaf.Elems = make([]Hash32, len(elems))
+		copy(leaf.Elems, elems)
 	}
-
-	// Reset partial chunk buffer.
-	b.inChunkElems = b.inChunkElems[:0]
-	b.inChunkStart = 0
-	return nil
+	return leaf
 }
 
 // Snapshot serializes builder state so you can persist it to your WAL.
+// Retained element hashes (Config.RetainElements) are not part of the binary format.
 func (b *Builder) Snapshot() ([]byte, error) {
+	ctx, span := startSpan(context.Background(), b.cfg.Tracer, "merkletree.Snapshot")
+	data, err := b.snapshot()
+	span.SetAttributes(slog.Int("bytes", len(data)))
+	endSpan(span, err)
+	if err == nil {
+		b.cfg.Metrics.snapshotTaken(len(data))
+	}
+	if l := debugLogger(ctx, b.cfg.Logger); l != nil {
+		l.LogAttrs(ctx, slog.LevelDebug, "snapshot", slog.Uint64("total_blocks", b.totalBlocks), slog.Int("bytes", len(data)))
+	}
+	return data, err
+}
+
+func (b *Builder) snapshot() ([]byte, error) {
 	var buf bytes.Buffer
-	buf.WriteByte(tagSnapshotV1)
+	if len(b.cfg.Domain) == 0 {
+		buf.WriteByte(tagSnapshotV1)
+	} else {
+		buf.WriteByte(tagSnapshotV2)
+		if err := writeU32(&buf, uint32(len(b.cfg.Domain))); err != nil {
+			return nil, err
+		}
+		buf.Write(b.cfg.Domain)
+	}
 
 	// Config fields that affect hashing/determinism
 	if err := writeU32(&buf, uint32(b.cfg.BlockMerge)); err != nil {
@@ -260,14 +419,19 @@ func (b *Builder) Snapshot() ([]byte, error) {
 	// But BlockMerge is the critical derived value.
 	// We do NOT serialize HashFactory; caller must restore with same config.
 
-	// Height enforcement
+	// Flags: height enforcement, gaps
+	var flags byte
+	if b.enforceHeights {
+		flags |= snapshotEnforceHeights
+	}
+	if b.cfg.AllowGaps {
+		flags |= snapshotAllowGaps
+	}
+	buf.WriteByte(flags)
 	if b.enforceHeights {
-		buf.WriteByte(1)
 		if err := writeU64(&buf, b.expectedNextHeight); err != nil {
 			return nil, err
 		}
-	} else {
-		buf.WriteByte(0)
 	}
 
 	// Totals
@@ -296,16 +460,56 @@ func (b *Builder) Snapshot() ([]byte, error) {
 
 // Restore loads a snapshot previously produced by Snapshot().
 // Caller must create Builder with the same Config (blockMerge + hash function).
+// Config.AllowGaps is taken from the snapshot if it was set there.
 func (b *Builder) Restore(snapshot []byte) error {
+	began := time.Now()
+	ctx, span := startSpan(context.Background(), b.cfg.Tracer, "merkletree.Restore", slog.Int("bytes", len(snapshot)))
+	err := b.restore(snapshot)
+	endSpan(span, err)
+	if err == nil {
+		b.cfg.Metrics.restored(time.Since(began))
+	}
+	if l := debugLogger(ctx, b.cfg.Logger); l != nil {
+		attrs := []slog.Attr{slog.Int("bytes", len(snapshot)), slog.Uint64("total_blocks", b.totalBlocks)}
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+		}
+		l.LogAttrs(ctx, slog.LevelDebug, "restore", attrs...)
+	}
+	if err == nil && b.cfg.Observer != nil {
+		b.cfg.Observer.OnRestore(b.State())
+	}
+	return err
+}
+
+func (b *Builder) restore(snapshot []byte) error {
 	r := bytes.NewReader(snapshot)
 
 	v, err := r.ReadByte()
 	if err != nil {
 		return err
 	}
-	if v != tagSnapshotV1 {
+	var domain []byte
+	switch v {
+	case tagSnapshotV1:
+	case tagSnapshotV2:
+		n, err := readU32(r)
+		if err != nil {
+			return err
+		}
+		if int64(n) > int64(r.Len()) {
+			return fmt.Errorf("snapshot domain length %d exceeds snapshot", n)
+		}
+		domain = make([]byte, n)
+		if _, err := r.Read(domain); err != nil {
+			return err
+		}
+	default:
 		return fmt.Errorf("unsupported snapshot version: %x", v)
 	}
+	if err := checkDomain("snapshot", domain, b.cfg.Domain); err != nil {
+		return err
+	}
 
 	blockMerge, err := readU32(r)
 	if err != nil {
@@ -318,18 +522,22 @@ func (b *Builder) Restore(snapshot []byte) error {
 		return fmt.Errorf("snapshot blockMerge %d != builder blockMerge %d", blockMerge, b.cfg.BlockMerge)
 	}
 
-	enf, err := r.ReadByte()
+	flags, err := r.ReadByte()
 	if err != nil {
 		return err
 	}
-	if enf == 1 {
-		b.enforceHeights = true
+	if flags&^(snapshotEnforceHeights|snapshotAllowGaps) != 0 {
+		return fmt.Errorf("unknown snapshot flags %#x: %w", flags, ErrMalformedSnapshot)
+	}
+	b.enforceHeights = flags&snapshotEnforceHeights != 0
+	if b.enforceHeights {
 		b.expectedNextHeight, err = readU64(r)
 		if err != nil {
 			return err
 		}
-	} else {
-		b.enforceHeights = false
+	}
+	if flags&snapshotAllowGaps != 0 {
+		b.cfg.AllowGaps = true
 	}
 
 	b.totalBlocks, err = readU64(r)
@@ -361,11 +569,15 @@ func (b *Builder) Restore(snapshot []byte) error {
 	}
 
 	// Outer peaks
-	b.outer = newPeaksAccumulator(b.cfg.HashFactory, outerNodeDigest)
+	b.outer = b.newOuter()
 	if err := b.outer.Decode(r); err != nil {
 		return err
 	}
-
+	b.gaps = b.countGaps()
+	if b.gaps > 0 && !b.cfg.AllowGaps {
+		return fmt.Errorf("snapshot has gap leaves but does not allow gaps: %w", ErrMalformedSnapshot)
+	}
+	b.hashing = HashStats{}
 	return nil
 }
 
@@ -510,6 +722,9 @@ type peaksAccumulator struct {
 	combiner  nodeCombiner
 	peaks     []*Node
 	leafCount uint64 // number of leaves added
+
+	// onMerge, if set, is called with every node created by AddLeaf and its level.
+	onMerge func(level int, n *Node)
 }
 
 func newPeaksAccumulator(hf HashFactory, combiner nodeCombiner) peaksAccumulator {
@@ -517,20 +732,25 @@ func newPeaksAccumulator(hf HashFactory, combiner nodeCombiner) peaksAccumulator
 }
 
 func (a *peaksAccumulator) AddLeaf(leaf *Node) error {
-	if leaf == nil {
+	return a.addSubtree(leaf, 0)
+}
+
+// addSubtree adds a complete subtree of 2^level leaves; leafCount must be a
+// multiple of 2^level, so that no lower peak is pending.
+func (a *peaksAccumulator) addSubtree(n *Node, level int) error {
+	if n == nil {
 		return errors.New("nil leaf")
 	}
-	carry := leaf
-	level := 0
+	carry, added := n, uint64(1)<<uint(level)
 
 	for {
 		// Extend peaks slice if needed.
-		if level >= len(a.peaks) {
+		for level >= len(a.peaks) {
 			a.peaks = append(a.peaks, nil)
 		}
 		if a.peaks[level] == nil {
 			a.peaks[level] = carry
-			a.leafCount++
+			a.leafCount += added
 			return nil
 		}
 
@@ -546,6 +766,9 @@ func (a *peaksAccumulator) AddLeaf(leaf *Node) error {
 			)
 		}
 
+		if uint64(left.Metadata.Count)+uint64(right.Metadata.Count) > math.MaxUint32 {
+			return fmt.Errorf("combine at level %d covers more than %d heights", level, uint32(math.MaxUint32))
+		}
 		parentStart := left.Metadata.Start
 		parentCount := left.Metadata.Count + right.Metadata.Count
 		parentRoot := a.combiner(a.hf, parentStart, parentCount, left.Root, right.Root)
@@ -565,6 +788,9 @@ func (a *peaksAccumulator) AddLeaf(leaf *Node) error {
 		a.peaks[level] = nil
 		carry = parent
 		level++
+		if a.onMerge != nil {
+			a.onMerge(level, parent)
+		}
 	}
 }
 
@@ -589,6 +815,9 @@ func (a *peaksAccumulator) RootNode() *Node {
 			// Return nil to avoid false confidence.
 			return nil
 		}
+		if uint64(root.Metadata.Count)+uint64(p.Metadata.Count) > math.MaxUint32 {
+			return nil
+		}
 		start := root.Metadata.Start
 		count := root.Metadata.Count + p.Metadata.Count
 		sum := a.combiner(a.hf, start, count, root.Root, p.Root)
@@ -663,6 +892,7 @@ const (
 	nodeTagNil      = 0x00
 	nodeTagLeaf     = 0x01 // HasData = true
 	nodeTagInternal = 0x02 // HasData = false, has Children
+	nodeTagGap      = 0x03 // HasData = true, Gap = true; same layout as a leaf
 )
 
 func encodeNode(buf *bytes.Buffer, n *Node) error {
@@ -672,7 +902,11 @@ func encodeNode(buf *bytes.Buffer, n *Node) error {
 
 	if n.HasData {
 		// Leaf Node
-		if err := buf.WriteByte(nodeTagLeaf); err != nil {
+		tag := byte(nodeTagLeaf)
+		if n.Gap {
+			tag = nodeTagGap
+		}
+		if err := buf.WriteByte(tag); err != nil {
 			return err
 		}
 		if err := writeU64(buf, n.Metadata.Start); err != nil {
@@ -742,13 +976,14 @@ func decodeNode(r *bytes.Reader) (*Node, error) {
 		Metadata: Metadata{Start: start, Count: count},
 	}
 
-	if tag == nodeTagLeaf {
+	if tag == nodeTagLeaf || tag == nodeTagGap {
 		var data Hash32
 		if _, err := r.Read(data[:]); err != nil {
 			return nil, err
 		}
 		n.Data = data
 		n.HasData = true
+		n.Gap = tag == nodeTagGap
 		return n, nil
 	}
 
@@ -841,8 +1076,11 @@ func (b *Builder) ToSnapshot() *MerkleTreeSnapshot {
 	s := &MerkleTreeSnapshot{
 		Version: 1,
 		Config: SnapshotConfig{
-			BlockMerge:    b.cfg.BlockMerge,
-			ExpectedTotal: b.cfg.ExpectedTotal,
+			BlockMerge:     b.cfg.BlockMerge,
+			ExpectedTotal:  b.cfg.ExpectedTotal,
+			RetainElements: b.cfg.RetainElements,
+			Domain:         bytes.Clone(b.cfg.Domain),
+			AllowGaps:      b.cfg.AllowGaps,
 		},
 		TotalBlocks:        b.totalBlocks,
 		ExpectedNextHeight: b.expectedNextHeight,
@@ -850,6 +1088,10 @@ func (b *Builder) ToSnapshot() *MerkleTreeSnapshot {
 		InChunkStart:       b.inChunkStart,
 	}
 
+	if len(b.cfg.Domain) > 0 {
+		s.Version = 2
+	}
+
 	// Copy partial chunk elements
 	s.InChunkElems = make([][]byte, len(b.inChunkElems))
 	for i, h := range b.inChunkElems {
@@ -898,14 +1140,38 @@ func LoadSnapshotfromJson(path string) (*MerkleTreeSnapshot, error) {
 // Note: You must provide a HashFactory if the original used a non-default one,
 // but here we just accept a factory function (optional).
 func (s *MerkleTreeSnapshot) FromSnapshot(hf HashFactory) (*Builder, error) {
-	if s.Version != 1 {
+	return s.FromSnapshotWithMetrics(hf, nil)
+}
+
+// FromSnapshotWithMetrics is FromSnapshot with m as the restored builder's
+// Config.Metrics; the restore is recorded in m.RestoreDuration, as Builder.Restore
+// records binary ones.
+func (s *MerkleTreeSnapshot) FromSnapshotWithMetrics(hf HashFactory, m *Metrics) (*Builder, error) {
+	began := time.Now()
+	b, err := s.fromSnapshot(hf, m)
+	if err != nil {
+		return nil, err
+	}
+	m.restored(time.Since(began))
+	return b, nil
+}
+
+func (s *MerkleTreeSnapshot) fromSnapshot(hf HashFactory, m *Metrics) (*Builder, error) {
+	if s.Version != 1 && s.Version != 2 {
 		return nil, fmt.Errorf("unsupported snapshot version: %d", s.Version)
 	}
+	if (s.Version == 2) != (len(s.Config.Domain) > 0) {
+		return nil, fmt.Errorf("snapshot version %d with a domain of %d bytes", s.Version, len(s.Config.Domain))
+	}
 
 	cfg := Config{
-		BlockMerge:    s.Config.BlockMerge,
-		ExpectedTotal: s.Config.ExpectedTotal,
-		HashFactory:   hf,
+		BlockMerge:     s.Config.BlockMerge,
+		ExpectedTotal:  s.Config.ExpectedTotal,
+		HashFactory:    hf,
+		RetainElements: s.Config.RetainElements,
+		Domain:         s.Config.Domain,
+		AllowGaps:      s.Config.AllowGaps,
+		Metrics:        m,
 		// StartHeight is not directly storable in Config struct as *uint64
 		// but we restore the builder state fields directly.
 	}
@@ -951,6 +1217,10 @@ func (s *MerkleTreeSnapshot) FromSnapshot(hf HashFactory) (*Builder, error) {
 		b.outer.peaks[i] = node
 	}
 	b.outer.leafCount = leafCount
+	b.gaps = b.countGaps()
+	if b.gaps > 0 && !b.cfg.AllowGaps {
+		return nil, fmt.Errorf("snapshot has gap leaves but does not allow gaps: %w", ErrMalformedSnapshot)
+	}
 
 	return b, nil
 }
@@ -964,12 +1234,21 @@ func nodeToSnapshot(n *Node) *SnapshotNode {
 		Start:   n.Metadata.Start,
 		Count:   n.Metadata.Count,
 		HasData: n.HasData,
+		Gap:     n.Gap,
 	}
 	copy(sn.Root, n.Root[:])
 
 	if n.HasData {
 		sn.Data = make([]byte, 32)
 		copy(sn.Data, n.Data[:])
+		if n.Elems != nil {
+			sn.Elems = make([][]byte, len(n.Elems))
+			for i, e := range n.Elems {
+				cp := make([]byte, 32)
+				copy(cp, e[:])
+				sn.Elems[i] = cp
+			}
+		}
 	} else {
 		sn.Left = nodeToSnapshot(n.Left)
 		sn.Right = nodeToSnapshot(n.Right)
@@ -991,6 +1270,7 @@ func snapshotToNode(sn *SnapshotNode) (*Node, error) {
 		Root:     root,
 		Metadata: Metadata{Start: sn.Start, Count: sn.Count},
 		HasData:  sn.HasData,
+		Gap:      sn.HasData && sn.Gap,
 	}
 
 	if sn.HasData {
@@ -998,6 +1278,15 @@ func snapshotToNode(sn *SnapshotNode) (*Node, error) {
 			return nil, errors.New("invalid data hash length in snapshot")
 		}
 		copy(n.Data[:], sn.Data)
+		if sn.Elems != nil {
+			n.Elems = make([]Hash32, len(sn.Elems))
+			for i, e := range sn.Elems {
+				if len(e) != 32 {
+					return nil, errors.New("invalid element hash length in snapshot")
+				}
+				copy(n.Elems[i][:], e)
+			}
+		}
 	} else {
 		left, err := snapshotToNode(sn.Left)
 		if err != nil {
@@ -0,0 +1,200 @@
+package merkletree
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics collects counters and histograms from the builders and diffs it is
+// attached to (Config.Metrics, DiffOptions.Metrics) and writes them in the
+// Prometheus text exposition format. One Metrics may be shared by any number of
+// builders; it is safe for concurrent use. Create it with NewMetrics, which
+// sets up the histograms; in a zero Metrics they are nil and discard what they
+// are given, while the counters work as usual.
+type Metrics struct {
+	BlocksPushed    Counter
+	ChunksCommitted Counter
+	HashesComputed  Counter // element, chunk, gap and node digests (see HashStats)
+	SnapshotBytes   *Histogram
+	// RestoreDuration times Builder.Restore and
+	// MerkleTreeSnapshot.FromSnapshotWithMetrics, in seconds.
+	RestoreDuration  *Histogram
+	Diffs            Counter
+	DiffNodesVisited Counter
+	DiffRanges       Counter
+}
+
+// NewMetrics returns a Metrics with every value at zero.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		SnapshotBytes:   NewHistogram(ExponentialBuckets(1<<10, 4, 11)), // 1 KiB … 1 GiB
+		RestoreDuration: NewHistogram([]float64{.001, .005, .01, .05, .1, .5, 1, 5, 10}),
+	}
+}
+
+// WritePrometheus writes every metric in the Prometheus text format (version 0.0.4).
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	m.BlocksPushed.write(bw, "merkletree_blocks_pushed_total", "Blocks accepted by Push.")
+	m.ChunksCommitted.write(bw, "merkletree_chunks_committed_total", "Chunks committed to the outer accumulator.")
+	m.HashesComputed.write(bw, "merkletree_hashes_computed_total", "Element, chunk, gap and node digests computed while building.")
+	m.SnapshotBytes.write(bw, "merkletree_snapshot_bytes", "Size of binary snapshots taken.")
+	m.RestoreDuration.write(bw, "merkletree_restore_duration_seconds", "Time spent restoring builders from binary or JSON snapshots.")
+	m.Diffs.write(bw, "merkletree_diffs_total", "Diff and bisect runs.")
+	m.DiffNodesVisited.write(bw, "merkletree_diff_nodes_visited_total", "Nodes examined by diff and bisect runs.")
+	m.DiffRanges.write(bw, "merkletree_diff_ranges_total", "Differing ranges reported by diff and bisect runs.")
+	return bw.Flush()
+}
+
+// pushed records a Push batch.
+func (m *Metrics) pushed(blocks int) {
+	if m != nil {
+		m.BlocksPushed.Add(uint64(blocks))
+		m.HashesComputed.Add(uint64(blocks))
+	}
+}
+
+// committed records a chunk commit and the merges it caused.
+func (m *Metrics) committed(merges uint64) {
+	if m != nil {
+		m.ChunksCommitted.Add(1)
+		m.HashesComputed.Add(1 + merges)
+	}
+}
+
+// gapCommitted records a gap leaf and the merges it caused.
+func (m *Metrics) gapCommitted(merges uint64) {
+	if m != nil {
+		m.HashesComputed.Add(1 + merges)
+	}
+}
+
+func (m *Metrics) snapshotTaken(bytes int) {
+	if m != nil {
+		m.SnapshotBytes.Observe(float64(bytes))
+	}
+}
+
+func (m *Metrics) restored(d time.Duration) {
+	if m != nil {
+		m.RestoreDuration.Observe(d.Seconds())
+	}
+}
+
+func (m *Metrics) diffed(nodes uint64, ranges int) {
+	if m != nil {
+		m.Diffs.Add(1)
+		m.DiffNodesVisited.Add(nodes)
+		m.DiffRanges.Add(uint64(ranges))
+	}
+}
+
+// Counter is a monotonically increasing count. The zero Counter is ready to use.
+type Counter struct {
+	v atomic.Uint64
+}
+
+func (c *Counter) Add(n uint64)  { c.v.Add(n) }
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+func (c *Counter) write(w *bufio.Writer, name, help string) {
+	writeHeader(w, name, help, "counter")
+	w.WriteString(name)
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatUint(c.Value(), 10))
+	w.WriteByte('\n')
+}
+
+// Histogram counts observations in cumulative buckets, as Prometheus does.
+type Histogram struct {
+	bounds []float64
+	counts []atomic.Uint64 // per bucket, non-cumulative; the last one is +Inf
+	count  atomic.Uint64
+	sum    atomic.Uint64 // float64 bits
+}
+
+// NewHistogram returns a histogram with the given upper bounds, in increasing order.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: append([]float64(nil), bounds...),
+		counts: make([]atomic.Uint64, len(bounds)+1),
+	}
+}
+
+// ExponentialBuckets returns count bounds starting at start, each factor times the
+// previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	b := make([]float64, count)
+	for i := range b {
+		b[i] = start
+		start *= factor
+	}
+	return b
+}
+
+// Observe records one value. A nil histogram discards it.
+func (h *Histogram) Observe(v float64) {
+	if h == nil {
+		return
+	}
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Count and Sum return the number and total of the observed values (0 for a nil
+// histogram).
+func (h *Histogram) Count() uint64 {
+	if h == nil {
+		return 0
+	}
+	return h.count.Load()
+}
+
+func (h *Histogram) Sum() float64 {
+	if h == nil {
+		return 0
+	}
+	return math.Float64frombits(h.sum.Load())
+}
+
+// write writes the histogram; a nil one is written empty, with only +Inf.
+func (h *Histogram) write(w *bufio.Writer, name, help string) {
+	if h == nil {
+		h = NewHistogram(nil)
+	}
+	writeHeader(w, name, help, "histogram")
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += h.counts[i].Load()
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = formatFloat(h.bounds[i])
+		}
+		w.WriteString(name + `_bucket{le="` + le + `"} ` + strconv.FormatUint(cumulative, 10) + "\n")
+	}
+	w.WriteString(name + "_sum " + formatFloat(h.Sum()) + "\n")
+	w.WriteString(name + "_count " + strconv.FormatUint(h.Count(), 10) + "\n")
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
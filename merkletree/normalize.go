@@ -0,0 +1,243 @@
+package merkletree
+
+import (
+	"fmt"
+)
+
+// Rechunk returns a new Builder holding the same blocks as b, but chunked with a
+// different blockMerge. Element hashes do not depend on the chunk size, so the new
+// tree is identical to one built by pushing the original block hashes with
+// Config.BlockMerge = blockMerge.
+//
+// All committed chunks must carry their element hashes (Config.RetainElements);
+// otherwise ErrElementsNotRetained is returned. b itself is not modified.
+//
+// The new builder has no Observer, Metrics, Logger or Tracer, so re-chunking (as
+// BlockDiff does) is not reported as blocks pushed by b.
+func (b *Builder) Rechunk(blockMerge int) (*Builder, error) {
+	if blockMerge <= 0 {
+		return nil, fmt.Errorf("invalid blockMerge %d", blockMerge)
+	}
+
+	cfg := b.cfg
+	cfg.BlockMerge = blockMerge
+	cfg.StartHeight = nil
+	cfg.Observer = nil
+	cfg.Metrics = nil
+	cfg.Logger = nil
+	cfg.Tracer = nil
+	r, err := NewBuilder(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.appendLeaves("rechunk", b); err != nil {
+		return nil, err
+	}
+
+	r.enforceHeights = b.enforceHeights
+	r.expectedNextHeight = b.expectedNextHeight
+	return r, nil
+}
+
+// appendLeaves re-chunks the blocks and gaps of src onto b from the element hashes
+// src retains; op names the operation in errors.
+func (b *Builder) appendLeaves(op string, src *Builder) error {
+	var walkErr error
+	src.walkLeaves(func(leaf *Node) bool {
+		if leaf.Gap {
+			walkErr = b.addGap(leaf.Metadata.Start, uint64(leaf.Metadata.Count))
+			return walkErr == nil
+		}
+		if uint64(len(leaf.Elems)) != uint64(leaf.Metadata.Count) {
+			walkErr = fmt.Errorf("%s [%d..%d]: %w", op, leaf.Metadata.Start,
+				leaf.Metadata.Start+uint64(leaf.Metadata.Count)-1, ErrElementsNotRetained)
+			return false
+		}
+		for i, e := range leaf.Elems {
+			if walkErr = b.appendElem(leaf.Metadata.Start+uint64(i), e); walkErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	return walkErr
+}
+
+// BlockDiff reports the block-level differences between b and other, even if the two
+// builders use different BlockMerge values (e.g. derived from different ExpectedTotal
+// hints).
+//
+// Both trees are first normalized to a common chunk size: the side with the larger
+// BlockMerge is re-chunked from its retained element hashes (falling back to the other
+// side if needed). The chunk-level TreeDiff of the normalized trees is then refined by
+// comparing element hashes, so each returned range covers exactly the differing blocks
+// wherever element hashes are available on both sides.
+//
+// Neither builder is modified.
+func (b *Builder) BlockDiff(other *Builder) ([]DiffRange, error) {
+	local, remote, err := normalizePair(b, other)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkDiffs, err := local.Fork().TreeDiff(remote.Fork())
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []DiffRange
+	for _, d := range chunkDiffs {
+		diffs = append(diffs, refineRange(local, remote, d)...)
+	}
+	return consolidateDiffs(diffs), nil
+}
+
+// normalizePair returns views of a and b that share the same BlockMerge.
+func normalizePair(a, b *Builder) (*Builder, *Builder, error) {
+	if a.cfg.BlockMerge == b.cfg.BlockMerge {
+		return a, b, nil
+	}
+
+	// Prefer re-chunking the coarser tree down to the finer chunk size,
+	// which keeps the refinement step cheap.
+	if a.cfg.BlockMerge > b.cfg.BlockMerge {
+		if r, err := a.Rechunk(b.cfg.BlockMerge); err == nil {
+			return r, b, nil
+		}
+		r, err := b.Rechunk(a.cfg.BlockMerge)
+		if err != nil {
+			return nil, nil, err
+		}
+		return a, r, nil
+	}
+
+	if r, err := b.Rechunk(a.cfg.BlockMerge); err == nil {
+		return a, r, nil
+	}
+	r, err := a.Rechunk(b.cfg.BlockMerge)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, b, nil
+}
+
+// refineRange narrows a chunk-level diff range down to the differing blocks.
+// Parts covered by only one side are kept whole; parts covered by both sides are
+// compared element by element when both sides have the element hashes. Single-block
+// mismatches carry the element hashes of each side as their roots.
+func refineRange(local, remote *Builder, d DiffRange) []DiffRange {
+	from := d.Start
+	to := d.Start + uint64(d.Count)
+
+	lFrom, lTo := local.heightSpan()
+	rFrom, rTo := remote.heightSpan()
+	bothFrom := max(from, lFrom, rFrom)
+	bothTo := min(to, lTo, rTo)
+	if bothFrom >= bothTo {
+		return []DiffRange{d}
+	}
+
+	var out []DiffRange
+	if from < bothFrom {
+		out = append(out, DiffRange{Start: from, Count: uint32(bothFrom - from), Kind: coverKind(lFrom, lTo, from)})
+	}
+	if bothTo < to {
+		out = append(out, DiffRange{Start: bothTo, Count: uint32(to - bothTo), Kind: coverKind(lFrom, lTo, bothTo)})
+	}
+
+	le := local.elementsBetween(bothFrom, bothTo)
+	re := remote.elementsBetween(bothFrom, bothTo)
+	if le == nil || re == nil {
+		return append(out, DiffRange{Start: bothFrom, Count: uint32(bothTo - bothFrom), Kind: DiffMismatch})
+	}
+
+	var run *DiffRange
+	for i := range le {
+		if le[i] == re[i] {
+			run = nil
+			continue
+		}
+		if run == nil {
+			out = append(out, DiffRange{Start: bothFrom + uint64(i), Kind: DiffMismatch, LocalRoot: le[i], RemoteRoot: re[i]})
+			run = &out[len(out)-1]
+		} else {
+			run.LocalRoot, run.RemoteRoot = Hash32{}, Hash32{}
+		}
+		run.Count++
+	}
+	return out
+}
+
+// coverKind tells which side covers height h, given the local span [lFrom, lTo).
+func coverKind(lFrom, lTo, h uint64) DiffKind {
+	if h >= lFrom && h < lTo {
+		return DiffLocalOnly
+	}
+	return DiffRemoteOnly
+}
+
+// heightSpan returns the half-open height range [from, to) covered by the builder.
+func (b *Builder) heightSpan() (uint64, uint64) {
+	from := b.startHeight()
+	return from, from + b.totalBlocks + b.gaps
+}
+
+// elementsBetween returns the element hashes for heights [from, to), or nil if any
+// of them is not available (committed chunk without retained elements).
+func (b *Builder) elementsBetween(from, to uint64) []Hash32 {
+	out := make([]Hash32, 0, to-from)
+	ok := true
+	b.walkLeaves(func(leaf *Node) bool {
+		lFrom := leaf.Metadata.Start
+		lTo := lFrom + uint64(leaf.Metadata.Count)
+		if lTo <= from {
+			return true
+		}
+		if lFrom >= to {
+			return false
+		}
+		if uint64(len(leaf.Elems)) != uint64(leaf.Metadata.Count) {
+			ok = false
+			return false
+		}
+		out = append(out, leaf.Elems[max(from, lFrom)-lFrom:min(to, lTo)-lFrom]...)
+		return true
+	})
+	if !ok || uint64(len(out)) != to-from {
+		return nil
+	}
+	return out
+}
+
+// walkLeaves visits every chunk leaf in height order, followed by a transient leaf
+// for the uncommitted partial chunk (if any). The walk stops when fn returns false.
+func (b *Builder) walkLeaves(fn func(leaf *Node) bool) {
+	for level := len(b.outer.peaks) - 1; level >= 0; level-- {
+		if !walkSubtreeLeaves(b.outer.peaks[level], fn) {
+			return
+		}
+	}
+	if p := b.partialLeaf(); p != nil {
+		fn(p)
+	}
+}
+
+func walkSubtreeLeaves(n *Node, fn func(leaf *Node) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.HasData {
+		return fn(n)
+	}
+	return walkSubtreeLeaves(n.Left, fn) && walkSubtreeLeaves(n.Right, fn)
+}
+
+// partialLeaf returns a leaf for the uncommitted partial chunk without committing it,
+// or nil if the partial chunk is empty. The leaf always carries its element hashes.
+func (b *Builder) partialLeaf() *Node {
+	if len(b.inChunkElems) == 0 {
+		return nil
+	}
+	return newChunkLeaf(b.hf, b.inChunkStart, b.inChunkElems, true)
+}
@@ -0,0 +1,39 @@
+package merkletree
+
+// Observer receives the events of a Builder as they happen, e.g. to persist chunk
+// digests, publish new roots or feed metrics. Callbacks run synchronously on the
+// goroutine calling into the Builder and must not call back into it. Embed
+// NopObserver to implement only some of them.
+//
+// Builders returned by Fork, Rechunk and Concat have no Observer: speculative and
+// derived trees do not report events.
+type Observer interface {
+	// OnChunkCommitted is called once a chunk leaf has been added to the outer
+	// accumulator, after the OnPeakMerged calls its arrival caused. The partial
+	// chunk committed by Finalize or RootNode is reported too.
+	OnChunkCommitted(start uint64, count uint32, digest Hash32)
+	// OnPeakMerged is called for every node created by merging two peaks; level is
+	// the level of the new peak (it covers 2^level chunks).
+	OnPeakMerged(level int, node *Node)
+	// OnFinalize is called by Finalize with the root it returns.
+	OnFinalize(root Hash32)
+	// OnRestore is called after Restore loaded a snapshot.
+	OnRestore(state State)
+}
+
+// NopObserver implements Observer with callbacks that do nothing.
+type NopObserver struct{}
+
+func (NopObserver) OnChunkCommitted(start uint64, count uint32, digest Hash32) {}
+func (NopObserver) OnPeakMerged(level int, node *Node)                         {}
+func (NopObserver) OnFinalize(root Hash32)                                     {}
+func (NopObserver) OnRestore(state State)                                      {}
+
+// newOuter returns an empty outer accumulator wired to the configured Observer.
+func (b *Builder) newOuter() peaksAccumulator {
+	a := newPeaksAccumulator(b.hf, outerNodeDigest)
+	if b.cfg.Observer != nil {
+		a.onMerge = b.cfg.Observer.OnPeakMerged
+	}
+	return a
+}
@@ -0,0 +1,187 @@
+package merkletree
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"sync"
+)
+
+// RandomAccessSource serves block hashes by height, e.g. from a block store. It
+// must be safe for concurrent use.
+type RandomAccessSource interface {
+	// BlockHashes fills out with the hashes of the blocks at heights
+	// [start, start+len(out)).
+	BlockHashes(ctx context.Context, start uint64, out []Hash32) error
+}
+
+// parallelFetch is the number of block hashes a BuildParallel worker asks its
+// source for at once (rounded up to whole chunks).
+const parallelFetch = 4096
+
+// BuildParallel builds the tree over the count blocks starting at height start,
+// reading them from src with up to workers goroutines. The returned builder is
+// the one NewBuilder(cfg) reaches by pushing those blocks in order: same root,
+// snapshot and partial chunk, ready for further pushes. If cfg.StartHeight is
+// set, it must be start.
+//
+// The range is split into segments of a power-of-two number of chunks, so each
+// segment's chunks form complete outer subtrees of the final tree. Workers build
+// segments independently, hashing elements, chunks and subtrees, and the segments
+// are joined with Concat, which reuses those subtrees as they are. The Observer
+// sees no events from the build; it is attached to the returned builder.
+//
+// The first error from src or the builders, or ctx's cancellation, stops every
+// worker and is returned.
+func BuildParallel(ctx context.Context, cfg Config, src RandomAccessSource, start, count uint64, workers int) (*Builder, error) {
+	if cfg.StartHeight != nil && *cfg.StartHeight != start {
+		return nil, fmt.Errorf("start %d does not match Config.StartHeight %d", start, *cfg.StartHeight)
+	}
+	if start+count < start {
+		return nil, fmt.Errorf("range at %d of %d blocks overflows", start, count)
+	}
+	workers = max(workers, 1)
+	observer := cfg.Observer
+	cfg.Observer = nil
+	first, err := NewBuilder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return withObserver(first, observer), nil
+	}
+
+	ctx, span := startSpan(ctx, cfg.Tracer, "merkletree.BuildParallel",
+		slog.Uint64("start", start), slog.Uint64("count", count), slog.Int("workers", workers))
+	b, err := buildSegments(ctx, first, src, start, count, workers)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return withObserver(b, observer), nil
+}
+
+// buildSegments runs the segment workers and joins their builders; first, built
+// with the caller's Config, receives the first segment.
+func buildSegments(ctx context.Context, first *Builder, src RandomAccessSource, start, count uint64, workers int) (*Builder, error) {
+	bm := uint64(first.cfg.BlockMerge)
+	chunks := (count + bm - 1) / bm
+	// About four segments per worker, each a power of two of chunks.
+	perSegment := uint64(1)
+	if want := chunks / uint64(workers*4); want > 1 {
+		perSegment = 1 << (63 - bits.LeadingZeros64(want))
+	}
+	segBlocks := perSegment * bm
+	segments := make([]*Builder, (count+segBlocks-1)/segBlocks)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var failOnce sync.Once
+	var failErr error
+	fail := func(err error) {
+		failOnce.Do(func() { failErr = err })
+		cancel()
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(segments)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]Hash32, min(segBlocks, (parallelFetch+bm-1)/bm*bm))
+			for i := range jobs {
+				from := start + uint64(i)*segBlocks
+				to := min(from+segBlocks, start+count)
+				b, err := segmentBuilder(first, i, from)
+				if err == nil {
+					err = fillSegment(ctx, b, src, from, to, buf)
+				}
+				if err != nil {
+					fail(err)
+					continue
+				}
+				segments[i] = b
+			}
+		}()
+	}
+dispatch:
+	for i := range segments {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if failErr != nil {
+		return nil, failErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	out := segments[0]
+	hashing := out.hashing
+	for _, s := range segments[1:] {
+		joined, err := Concat(out, s)
+		if err != nil {
+			return nil, err
+		}
+		hashing.add(s.hashing)
+		hashing.add(joined.hashing)
+		out = joined
+	}
+	out.hashing = hashing
+	return out, nil
+}
+
+// segmentBuilder returns the builder for segment i starting at from: first for
+// segment 0, otherwise a builder with the same Config starting at from.
+func segmentBuilder(first *Builder, i int, from uint64) (*Builder, error) {
+	if i == 0 {
+		return first, nil
+	}
+	cfg := first.cfg
+	cfg.StartHeight = &from
+	return NewBuilder(cfg)
+}
+
+// fillSegment pushes the blocks [from, to) from src into b, buf at a time.
+func fillSegment(ctx context.Context, b *Builder, src RandomAccessSource, from, to uint64, buf []Hash32) error {
+	for at := from; at < to; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page := buf[:min(uint64(len(buf)), to-at)]
+		if err := src.BlockHashes(ctx, at, page); err != nil {
+			return fmt.Errorf("blocks [%d, +%d): %w", at, len(page), err)
+		}
+		if _, err := b.Push(at, page); err != nil {
+			return err
+		}
+		at += uint64(len(page))
+	}
+	return nil
+}
+
+// withObserver attaches o to b, as NewBuilder would have.
+func withObserver(b *Builder, o Observer) *Builder {
+	b.cfg.Observer = o
+	if o != nil {
+		b.outer.onMerge = o.OnPeakMerged
+	}
+	return b
+}
+
+// add accumulates the counters of o into h.
+func (h *HashStats) add(o HashStats) {
+	h.ElementDigests += o.ElementDigests
+	h.ChunkDigests += o.ChunkDigests
+	h.GapDigests += o.GapDigests
+	h.NodeDigests += o.NodeDigests
+	h.BytesHashed += o.BytesHashed
+	h.PushTime += o.PushTime
+}
@@ -0,0 +1,138 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidProof is returned when a proof does not lead to the expected root.
+var ErrInvalidProof = errors.New("invalid proof")
+
+// BlockProof proves that a block hash was pushed at a given height into the tree
+// with a given root (the root Finalize returns).
+//
+// The chunk digest accumulates its element hashes by XOR, so there is no path
+// inside a chunk: the proof carries every element hash of the block's chunk. The
+// XOR accumulation does not stop a prover from choosing the other elements of the
+// chunk, so a proof shows the block is consistent with the root, not that the
+// rest of the chunk is genuine.
+//
+// In a tree with Config.AllowGaps, a height inside a gap leaf gets a proof of
+// absence instead: GapCount is the size of the gap starting at ChunkStart, Elems
+// is empty, and the proof is checked with VerifyGap.
+type BlockProof struct {
+	Height     uint64      `json:"height"`
+	ChunkStart uint64      `json:"chunk_start"`
+	Elems      []Hash32    `json:"elems"`            // element hashes of the chunk, in height order
+	Path       []ProofStep `json:"path"`             // siblings from the chunk leaf up to the root
+	Root       Hash32      `json:"root"`             // the root the proof was made for
+	Domain     []byte      `json:"domain,omitempty"` // Config.Domain of the tree
+	GapCount   uint32      `json:"gap_count,omitempty"`
+}
+
+// ProofStep is one sibling on the path from a chunk leaf to the root.
+type ProofStep struct {
+	Left  bool   `json:"left"` // the sibling is the left child
+	Start uint64 `json:"start"`
+	Count uint32 `json:"count"`
+	Root  Hash32 `json:"root"`
+}
+
+// ProveBlock returns a proof for the block at height against the root Finalize
+// would return now. The builder is not modified. Blocks in committed chunks can
+// only be proven with Config.RetainElements; otherwise ErrElementsNotRetained is
+// returned.
+func (b *Builder) ProveBlock(height uint64) (*BlockProof, error) {
+	n, err := b.RootView()
+	if err != nil {
+		return nil, err
+	}
+	if n == nil || height < n.Metadata.Start || height-n.Metadata.Start >= uint64(n.Metadata.Count) {
+		return nil, fmt.Errorf("height %d is not in the tree", height)
+	}
+
+	p := &BlockProof{Height: height, Root: n.Root, Domain: bytes.Clone(b.cfg.Domain)}
+	for !n.HasData {
+		if height < n.Right.Metadata.Start {
+			p.Path = append(p.Path, ProofStep{Start: n.Right.Metadata.Start, Count: n.Right.Metadata.Count, Root: n.Right.Root})
+			n = n.Left
+		} else {
+			p.Path = append(p.Path, ProofStep{Left: true, Start: n.Left.Metadata.Start, Count: n.Left.Metadata.Count, Root: n.Left.Root})
+			n = n.Right
+		}
+	}
+	if !n.Gap && uint64(len(n.Elems)) != uint64(n.Metadata.Count) {
+		return nil, fmt.Errorf("prove block %d: %w", height, ErrElementsNotRetained)
+	}
+	// Steps were collected from the root down.
+	for i, j := 0, len(p.Path)-1; i < j; i, j = i+1, j-1 {
+		p.Path[i], p.Path[j] = p.Path[j], p.Path[i]
+	}
+	p.ChunkStart = n.Metadata.Start
+	if n.Gap {
+		p.GapCount = n.Metadata.Count
+		return p, nil
+	}
+	p.Elems = append([]Hash32(nil), n.Elems...)
+	return p, nil
+}
+
+// Verify checks that blockHash at p.Height leads to root, hashing with hf (nil for
+// the default hash function) and p.Domain. A root from another domain never
+// matches; Checkpoint.VerifyProof also reports the mismatch as ErrDomainMismatch.
+func (p *BlockProof) Verify(hf HashFactory, root, blockHash Hash32) error {
+	hf = DomainHashFactory(hf, p.Domain)
+	if p.GapCount > 0 {
+		return fmt.Errorf("%w: height %d is in a gap", ErrInvalidProof, p.Height)
+	}
+	count := uint64(len(p.Elems))
+	if count == 0 || count > uint64(^uint32(0)) || p.Height < p.ChunkStart || p.Height-p.ChunkStart >= count {
+		return fmt.Errorf("%w: height %d is not in chunk [%d, +%d)", ErrInvalidProof, p.Height, p.ChunkStart, count)
+	}
+	if p.Elems[p.Height-p.ChunkStart] != elemDigest(hf, p.Height, blockHash) {
+		return fmt.Errorf("%w: block hash does not match height %d", ErrInvalidProof, p.Height)
+	}
+
+	return p.verifyPath(hf, root, chunkDigest(hf, p.ChunkStart, uint32(count), p.Elems), count)
+}
+
+// VerifyGap checks that p proves no block was pushed at p.Height: the height lies
+// in the gap [p.ChunkStart, +p.GapCount) and that gap leaf leads to root.
+func (p *BlockProof) VerifyGap(hf HashFactory, root Hash32) error {
+	hf = DomainHashFactory(hf, p.Domain)
+	count := uint64(p.GapCount)
+	if count == 0 || len(p.Elems) > 0 || p.Height < p.ChunkStart || p.Height-p.ChunkStart >= count {
+		return fmt.Errorf("%w: height %d is not in gap [%d, +%d)", ErrInvalidProof, p.Height, p.ChunkStart, count)
+	}
+	return p.verifyPath(hf, root, gapDigest(hf, p.ChunkStart, p.GapCount), count)
+}
+
+// verifyPath folds p.Path over the leaf digest cur covering [p.ChunkStart, +size)
+// and compares the result with root.
+func (p *BlockProof) verifyPath(hf HashFactory, root, cur Hash32, size uint64) error {
+	start := p.ChunkStart
+	for i, s := range p.Path {
+		if s.Left {
+			if s.Start+uint64(s.Count) != start {
+				return fmt.Errorf("%w: step %d is not adjacent", ErrInvalidProof, i)
+			}
+			start = s.Start
+		} else if start+size != s.Start {
+			return fmt.Errorf("%w: step %d is not adjacent", ErrInvalidProof, i)
+		}
+		size += uint64(s.Count)
+		if size > uint64(^uint32(0)) {
+			return fmt.Errorf("%w: step %d overflows", ErrInvalidProof, i)
+		}
+		if s.Left {
+			cur = outerNodeDigest(hf, start, uint32(size), s.Root, cur)
+		} else {
+			cur = outerNodeDigest(hf, start, uint32(size), cur, s.Root)
+		}
+	}
+	if cur != root {
+		return fmt.Errorf("%w: root mismatch", ErrInvalidProof)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package merkletree
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrPageConflict is returned when a page disagrees with blocks already
+	// buffered or pushed at the same heights.
+	ErrPageConflict = errors.New("page conflicts with known blocks")
+	// ErrReassemblyFull is returned when buffering a page would exceed the
+	// reassembler's bound; retry it once earlier pages have been pushed.
+	ErrReassemblyFull = errors.New("reassembly buffer full")
+)
+
+// HeightRange is the half-open height range [Start, End).
+type HeightRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// Reassembler accepts pages of block hashes for arbitrary height ranges, in any
+// order, and pushes them into a Builder in height order: a page that continues the
+// builder is pushed at once, together with every buffered page it makes
+// contiguous; other pages are buffered.
+//
+// Overlapping pages are reconciled height by height. Heights already known are
+// compared and dropped, so duplicate pages from several peers are harmless, while
+// a page with a different hash at a known height is rejected as a whole with
+// ErrPageConflict. Heights already pushed are compared against the builder's
+// element hashes where it still holds them (the partial chunk, or any chunk with
+// Config.RetainElements) and dropped unchecked otherwise.
+//
+// A Reassembler is safe for concurrent use. The builder must not be pushed to
+// directly while the reassembler feeds it.
+type Reassembler struct {
+	mu          sync.Mutex
+	b           *Builder
+	next        uint64
+	maxBuffered int
+	pages       []reassemblyPage // sorted by start, disjoint
+	buffered    int
+	stats       ReassemblerStats
+}
+
+type reassemblyPage struct {
+	start  uint64
+	hashes []Hash32
+}
+
+func (p reassemblyPage) end() uint64 { return p.start + uint64(len(p.hashes)) }
+
+// ReassemblerStats counts what a Reassembler did with the blocks it was given.
+type ReassemblerStats struct {
+	Pushed     uint64 `json:"pushed"`     // blocks pushed into the builder
+	Buffered   int    `json:"buffered"`   // blocks waiting for an earlier page
+	Pages      int    `json:"pages"`      // buffered pages
+	Duplicates uint64 `json:"duplicates"` // blocks dropped because their height was already known
+	Unchecked  uint64 `json:"unchecked"`  // duplicates of pushed blocks whose elements were no longer held
+}
+
+// NewReassembler returns a reassembler feeding b, whose next block is at height
+// next. maxBuffered bounds the blocks held back waiting for earlier pages (32
+// bytes each, plus one slice per page); 0 means no bound. If b already knows its
+// next height (it is not empty, or has Config.StartHeight), next must match it.
+func NewReassembler(b *Builder, next uint64, maxBuffered int) (*Reassembler, error) {
+	if want, ok := b.nextHeight(); ok && want != next {
+		return nil, fmt.Errorf("reassembler starts at %d, builder expects %d", next, want)
+	}
+	if maxBuffered < 0 {
+		return nil, fmt.Errorf("invalid buffer bound %d", maxBuffered)
+	}
+	return &Reassembler{b: b, next: next, maxBuffered: maxBuffered}, nil
+}
+
+// Next returns the height of the next block to push into the builder.
+func (r *Reassembler) Next() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.next
+}
+
+// Stats returns the reassembler's counters.
+func (r *Reassembler) Stats() ReassemblerStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.stats
+	s.Buffered, s.Pages = r.buffered, len(r.pages)
+	return s
+}
+
+// Missing returns the height ranges between Next and the last buffered block that
+// no page has covered yet, in ascending order: what remains to be fetched before
+// everything buffered can be pushed.
+func (r *Reassembler) Missing() []HeightRange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []HeightRange
+	at := r.next
+	for _, p := range r.pages {
+		if p.start > at {
+			out = append(out, HeightRange{Start: at, End: p.start})
+		}
+		at = p.end()
+	}
+	return out
+}
+
+// Add accepts the page blockHashes starting at height start and returns the
+// number of blocks pushed into the builder as a result, which may include
+// buffered pages the new one made contiguous. A rejected page
+// (ErrPageConflict, ErrReassemblyFull) leaves the reassembler unchanged; an
+// error from Builder.Push is returned as is, with the blocks it did not accept
+// kept buffered.
+func (r *Reassembler) Add(start uint64, blockHashes []Hash32) (pushed int, err error) {
+	if len(blockHashes) == 0 {
+		return 0, nil
+	}
+	end := start + uint64(len(blockHashes))
+	if end < start {
+		return 0, fmt.Errorf("page at %d of %d blocks overflows", start, len(blockHashes))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Heights below next were pushed already.
+	var dup, unchecked uint64
+	for h := start; h < min(end, r.next); h++ {
+		elem, ok := r.b.elementAt(h)
+		if !ok {
+			unchecked++
+		} else if elem != elemDigest(r.b.hf, h, blockHashes[h-start]) {
+			return 0, fmt.Errorf("%w: block %d differs from the pushed one", ErrPageConflict, h)
+		}
+		dup++
+	}
+	if start < r.next {
+		if end <= r.next {
+			r.stats.Duplicates += dup
+			r.stats.Unchecked += unchecked
+			return 0, nil
+		}
+		blockHashes = blockHashes[r.next-start:]
+		start = r.next
+	}
+
+	// Compare against buffered pages and keep the uncovered segments.
+	var segs []reassemblyPage
+	at := start
+	i := sort.Search(len(r.pages), func(i int) bool { return r.pages[i].end() > start })
+	for j := i; j < len(r.pages) && r.pages[j].start < end; j++ {
+		p := r.pages[j]
+		if p.start > at {
+			segs = append(segs, reassemblyPage{start: at, hashes: blockHashes[at-start : p.start-start]})
+		}
+		for h := max(p.start, start); h < min(p.end(), end); h++ {
+			if p.hashes[h-p.start] != blockHashes[h-start] {
+				return 0, fmt.Errorf("%w: block %d differs from a buffered page", ErrPageConflict, h)
+			}
+			dup++
+		}
+		at = max(at, p.end())
+	}
+	if at < end {
+		segs = append(segs, reassemblyPage{start: at, hashes: blockHashes[at-start:]})
+	}
+
+	// A page starting at next drains everything it touches; others are buffered.
+	if start != r.next && r.maxBuffered > 0 {
+		var added int
+		for _, s := range segs {
+			added += len(s.hashes)
+		}
+		if r.buffered+added > r.maxBuffered {
+			return 0, fmt.Errorf("%w: %d buffered, %d more would exceed %d", ErrReassemblyFull, r.buffered, added, r.maxBuffered)
+		}
+	}
+	r.stats.Duplicates += dup
+	r.stats.Unchecked += unchecked
+	for _, s := range segs {
+		s.hashes = slices.Clone(s.hashes) // the caller may reuse the page
+		k := sort.Search(len(r.pages), func(k int) bool { return r.pages[k].start > s.start })
+		r.pages = slices.Insert(r.pages, k, s)
+		r.buffered += len(s.hashes)
+	}
+	return r.drain()
+}
+
+// drain pushes the buffered pages that continue the builder.
+func (r *Reassembler) drain() (pushed int, err error) {
+	for len(r.pages) > 0 && r.pages[0].start == r.next {
+		p := &r.pages[0]
+		n, err := r.b.Push(p.start, p.hashes)
+		pushed += n
+		r.next += uint64(n)
+		r.buffered -= n
+		r.stats.Pushed += uint64(n)
+		if err != nil {
+			p.start, p.hashes = p.start+uint64(n), p.hashes[n:]
+			if len(p.hashes) == 0 {
+				r.pages = slices.Delete(r.pages, 0, 1)
+			}
+			return pushed, err
+		}
+		r.pages = slices.Delete(r.pages, 0, 1)
+	}
+	return pushed, nil
+}
+
+// elementAt returns the element hash pushed at height h, if b still holds it.
+func (b *Builder) elementAt(h uint64) (Hash32, bool) {
+	if h >= b.inChunkStart && h-b.inChunkStart < uint64(len(b.inChunkElems)) {
+		return b.inChunkElems[h-b.inChunkStart], true
+	}
+	for _, n := range b.outer.peaks {
+		if n == nil || h < n.Metadata.Start || h-n.Metadata.Start >= uint64(n.Metadata.Count) {
+			continue
+		}
+		for !n.HasData {
+			if h < n.Right.Metadata.Start {
+				n = n.Left
+			} else {
+				n = n.Right
+			}
+		}
+		if uint64(len(n.Elems)) != uint64(n.Metadata.Count) {
+			return Hash32{}, false
+		}
+		return n.Elems[h-n.Metadata.Start], true
+	}
+	return Hash32{}, false
+}
@@ -0,0 +1,323 @@
+package merkletree
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RenderFormat selects the output of Builder.Render.
+type RenderFormat uint8
+
+const (
+	// RenderText is the Visualize summary: totals, partial chunk and peaks.
+	RenderText RenderFormat = iota
+	// RenderTree draws every retained node, down to the chunk leaves, as an ASCII tree.
+	RenderTree
+	// RenderJSON writes the tree as a JSON document.
+	RenderJSON
+	// RenderDOT writes a Graphviz digraph.
+	RenderDOT
+	// RenderMermaid writes a Mermaid flowchart.
+	RenderMermaid
+)
+
+var renderFormatNames = [...]string{
+	RenderText:    "text",
+	RenderTree:    "tree",
+	RenderJSON:    "json",
+	RenderDOT:     "dot",
+	RenderMermaid: "mermaid",
+}
+
+func (f RenderFormat) String() string {
+	if int(f) < len(renderFormatNames) {
+		return renderFormatNames[f]
+	}
+	return fmt.Sprintf("RenderFormat(%d)", uint8(f))
+}
+
+func (f RenderFormat) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f *RenderFormat) UnmarshalText(text []byte) error {
+	for i, name := range renderFormatNames {
+		if name == string(text) {
+			*f = RenderFormat(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown render format %q", text)
+}
+
+// RenderOptions tunes Builder.Render.
+type RenderOptions struct {
+	// MaxDepth limits how many levels below each peak are drawn (0 = down to the
+	// chunk leaves). Ignored by RenderText, which only shows the peaks.
+	MaxDepth int
+	// Highlight marks every node overlapping one of these ranges, e.g. the result
+	// of a diff, so divergence stands out.
+	Highlight []DiffRange
+}
+
+func (o RenderOptions) highlighted(start uint64, count uint32) bool {
+	end := start + uint64(count)
+	for _, d := range o.Highlight {
+		if d.Start < end && start < d.Start+uint64(d.Count) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render writes a view of the tree to w. Peaks are drawn oldest (leftmost) first,
+// followed by the uncommitted partial chunk. The builder is not modified.
+func (b *Builder) Render(w io.Writer, format RenderFormat, opts RenderOptions) error {
+	ew := &errWriter{w: w}
+	if format == RenderText {
+		b.renderText(ew, opts)
+		return ew.err
+	}
+
+	t, err := b.renderTree(opts)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case RenderTree:
+		t.writeASCII(ew)
+	case RenderJSON:
+		enc := json.NewEncoder(ew)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(t); err != nil {
+			return err
+		}
+	case RenderDOT:
+		t.writeDOT(ew)
+	case RenderMermaid:
+		t.writeMermaid(ew)
+	default:
+		return fmt.Errorf("unknown render format %d", format)
+	}
+	return ew.err
+}
+
+// renderTree is the format-independent view drawn by Render.
+type renderTree struct {
+	TotalBlocks uint64        `json:"total_blocks"`
+	BlockMerge  int           `json:"block_merge"`
+	Root        Hash32        `json:"root"`
+	Peaks       []*renderNode `json:"peaks"`
+	Partial     *renderNode   `json:"partial,omitempty"`
+}
+
+type renderNode struct {
+	Start     uint64        `json:"start"`
+	Count     uint32        `json:"count"`
+	Root      Hash32        `json:"root"`
+	Level     int           `json:"level"` // 0 for chunk leaves
+	Leaf      bool          `json:"leaf,omitempty"`
+	Gap       bool          `json:"gap,omitempty"`
+	Partial   bool          `json:"partial,omitempty"`
+	Differs   bool          `json:"differs,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"` // children cut off by MaxDepth
+	Children  []*renderNode `json:"children,omitempty"`
+
+	id int
+}
+
+func (b *Builder) renderTree(opts RenderOptions) (*renderTree, error) {
+	root, err := b.RootView()
+	if err != nil {
+		return nil, err
+	}
+	t := &renderTree{TotalBlocks: b.totalBlocks, BlockMerge: b.cfg.BlockMerge}
+	if root != nil {
+		t.Root = root.Root
+	}
+
+	id := 0
+	var build func(n *Node, level, depth int) *renderNode
+	build = func(n *Node, level, depth int) *renderNode {
+		r := &renderNode{
+			Start:   n.Metadata.Start,
+			Count:   n.Metadata.Count,
+			Root:    n.Root,
+			Level:   level,
+			Leaf:    n.HasData,
+			Gap:     n.Gap,
+			Differs: opts.highlighted(n.Metadata.Start, n.Metadata.Count),
+			id:      id,
+		}
+		id++
+		if n.HasData {
+			return r
+		}
+		if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+			r.Truncated = true
+			return r
+		}
+		for _, c := range []*Node{n.Left, n.Right} {
+			if c != nil {
+				r.Children = append(r.Children, build(c, level-1, depth+1))
+			}
+		}
+		return r
+	}
+
+	for level := len(b.outer.peaks) - 1; level >= 0; level-- {
+		if p := b.outer.peaks[level]; p != nil {
+			t.Peaks = append(t.Peaks, build(p, level, 0))
+		}
+	}
+	if p := b.partialLeaf(); p != nil {
+		t.Partial = build(p, 0, 0)
+		t.Partial.Partial = true
+	}
+	return t, nil
+}
+
+// nodes returns the top-level nodes: the peaks, then the partial chunk.
+func (t *renderTree) nodes() []*renderNode {
+	if t.Partial == nil {
+		return t.Peaks
+	}
+	return append(append([]*renderNode{}, t.Peaks...), t.Partial)
+}
+
+func (n *renderNode) label() string {
+	var kind string
+	switch {
+	case n.Partial:
+		kind = "partial"
+	case n.Gap:
+		kind = "gap"
+	case n.Leaf:
+		kind = "chunk"
+	default:
+		kind = fmt.Sprintf("L%d", n.Level)
+	}
+	return fmt.Sprintf("%s [%d … %d]", kind, n.Start, n.Start+uint64(n.Count)-1)
+}
+
+func (t *renderTree) writeASCII(w io.Writer) {
+	fmt.Fprintf(w, "Merkle Tree: %d blocks, blockMerge %d, root %s\n", t.TotalBlocks, t.BlockMerge, shortHash(t.Root))
+
+	var walk func(n *renderNode, prefix string, last bool)
+	walk = func(n *renderNode, prefix string, last bool) {
+		branch, indent := "├─ ", "│  "
+		if last {
+			branch, indent = "└─ ", "   "
+		}
+		line := fmt.Sprintf("%s%s%s  %d blocks  %s", prefix, branch, n.label(), n.Count, shortHash(n.Root))
+		if n.Partial {
+			line += "  (uncommitted)"
+		}
+		if n.Differs {
+			line += "  ✗ differs"
+		}
+		fmt.Fprintln(w, line)
+
+		if n.Truncated {
+			fmt.Fprintf(w, "%s%s└─ … %d chunks\n", prefix, indent, uint64(1)<<uint(n.Level))
+		}
+		for i, c := range n.Children {
+			walk(c, prefix+indent, i == len(n.Children)-1)
+		}
+	}
+
+	top := t.nodes()
+	if len(top) == 0 {
+		fmt.Fprintln(w, "└─ (empty)")
+	}
+	for i, n := range top {
+		walk(n, "", i == len(top)-1)
+	}
+}
+
+func (t *renderTree) writeDOT(w io.Writer) {
+	fmt.Fprintln(w, "digraph merkle {")
+	fmt.Fprintln(w, `  node [shape=box, fontname="monospace"];`)
+
+	var walk func(n *renderNode)
+	walk = func(n *renderNode) {
+		attrs := ""
+		switch {
+		case n.Differs:
+			attrs = `, style=filled, fillcolor="#f4a6a6", color="#cc0000"`
+		case n.Partial:
+			attrs = `, style=dashed`
+		}
+		fmt.Fprintf(w, "  n%d [label=\"%s\\n%d blocks\\n%s\"%s];\n", n.id, n.label(), n.Count, shortHash(n.Root), attrs)
+		if n.Truncated {
+			fmt.Fprintf(w, "  n%dx [label=\"… %d chunks\", shape=plaintext];\n", n.id, uint64(1)<<uint(n.Level))
+			fmt.Fprintf(w, "  n%d -> n%dx [style=dotted];\n", n.id, n.id)
+		}
+		for _, c := range n.Children {
+			walk(c)
+			fmt.Fprintf(w, "  n%d -> n%d;\n", n.id, c.id)
+		}
+	}
+	top := t.nodes()
+	for _, n := range top {
+		walk(n)
+	}
+	// Keep the peaks in height order, left to right.
+	if len(top) > 1 {
+		ids := make([]string, len(top))
+		for i, n := range top {
+			ids[i] = fmt.Sprintf("n%d", n.id)
+		}
+		fmt.Fprintf(w, "  { rank=same; %s [style=invis]; }\n", strings.Join(ids, " -> "))
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func (t *renderTree) writeMermaid(w io.Writer) {
+	fmt.Fprintln(w, "graph TD")
+
+	var differs []string
+	var walk func(n *renderNode)
+	walk = func(n *renderNode) {
+		shape := [2]string{"[", "]"}
+		if n.Partial {
+			shape = [2]string{"([", "])"}
+		}
+		fmt.Fprintf(w, "  n%d%s\"%s<br/>%d blocks<br/>%s\"%s\n", n.id, shape[0], n.label(), n.Count, shortHash(n.Root), shape[1])
+		if n.Differs {
+			differs = append(differs, fmt.Sprintf("n%d", n.id))
+		}
+		if n.Truncated {
+			fmt.Fprintf(w, "  n%d -.-> n%dx[\"… %d chunks\"]\n", n.id, n.id, uint64(1)<<uint(n.Level))
+		}
+		for _, c := range n.Children {
+			walk(c)
+			fmt.Fprintf(w, "  n%d --> n%d\n", n.id, c.id)
+		}
+	}
+	for _, n := range t.nodes() {
+		walk(n)
+	}
+	if len(differs) > 0 {
+		fmt.Fprintln(w, "  classDef differs fill:#f4a6a6,stroke:#cc0000")
+		fmt.Fprintf(w, "  class %s differs\n", strings.Join(differs, ","))
+	}
+}
+
+// errWriter remembers the first write error, so rendering code can write freely
+// and check once at the end.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
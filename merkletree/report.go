@@ -0,0 +1,214 @@
+package merkletree
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// ReportOptions tunes WriteDiffReport.
+type ReportOptions struct {
+	// Title heads the page (default "Merkle tree diff").
+	Title string
+	// LocalName and RemoteName label the two sides (default "local" and "remote").
+	LocalName, RemoteName string
+	// MaxDepth limits how many levels below each peak are drawn, as in
+	// RenderOptions (0 = down to the chunk leaves).
+	MaxDepth int
+	// Differ computes the ranges; the zero Differ reports every range, as TreeDiff.
+	Differ Differ
+}
+
+// WriteDiffReport diffs local against remote and writes a self-contained HTML page
+// (no scripts, stylesheets or images are fetched) showing both roots, the peaks of
+// each side, every retained node with matching subtrees and differing ones coloured
+// apart, and a table of the differing ranges with the heights they cover and the
+// roots on each side. Neither builder is modified.
+func WriteDiffReport(ctx context.Context, w io.Writer, local, remote *Builder, opts ReportOptions) error {
+	res, err := opts.Differ.Diff(ctx, local, remote)
+	if err != nil {
+		return err
+	}
+	data := reportData{
+		Title:  opts.Title,
+		Result: res,
+	}
+	if data.Title == "" {
+		data.Title = "Merkle tree diff"
+	}
+	render := RenderOptions{MaxDepth: opts.MaxDepth, Highlight: res.Ranges}
+	for i, side := range []struct {
+		name, def string
+		b         *Builder
+	}{{opts.LocalName, "local", local}, {opts.RemoteName, "remote", remote}} {
+		t, err := side.b.renderTree(render)
+		if err != nil {
+			return err
+		}
+		data.Sides[i] = reportSide{Name: side.name, Tree: t}
+		if data.Sides[i].Name == "" {
+			data.Sides[i].Name = side.def
+		}
+	}
+	data.Identical = data.Sides[0].Tree.Root == data.Sides[1].Tree.Root
+
+	ew := &errWriter{w: w}
+	if err := reportTemplate.Execute(ew, data); err != nil {
+		return err
+	}
+	return ew.err
+}
+
+// WriteSnapshotDiffReport is WriteDiffReport for two JSON snapshots, restored with
+// hf (nil for the default hash function).
+func WriteSnapshotDiffReport(ctx context.Context, w io.Writer, local, remote *MerkleTreeSnapshot, hf HashFactory, opts ReportOptions) error {
+	lb, err := local.FromSnapshot(hf)
+	if err != nil {
+		return fmt.Errorf("failed to restore local snapshot: %w", err)
+	}
+	rb, err := remote.FromSnapshot(hf)
+	if err != nil {
+		return fmt.Errorf("failed to restore remote snapshot: %w", err)
+	}
+	return WriteDiffReport(ctx, w, lb, rb, opts)
+}
+
+type reportData struct {
+	Title     string
+	Identical bool
+	Result    DiffResult
+	Sides     [2]reportSide
+}
+
+type reportSide struct {
+	Name string
+	Tree *renderTree
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"hex": func(h Hash32) string {
+		if h == (Hash32{}) {
+			return "—"
+		}
+		return hex.EncodeToString(h[:])
+	},
+	"short": shortHash,
+	"last": func(start uint64, count uint32) uint64 {
+		return start + uint64(count) - 1
+	},
+	"chunks": func(level int) uint64 {
+		return uint64(1) << uint(level)
+	},
+	"inc": func(i int) int { return i + 1 },
+}).Parse(reportHTML))
+
+const reportHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+code, .hash, td.num { font-family: Menlo, Consolas, monospace; font-size: 0.9em; }
+h1 { margin-bottom: 0.2em; }
+.verdict { font-size: 1.2em; font-weight: bold; padding: 0.4em 0.8em; display: inline-block; border-radius: 4px; }
+.same { background: #d4f4dd; color: #1b5e20; }
+.differs { background: #f4a6a6; color: #7f0000; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #f3f3f3; }
+td.num { text-align: right; }
+.sides { display: flex; gap: 2em; align-items: flex-start; }
+.side { flex: 1; min-width: 0; }
+ul.tree, ul.tree ul { list-style: none; padding-left: 1.2em; margin: 0; border-left: 1px dotted #aaa; }
+ul.tree { border-left: none; padding-left: 0; }
+.node { display: inline-block; margin: 2px 0; padding: 1px 6px; border-radius: 3px; border: 1px solid #8bc79a; background: #e9f7ec; }
+.node.bad { border-color: #cc0000; background: #f4a6a6; }
+.node.partial { border-style: dashed; }
+.more { color: #777; font-style: italic; }
+summary { cursor: pointer; }
+.legend span { margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="verdict {{if .Identical}}same{{else}}differs{{end}}">
+{{- if .Identical}}Identical{{else}}{{len .Result.Ranges}} differing range(s){{end -}}
+</p>
+{{- if .Result.Truncated}}
+<p><strong>Truncated:</strong> the diff stopped at its {{.Result.TruncatedBy}} limit; more ranges may differ.</p>
+{{- end}}
+
+<h2>Roots</h2>
+<table>
+<tr><th>Side</th><th>Total blocks</th><th>Block merge</th><th>Root</th></tr>
+{{- range .Sides}}
+<tr><td>{{.Name}}</td><td class="num">{{.Tree.TotalBlocks}}</td><td class="num">{{.Tree.BlockMerge}}</td><td class="hash">{{hex .Tree.Root}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Differing ranges</h2>
+{{- if .Result.Ranges}}
+<table>
+<tr><th>#</th><th>Kind</th><th>First height</th><th>Last height</th><th>Blocks</th><th>{{(index .Sides 0).Name}} root</th><th>{{(index .Sides 1).Name}} root</th></tr>
+{{- range $i, $r := .Result.Ranges}}
+<tr><td class="num">{{inc $i}}</td><td>{{$r.Kind}}</td><td class="num">{{$r.Start}}</td><td class="num">{{last $r.Start $r.Count}}</td><td class="num">{{$r.Count}}</td><td class="hash">{{hex $r.LocalRoot}}</td><td class="hash">{{hex $r.RemoteRoot}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>None.</p>
+{{- end}}
+
+<h2>Peaks</h2>
+<div class="sides">
+{{- range .Sides}}
+<div class="side">
+<h3>{{.Name}}</h3>
+<table>
+<tr><th>Peak</th><th>Range</th><th>Blocks</th><th>Root</th></tr>
+{{- range .Tree.Peaks}}
+<tr><td>L{{.Level}} ({{chunks .Level}} chunks)</td><td class="num">{{.Start}} … {{last .Start .Count}}</td><td class="num">{{.Count}}</td><td class="hash"><span class="node{{if .Differs}} bad{{end}}">{{short .Root}}</span></td></tr>
+{{- end}}
+{{- with .Tree.Partial}}
+<tr><td>partial</td><td class="num">{{.Start}} … {{last .Start .Count}}</td><td class="num">{{.Count}}</td><td class="hash"><span class="node partial{{if .Differs}} bad{{end}}">{{short .Root}}</span></td></tr>
+{{- end}}
+</table>
+</div>
+{{- end}}
+</div>
+
+<h2>Trees</h2>
+<p class="legend"><span class="node">matching</span><span class="node bad">differs</span><span class="node partial">uncommitted partial chunk</span></p>
+<div class="sides">
+{{- range .Sides}}
+<div class="side">
+<h3>{{.Name}} <span class="hash">{{short .Tree.Root}}</span></h3>
+<ul class="tree">
+{{- range .Tree.Peaks}}{{template "node" .}}{{end}}
+{{- with .Tree.Partial}}{{template "node" .}}{{end}}
+</ul>
+</div>
+{{- end}}
+</div>
+</body>
+</html>
+{{define "label" -}}
+<span class="node{{if .Partial}} partial{{end}}{{if .Differs}} bad{{end}}">
+{{- if .Partial}}partial{{else if .Leaf}}chunk{{else}}L{{.Level}}{{end}} [{{.Start}} … {{last .Start .Count}}] · {{.Count}} blocks · <span class="hash">{{short .Root}}</span></span>
+{{- end}}
+{{define "node"}}
+<li>
+{{- if or .Children .Truncated}}<details{{if .Differs}} open{{end}}><summary>{{template "label" .}}</summary>
+<ul>
+{{- range .Children}}{{template "node" .}}{{end}}
+{{- if .Truncated}}
+<li class="more">… {{chunks .Level}} chunks</li>
+{{- end}}
+</ul>
+</details>
+{{- else}}{{template "label" .}}{{end -}}
+</li>
+{{- end}}
+`
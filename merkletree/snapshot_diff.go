@@ -0,0 +1,150 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DiffSnapshot reports the ranges TreeDiff would report between local and the
+// builder remote was taken from, without restoring it: snapshot nodes are converted
+// only when the traversal descends into them, and subtrees whose roots match are
+// never touched. The remote hash function is assumed to be local's; snapshots of
+// another domain are rejected with ErrDomainMismatch.
+func DiffSnapshot(local *Builder, remote *MerkleTreeSnapshot) ([]DiffRange, error) {
+	res, err := Differ{}.DiffSnapshot(context.Background(), local, remote)
+	if err != nil {
+		return nil, err
+	}
+	return res.Ranges, nil
+}
+
+// DiffSnapshotReader is DiffSnapshot for a binary snapshot read lazily.
+func DiffSnapshotReader(local *Builder, remote *SnapshotReader) ([]DiffRange, error) {
+	res, err := Differ{}.DiffReader(context.Background(), local, remote)
+	if err != nil {
+		return nil, err
+	}
+	return res.Ranges, nil
+}
+
+// DiffSnapshot is Diff against a JSON snapshot of the remote tree (see the
+// package-level DiffSnapshot).
+func (d Differ) DiffSnapshot(ctx context.Context, local *Builder, remote *MerkleTreeSnapshot) (DiffResult, error) {
+	d = d.observed(local)
+	if err := checkDomain("remote snapshot", remote.Config.Domain, local.cfg.Domain); err != nil {
+		return DiffResult{}, err
+	}
+	s1, err := d.localSide(local)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	s2, err := snapshotSide(d, remote, local.hf)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to read remote snapshot: %w", err)
+	}
+	return d.run(ctx, s1, s2)
+}
+
+// DiffReader is Diff against a binary snapshot read lazily.
+func (d Differ) DiffReader(ctx context.Context, local *Builder, remote *SnapshotReader) (DiffResult, error) {
+	d = d.observed(local)
+	if err := checkDomain("remote snapshot", remote.domain, local.cfg.Domain); err != nil {
+		return DiffResult{}, err
+	}
+	s1, err := d.localSide(local)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	s2, err := remote.side(d)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to read remote snapshot: %w", err)
+	}
+	return d.run(ctx, s1, s2)
+}
+
+func (d Differ) localSide(b *Builder) (diffSide, error) {
+	f, err := d.forest(b.outer.peaks, b.outer.leafCount, b.partialLeaf(), b.hf)
+	if err != nil {
+		return diffSide{}, fmt.Errorf("failed to get root node for self: %w", err)
+	}
+	return diffSide{forest: f}, nil
+}
+
+// snapshotSide returns the diff view of a JSON snapshot, converting nodes on demand.
+func snapshotSide(d Differ, s *MerkleTreeSnapshot, hf HashFactory) (diffSide, error) {
+	if s.Version != 1 && s.Version != 2 {
+		return diffSide{}, fmt.Errorf("unsupported snapshot version: %d", s.Version)
+	}
+
+	var mu sync.Mutex
+	refs := make(map[*Node]*SnapshotNode)
+	header := func(sn *SnapshotNode) (*Node, error) {
+		if sn == nil {
+			return nil, nil
+		}
+		n := &Node{Metadata: Metadata{Start: sn.Start, Count: sn.Count}, HasData: sn.HasData, Gap: sn.HasData && sn.Gap}
+		if len(sn.Root) != 32 {
+			return nil, errors.New("invalid root hash length in snapshot")
+		}
+		copy(n.Root[:], sn.Root)
+		if sn.HasData {
+			if len(sn.Data) != 32 {
+				return nil, errors.New("invalid data hash length in snapshot")
+			}
+			copy(n.Data[:], sn.Data)
+		}
+		refs[n] = sn
+		return n, nil
+	}
+
+	peaks := make([]*Node, len(s.Peaks))
+	var leafCount uint64
+	for level, sn := range s.Peaks {
+		p, err := header(sn)
+		if err != nil {
+			return diffSide{}, err
+		}
+		if p != nil {
+			peaks[level] = p
+			leafCount += 1 << uint(level)
+		}
+	}
+
+	var partial *Node
+	if len(s.InChunkElems) > 0 {
+		elems := make([]Hash32, len(s.InChunkElems))
+		for i, e := range s.InChunkElems {
+			if len(e) != 32 {
+				return diffSide{}, fmt.Errorf("invalid hash length in partial chunk: %d", len(e))
+			}
+			copy(elems[i][:], e)
+		}
+		partial = newChunkLeaf(hf, s.InChunkStart, elems, true)
+	}
+
+	forest, err := d.forest(peaks, leafCount, partial, hf)
+	if err != nil {
+		return diffSide{}, err
+	}
+
+	expand := func(n *Node) (*Node, *Node, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		sn, ok := refs[n]
+		if !ok {
+			return n.Left, n.Right, nil
+		}
+		left, err := header(sn.Left)
+		if err != nil {
+			return nil, nil, err
+		}
+		right, err := header(sn.Right)
+		if err != nil {
+			return nil, nil, err
+		}
+		return left, right, nil
+	}
+	return diffSide{forest: forest, expand: expand}, nil
+}
@@ -0,0 +1,256 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrMalformedSnapshot is returned when a snapshot read lazily turns out to be
+// truncated or inconsistent.
+var ErrMalformedSnapshot = errors.New("malformed snapshot")
+
+// maxLazyLevel bounds the peak levels accepted by SnapshotReader; a single peak of
+// that level would already take petabytes of encoding.
+const maxLazyLevel = 48
+
+// SnapshotReader gives read-only, lazy access to a binary snapshot produced by
+// Builder.Snapshot. Only the header, the partial chunk and the peak node headers are
+// decoded up front; the rest of the tree is read straight from the encoded bytes
+// when a diff descends into it. Subtrees whose roots match are skipped without
+// being decoded, so diffing against a snapshot costs little more than holding its
+// bytes.
+//
+// Peaks built by a Builder are perfect binary trees, so the position of every node
+// follows from its level; each node read is checked against its parent and
+// ErrMalformedSnapshot is returned on mismatch.
+//
+// A SnapshotReader keeps a reference to data, which must not be modified while the
+// reader is in use. It is safe for concurrent use.
+type SnapshotReader struct {
+	data   []byte
+	hf     HashFactory // with the domain mixed in
+	domain []byte
+
+	blockMerge   int
+	allowGaps    bool
+	totalBlocks  uint64
+	inChunkStart uint64
+	inChunkElems []Hash32
+
+	leafCount uint64
+	peaks     []*Node // headers only, by level
+	offsets   []int   // encoded offset of each peak, by level
+}
+
+// NewSnapshotReader parses the header of a binary snapshot. hf must be the hash
+// function the snapshot was built with (nil for the default), without the domain:
+// the domain recorded in the snapshot is applied to it.
+func NewSnapshotReader(data []byte, hf HashFactory) (*SnapshotReader, error) {
+	r := &SnapshotReader{data: data}
+	c := lazyCursor{data: data}
+
+	switch v := c.byte(); {
+	case c.err != nil, v == tagSnapshotV1:
+	case v == tagSnapshotV2:
+		n := c.u32()
+		if c.err == nil && int64(n) > int64(len(data)-c.off) {
+			return nil, fmt.Errorf("snapshot domain length %d exceeds snapshot: %w", n, ErrMalformedSnapshot)
+		}
+		r.domain = bytes.Clone(c.bytes(int(n)))
+	default:
+		return nil, fmt.Errorf("unsupported snapshot version: %x", v)
+	}
+	r.hf = DomainHashFactory(hf, r.domain)
+	r.blockMerge = int(c.u32())
+	flags := c.byte()
+	if c.err == nil && flags&^(snapshotEnforceHeights|snapshotAllowGaps) != 0 {
+		return nil, fmt.Errorf("unknown snapshot flags %#x: %w", flags, ErrMalformedSnapshot)
+	}
+	if flags&snapshotEnforceHeights != 0 {
+		c.u64() // expected next height
+	}
+	r.allowGaps = flags&snapshotAllowGaps != 0
+	r.totalBlocks = c.u64()
+	r.inChunkStart = c.u64()
+	n := c.u32()
+	if c.err == nil && int(n) > r.blockMerge {
+		return nil, fmt.Errorf("snapshot inChunkCount %d > blockMerge %d: %w", n, r.blockMerge, ErrMalformedSnapshot)
+	}
+	for i := 0; i < int(n) && c.err == nil; i++ {
+		var e Hash32
+		copy(e[:], c.bytes(32))
+		r.inChunkElems = append(r.inChunkElems, e)
+	}
+
+	r.leafCount = c.u64()
+	levels := c.u32()
+	if c.err == nil && levels > maxLazyLevel {
+		return nil, fmt.Errorf("snapshot has %d peak levels: %w", levels, ErrMalformedSnapshot)
+	}
+	var leaves uint64
+	for level := 0; level < int(levels) && c.err == nil; level++ {
+		off := c.off
+		if c.byte() == nodeTagNil {
+			r.peaks = append(r.peaks, nil)
+			r.offsets = append(r.offsets, off)
+			continue
+		}
+		p, err := r.node(off, level)
+		if err != nil {
+			return nil, err
+		}
+		r.peaks = append(r.peaks, p)
+		r.offsets = append(r.offsets, off)
+		leaves += 1 << uint(level)
+		c.off = off + int(lazySubtreeSize(level))
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.off != len(data) {
+		return nil, fmt.Errorf("%d trailing bytes: %w", len(data)-c.off, ErrMalformedSnapshot)
+	}
+	if leaves != r.leafCount {
+		return nil, fmt.Errorf("peaks hold %d chunks, header says %d: %w", leaves, r.leafCount, ErrMalformedSnapshot)
+	}
+	return r, nil
+}
+
+// BlockMerge returns the chunk size the snapshot was built with.
+func (r *SnapshotReader) BlockMerge() int { return r.blockMerge }
+
+// AllowGaps reports whether the snapshot was built with Config.AllowGaps.
+func (r *SnapshotReader) AllowGaps() bool { return r.allowGaps }
+
+// Domain returns a copy of the Config.Domain the snapshot was built with (nil if
+// unset).
+func (r *SnapshotReader) Domain() []byte { return bytes.Clone(r.domain) }
+
+// TotalBlocks returns the number of blocks in the snapshot.
+func (r *SnapshotReader) TotalBlocks() uint64 { return r.totalBlocks }
+
+// Root returns the root Finalize would return for the snapshotted builder.
+func (r *SnapshotReader) Root() (Hash32, error) {
+	f, err := Differ{Traversal: TraverseRoot}.forest(r.peaks, r.leafCount, r.partialLeaf(), r.hf)
+	if err != nil || f[0] == nil {
+		return Hash32{}, err
+	}
+	return f[0].Root, nil
+}
+
+func (r *SnapshotReader) partialLeaf() *Node {
+	if len(r.inChunkElems) == 0 {
+		return nil
+	}
+	return newChunkLeaf(r.hf, r.inChunkStart, r.inChunkElems, true)
+}
+
+// side returns the diff view of the snapshot. Node positions are tracked per
+// diff, so nothing decoded for one diff outlives it.
+func (r *SnapshotReader) side(d Differ) (diffSide, error) {
+	forest, err := d.forest(r.peaks, r.leafCount, r.partialLeaf(), r.hf)
+	if err != nil {
+		return diffSide{}, err
+	}
+
+	type ref struct{ off, level int }
+	var mu sync.Mutex
+	refs := make(map[*Node]ref)
+	for level, p := range r.peaks {
+		if p != nil {
+			refs[p] = ref{r.offsets[level], level}
+		}
+	}
+
+	expand := func(n *Node) (*Node, *Node, error) {
+		mu.Lock()
+		at, ok := refs[n]
+		mu.Unlock()
+		if !ok {
+			// Built in memory, e.g. a fold node above the peaks.
+			return n.Left, n.Right, nil
+		}
+
+		leftOff := at.off + encodedInternalSize
+		rightOff := leftOff + int(lazySubtreeSize(at.level-1))
+		left, err := r.node(leftOff, at.level-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		right, err := r.node(rightOff, at.level-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if left.Metadata.Start != n.Metadata.Start ||
+			right.Metadata.Start != left.Metadata.Start+uint64(left.Metadata.Count) ||
+			uint64(left.Metadata.Count)+uint64(right.Metadata.Count) != uint64(n.Metadata.Count) {
+			return nil, nil, fmt.Errorf("children of node at offset %d do not cover it: %w", at.off, ErrMalformedSnapshot)
+		}
+
+		mu.Lock()
+		refs[left] = ref{leftOff, at.level - 1}
+		refs[right] = ref{rightOff, at.level - 1}
+		mu.Unlock()
+		return left, right, nil
+	}
+	return diffSide{forest: forest, expand: expand}, nil
+}
+
+// node decodes the header of the node at off, which must be the root of a perfect
+// subtree of the given level (a chunk leaf at level 0).
+func (r *SnapshotReader) node(off, level int) (*Node, error) {
+	if level < 0 || uint64(off)+lazySubtreeSize(level) > uint64(len(r.data)) {
+		return nil, fmt.Errorf("level %d subtree at offset %d exceeds %d bytes: %w", level, off, len(r.data), ErrMalformedSnapshot)
+	}
+	c := lazyCursor{data: r.data, off: off}
+	tag := c.byte()
+	want := byte(nodeTagInternal)
+	if level == 0 {
+		want = nodeTagLeaf
+	}
+	if tag != want && (level != 0 || tag != nodeTagGap) {
+		return nil, fmt.Errorf("node tag %x at offset %d, want %x: %w", tag, off, want, ErrMalformedSnapshot)
+	}
+
+	n := &Node{Metadata: Metadata{Start: c.u64(), Count: c.u32()}}
+	copy(n.Root[:], c.bytes(32))
+	if level == 0 {
+		copy(n.Data[:], c.bytes(32))
+		n.HasData = true
+		n.Gap = tag == nodeTagGap
+	}
+	return n, nil
+}
+
+// lazySubtreeSize is the encoded size of a perfect subtree of the given level.
+func lazySubtreeSize(level int) uint64 {
+	leaves := uint64(1) << uint(level)
+	return (leaves-1)*encodedInternalSize + leaves*encodedLeafSize
+}
+
+// lazyCursor reads little-endian fields from a byte slice, remembering the first
+// out-of-bounds read.
+type lazyCursor struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (c *lazyCursor) bytes(n int) []byte {
+	if c.err != nil || c.off+n > len(c.data) {
+		if c.err == nil {
+			c.err = fmt.Errorf("truncated at offset %d: %w", c.off, ErrMalformedSnapshot)
+		}
+		return make([]byte, n)
+	}
+	b := c.data[c.off : c.off+n]
+	c.off += n
+	return b
+}
+
+func (c *lazyCursor) byte() byte  { return c.bytes(1)[0] }
+func (c *lazyCursor) u32() uint32 { return binary.LittleEndian.Uint32(c.bytes(4)) }
+func (c *lazyCursor) u64() uint64 { return binary.LittleEndian.Uint64(c.bytes(8)) }
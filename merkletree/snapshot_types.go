@@ -28,6 +28,12 @@ type MerkleTreeSnapshot struct {
 type SnapshotConfig struct {
 	BlockMerge    int    `json:"block_merge"`
 	ExpectedTotal uint64 `json:"expected_total"`
+	// RetainElements mirrors Config.RetainElements; leaves then carry Elems.
+	RetainElements bool `json:"retain_elements,omitempty"`
+	// Domain mirrors Config.Domain; it is set only in version 2 snapshots.
+	Domain []byte `json:"domain,omitempty"`
+	// AllowGaps mirrors Config.AllowGaps.
+	AllowGaps bool `json:"allow_gaps,omitempty"`
 }
 
 // SnapshotNode is a recursive struct for the Merkle Tree nodes.
@@ -39,4 +45,6 @@ type SnapshotNode struct {
 	Count   uint32        `json:"count"`
 	Data    []byte        `json:"data,omitempty"` // For leaves, this matches Root
 	HasData bool          `json:"has_data"`
+	Elems   [][]byte      `json:"elems,omitempty"` // Retained element hashes of a chunk leaf
+	Gap     bool          `json:"gap,omitempty"`   // Gap leaf (Config.AllowGaps)
 }
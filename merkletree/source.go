@@ -0,0 +1,50 @@
+package merkletree
+
+import (
+	"context"
+	"fmt"
+)
+
+// NodeSource is a tree whose nodes are fetched on demand, such as a peer's tree
+// served over the network. Nodes carry their range and root; their children are
+// left nil and read through Children only when a diff descends into them.
+type NodeSource interface {
+	// Domain returns the remote tree's Config.Domain (nil if unset).
+	Domain(ctx context.Context) ([]byte, error)
+	// RootNode returns the root Finalize would return, or nil for an empty tree.
+	RootNode(ctx context.Context) (*Node, error)
+	// Children returns the children of an internal node returned by RootNode or
+	// Children.
+	Children(ctx context.Context, n *Node) (left, right *Node, err error)
+}
+
+// DiffSource is Diff against a remote tree read through src. Only the nodes on
+// differing paths are fetched; with Concurrency > 1, Children is called from
+// several goroutines. The remote side always starts from its root, whatever the
+// Traversal, so DiffFirst is a remote bisection. A remote tree of another
+// domain is rejected with ErrDomainMismatch before any node is fetched.
+func (d Differ) DiffSource(ctx context.Context, local *Builder, src NodeSource) (DiffResult, error) {
+	domain, err := src.Domain(ctx)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to read remote domain: %w", err)
+	}
+	if err := checkDomain("remote", domain, local.cfg.Domain); err != nil {
+		return DiffResult{}, err
+	}
+	d = d.observed(local)
+	s1, err := d.localSide(local)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	root, err := src.RootNode(ctx)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to read remote root: %w", err)
+	}
+	s2 := diffSide{
+		forest: []*Node{root},
+		expand: func(n *Node) (*Node, *Node, error) {
+			return src.Children(ctx, n)
+		},
+	}
+	return d.run(ctx, s1, s2)
+}
@@ -0,0 +1,258 @@
+package merkletree
+
+import (
+	"encoding/base64"
+	"math/bits"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// Stats describes the size and shape of a Builder, for monitoring and for
+// enforcing memory budgets. See Builder.Stats.
+type Stats struct {
+	TotalBlocks      uint64 `json:"total_blocks"`
+	BlockMerge       int    `json:"block_merge"`
+	CommittedChunks  uint64 `json:"committed_chunks"`
+	PartialChunkFill int    `json:"partial_chunk_fill"` // blocks buffered in the uncommitted chunk
+	// GapHeights counts the heights covered by gap leaves (Config.AllowGaps);
+	// CommittedChunks includes those leaves.
+	GapHeights uint64 `json:"gap_heights,omitempty"`
+
+	// Peaks lists the committed peaks, oldest (leftmost) first.
+	Peaks []PeakStats `json:"peaks"`
+
+	// Nodes counts the outer tree nodes held by the peaks (chunk leaves included);
+	// RetainedElements counts the element hashes kept on leaves by
+	// Config.RetainElements.
+	Nodes            uint64 `json:"nodes"`
+	RetainedElements uint64 `json:"retained_elements"`
+	// MemoryBytes approximates the heap held by the builder: nodes, retained
+	// elements and the partial chunk buffer. Nodes shared with a Fork are counted
+	// by both builders.
+	MemoryBytes uint64 `json:"memory_bytes"`
+
+	// BinarySnapshotBytes is the exact length of Snapshot(); JSONSnapshotBytes is
+	// the length of ToSnapshot() encoded by encoding/json without indentation.
+	BinarySnapshotBytes uint64 `json:"binary_snapshot_bytes"`
+	JSONSnapshotBytes   uint64 `json:"json_snapshot_bytes"`
+
+	Hashing HashStats `json:"hashing"`
+}
+
+// PeakStats describes one committed peak.
+type PeakStats struct {
+	Level int    `json:"level"` // the peak covers 2^Level chunks
+	Start uint64 `json:"start"`
+	Count uint32 `json:"count"`
+	Root  Hash32 `json:"root"`
+}
+
+// HashStats counts the digests a Builder computed while ingesting blocks. The
+// counters start at zero in NewBuilder, Restore and Fork; digests computed only
+// to answer queries (Finalize's fold over the peaks, proofs, diffs) are not
+// counted.
+type HashStats struct {
+	ElementDigests uint64 `json:"element_digests"` // one per pushed block
+	ChunkDigests   uint64 `json:"chunk_digests"`   // one per committed chunk
+	GapDigests     uint64 `json:"gap_digests"`     // one per gap leaf (Config.AllowGaps)
+	NodeDigests    uint64 `json:"node_digests"`    // one per merge of two peaks
+	BytesHashed    uint64 `json:"bytes_hashed"`
+	// PushTime is the wall time spent inside Push.
+	PushTime time.Duration `json:"push_time_ns"`
+}
+
+// BlocksPerSecond is the ingestion throughput of Push, or 0 before any push.
+func (h HashStats) BlocksPerSecond() float64 {
+	if h.PushTime <= 0 {
+		return 0
+	}
+	return float64(h.ElementDigests) / h.PushTime.Seconds()
+}
+
+// Bytes fed to the hash function for each digest (see the Hashing primitives).
+const (
+	elemDigestInput  = 1 + 8 + 32
+	chunkDigestInput = 1 + 8 + 4 + 32
+	gapDigestInput   = 1 + 8 + 4
+	nodeDigestInput  = 1 + 8 + 4 + 32 + 32
+)
+
+// Heap cost of the structures Stats estimates.
+const (
+	nodeSize = uint64(unsafe.Sizeof(Node{}))
+	hashSize = uint64(unsafe.Sizeof(Hash32{}))
+)
+
+// Stats reports the current size and shape of the tree. It visits every retained
+// node, so it costs O(#chunks); the builder is not modified.
+func (b *Builder) Stats() Stats {
+	s := Stats{
+		TotalBlocks:      b.totalBlocks,
+		BlockMerge:       b.cfg.BlockMerge,
+		CommittedChunks:  b.outer.leafCount,
+		PartialChunkFill: len(b.inChunkElems),
+		GapHeights:       b.gaps,
+		Hashing:          b.hashing,
+	}
+
+	// Binary: tag, blockMerge, enforce flag [+ next height], total, partial chunk,
+	// leaf count and peak count, then each peak slot.
+	s.BinarySnapshotBytes = 1 + 4 + 1 + 8 + 8 + 4 + uint64(len(b.inChunkElems))*hashSize + 8 + 4
+	if b.enforceHeights {
+		s.BinarySnapshotBytes += 8
+	}
+	if len(b.cfg.Domain) > 0 {
+		s.BinarySnapshotBytes += 4 + uint64(len(b.cfg.Domain))
+	}
+
+	// JSON: the MerkleTreeSnapshot fields, in declaration order.
+	js := jsonSizer{}
+	js.add(`{"version":1,"config":{"block_merge":`)
+	js.uint(uint64(b.cfg.BlockMerge))
+	js.add(`,"expected_total":`)
+	js.uint(b.cfg.ExpectedTotal)
+	if b.cfg.RetainElements {
+		js.add(`,"retain_elements":true`)
+	}
+	if len(b.cfg.Domain) > 0 {
+		js.add(`,"domain":""`)
+		js.n += uint64(base64.StdEncoding.EncodedLen(len(b.cfg.Domain)))
+	}
+	if b.cfg.AllowGaps {
+		js.add(`,"allow_gaps":true`)
+	}
+	js.add(`},"total_blocks":`)
+	js.uint(b.totalBlocks)
+	js.add(`,"expected_next_height":`)
+	js.uint(b.expectedNextHeight)
+	js.add(`,"enforce_heights":` + strconv.FormatBool(b.enforceHeights))
+	js.add(`,"in_chunk_elems":`)
+	js.hashes(len(b.inChunkElems))
+	js.add(`,"in_chunk_start":`)
+	js.uint(b.inChunkStart)
+	js.add(`,"peaks":[`)
+
+	for level, p := range b.outer.peaks {
+		if level > 0 {
+			js.add(",")
+		}
+		if p == nil {
+			s.BinarySnapshotBytes++
+			js.add("null")
+			continue
+		}
+		s.Peaks = append(s.Peaks, PeakStats{Level: level, Start: p.Metadata.Start, Count: p.Metadata.Count, Root: p.Root})
+		s.statNode(p, &js)
+	}
+	js.add("]}")
+	s.JSONSnapshotBytes = js.n
+
+	// Peaks are stored newest first.
+	for i, j := 0, len(s.Peaks)-1; i < j; i, j = i+1, j-1 {
+		s.Peaks[i], s.Peaks[j] = s.Peaks[j], s.Peaks[i]
+	}
+
+	s.MemoryBytes = uint64(unsafe.Sizeof(*b)) +
+		s.Nodes*nodeSize +
+		s.RetainedElements*hashSize +
+		uint64(cap(b.inChunkElems))*hashSize +
+		uint64(cap(b.outer.peaks))*uint64(unsafe.Sizeof((*Node)(nil)))
+	return s
+}
+
+// statNode adds n's subtree to the node counts and snapshot sizes.
+func (s *Stats) statNode(n *Node, js *jsonSizer) {
+	s.Nodes++
+	if n.HasData {
+		s.RetainedElements += uint64(len(n.Elems))
+		s.BinarySnapshotBytes += encodedLeafSize
+
+		js.add(`{"root":`)
+		js.hash()
+		js.add(`,"start":`)
+		js.uint(n.Metadata.Start)
+		js.add(`,"count":`)
+		js.uint(uint64(n.Metadata.Count))
+		js.add(`,"data":`)
+		js.hash()
+		js.add(`,"has_data":true`)
+		if len(n.Elems) > 0 {
+			js.add(`,"elems":`)
+			js.hashes(len(n.Elems))
+		}
+		if n.Gap {
+			js.add(`,"gap":true`)
+		}
+		js.add("}")
+		return
+	}
+
+	s.BinarySnapshotBytes += encodedInternalSize
+	js.add("{")
+	for _, c := range []struct {
+		key string
+		n   *Node
+	}{{`"left":`, n.Left}, {`"right":`, n.Right}} {
+		if c.n == nil {
+			// A missing child is a nil tag in the binary form and omitted in JSON.
+			s.BinarySnapshotBytes++
+			continue
+		}
+		js.add(c.key)
+		s.statNode(c.n, js)
+		js.add(",")
+	}
+	js.add(`"root":`)
+	js.hash()
+	js.add(`,"start":`)
+	js.uint(n.Metadata.Start)
+	js.add(`,"count":`)
+	js.uint(uint64(n.Metadata.Count))
+	js.add(`,"has_data":false}`)
+}
+
+// jsonSizer measures JSON output without producing it.
+type jsonSizer struct{ n uint64 }
+
+func (j *jsonSizer) add(s string) { j.n += uint64(len(s)) }
+
+func (j *jsonSizer) uint(v uint64) {
+	j.n++
+	for v >= 10 {
+		v /= 10
+		j.n++
+	}
+}
+
+// hash is a quoted base64 Hash32, as encoding/json writes a []byte.
+func (j *jsonSizer) hash() { j.n += 2 + 44 }
+
+// hashes is an array of count hashes.
+func (j *jsonSizer) hashes(count int) {
+	j.n += 2
+	if count > 0 {
+		j.n += uint64(count)*(2+44) + uint64(count-1)
+	}
+}
+
+// countDigests records the digests computed by committing one chunk to an
+// accumulator that held leafCount leaves: the chunk digest, then one node digest
+// per merge, i.e. per trailing one bit of leafCount. It returns the merges.
+func (h *HashStats) countDigests(leafCount uint64) uint64 {
+	merges := uint64(bits.TrailingZeros64(^leafCount))
+	h.ChunkDigests++
+	h.NodeDigests += merges
+	h.BytesHashed += chunkDigestInput + merges*nodeDigestInput
+	return merges
+}
+
+// countGapDigests is countDigests for a gap leaf, whose digest covers only its
+// range.
+func (h *HashStats) countGapDigests(leafCount uint64) uint64 {
+	merges := uint64(bits.TrailingZeros64(^leafCount))
+	h.GapDigests++
+	h.NodeDigests += merges
+	h.BytesHashed += gapDigestInput + merges*nodeDigestInput
+	return merges
+}
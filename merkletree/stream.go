@@ -0,0 +1,51 @@
+package merkletree
+
+import (
+	"context"
+	"iter"
+)
+
+// DiffSeq returns an iterator over the ranges TreeDiff would report, yielded in
+// ascending height order as the traversal finds them. Callers can start acting on
+// the first ranges immediately and stop early by breaking out of the loop:
+//
+//	for d, err := range local.DiffSeq(remote) {
+//		if err != nil { ... }
+//		fetch(d.Start, d.Count)
+//	}
+func (b *Builder) DiffSeq(other *Builder) iter.Seq2[DiffRange, error] {
+	return Differ{Strategy: DiffAll, Traversal: TraverseRoot}.Seq(b, other)
+}
+
+// RootView returns the root node the tree would have after Finalize (nil for an
+// empty tree), without committing the partial chunk: the builder is not modified.
+func (b *Builder) RootView() (*Node, error) {
+	acc, err := b.finalizedOuter()
+	if err != nil {
+		return nil, err
+	}
+	return acc.RootNode(), nil
+}
+
+// finalizedOuter returns a copy of the outer accumulator with the partial chunk
+// added as a leaf, i.e. the accumulator Finalize would produce, leaving b untouched.
+func (b *Builder) finalizedOuter() (peaksAccumulator, error) {
+	acc := b.outer.fork()
+	if p := b.partialLeaf(); p != nil {
+		if err := acc.AddLeaf(p); err != nil {
+			return peaksAccumulator{}, err
+		}
+	}
+	return acc, nil
+}
+
+// MultiBisectStream is the streaming counterpart of MultiBisect. Differing subtrees
+// are traversed concurrently by up to concurrency workers, but results are emitted on
+// the returned channel in ascending height order (adjacent ranges of the same kind
+// merged, as in MultiBisect), as soon as every range before them is known.
+//
+// The range channel is closed when the traversal completes or ctx is cancelled; the
+// error channel then receives ctx.Err() (if cancelled) and is closed.
+func (b *Builder) MultiBisectStream(ctx context.Context, other *Builder, concurrency int) (<-chan DiffRange, <-chan error) {
+	return multiBisectDiffer(concurrency, DiffOptions{}).Stream(ctx, b, other)
+}
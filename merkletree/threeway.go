@@ -0,0 +1,99 @@
+package merkletree
+
+import "fmt"
+
+// ThreeWayKind classifies a differing range relative to a common base tree.
+type ThreeWayKind uint8
+
+const (
+	// ChangedLocal: local differs from base, remote still matches base.
+	ChangedLocal ThreeWayKind = iota
+	// ChangedRemote: remote differs from base, local still matches base.
+	ChangedRemote
+	// ChangedBoth: local and remote differ from base, but agree with each other.
+	ChangedBoth
+	// Conflict: local and remote both differ from base and from each other.
+	Conflict
+)
+
+var threeWayKindNames = [...]string{
+	ChangedLocal:  "changed_local",
+	ChangedRemote: "changed_remote",
+	ChangedBoth:   "changed_both",
+	Conflict:      "conflict",
+}
+
+func (k ThreeWayKind) String() string {
+	if int(k) < len(threeWayKindNames) {
+		return threeWayKindNames[k]
+	}
+	return fmt.Sprintf("ThreeWayKind(%d)", uint8(k))
+}
+
+func (k ThreeWayKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *ThreeWayKind) UnmarshalText(text []byte) error {
+	for i, name := range threeWayKindNames {
+		if name == string(text) {
+			*k = ThreeWayKind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown three-way kind %q", text)
+}
+
+// ThreeWayRange is a range where base, local and remote do not all agree.
+// A zero root means the corresponding tree does not cover the range.
+type ThreeWayRange struct {
+	Start  uint64       `json:"start"`
+	Count  uint32       `json:"count"`
+	Kind   ThreeWayKind `json:"kind"`
+	Base   Hash32       `json:"base"`
+	Local  Hash32       `json:"local"`
+	Remote Hash32       `json:"remote"`
+}
+
+// ThreeWayDiff compares local and remote against a common ancestor (typically the
+// last agreed checkpoint, restored from a snapshot) and classifies each differing
+// range as changed locally, changed remotely, changed identically on both sides, or
+// conflicting. Ranges appended after the base count as changes too.
+//
+// It is built on ConsensusDiff, so the same alignment requirements apply.
+func ThreeWayDiff(base, local, remote *Builder) ([]ThreeWayRange, error) {
+	ranges, err := ConsensusDiff([]*Builder{base, local, remote})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ThreeWayRange, 0, len(ranges))
+	for _, r := range ranges {
+		var roots [3]Hash32
+		for _, g := range r.Groups {
+			for _, p := range g.Peers {
+				roots[p] = g.Root
+			}
+		}
+
+		tw := ThreeWayRange{
+			Start:  r.Start,
+			Count:  r.Count,
+			Base:   roots[0],
+			Local:  roots[1],
+			Remote: roots[2],
+		}
+		switch {
+		case tw.Local == tw.Base:
+			tw.Kind = ChangedRemote
+		case tw.Remote == tw.Base:
+			tw.Kind = ChangedLocal
+		case tw.Local == tw.Remote:
+			tw.Kind = ChangedBoth
+		default:
+			tw.Kind = Conflict
+		}
+		out = append(out, tw)
+	}
+	return out, nil
+}
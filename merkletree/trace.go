@@ -0,0 +1,56 @@
+package merkletree
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Tracer starts spans around Builder and diff operations, so callers can plug in
+// their tracing system (e.g. an OpenTelemetry adapter). Attributes are given as
+// slog attributes to avoid a dependency on any tracing library.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// Span is one traced operation started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...slog.Attr)
+	RecordError(err error)
+	End()
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...slog.Attr) {}
+func (nopSpan) RecordError(error)          {}
+func (nopSpan) End()                       {}
+
+// startSpan starts a span with t, or returns a no-op span if t is nil.
+func startSpan(ctx context.Context, t Tracer, name string, attrs ...slog.Attr) (context.Context, Span) {
+	if t == nil {
+		return ctx, nopSpan{}
+	}
+	return t.Start(ctx, name, attrs...)
+}
+
+// endSpan records err, if any, and ends s.
+func endSpan(s Span, err error) {
+	if err != nil {
+		s.RecordError(err)
+	}
+	s.End()
+}
+
+// debugLogger returns l if it is set and logs debug records, or nil. Hot paths
+// resolve it once and test for nil, so disabled logging costs nothing.
+func debugLogger(ctx context.Context, l *slog.Logger) *slog.Logger {
+	if l == nil || !l.Enabled(ctx, slog.LevelDebug) {
+		return nil
+	}
+	return l
+}
+
+// rangeAttrs describes the height range [start, start+count).
+func rangeAttrs(start uint64, count uint32) []slog.Attr {
+	return []slog.Attr{slog.Uint64("start", start), slog.Uint64("count", uint64(count))}
+}
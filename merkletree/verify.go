@@ -0,0 +1,116 @@
+package merkletree
+
+import (
+	"fmt"
+)
+
+// Verify checks that the state of b is internally consistent, typically right after
+// restoring it from a snapshot received from elsewhere:
+//
+//   - each peak is a perfect tree of 2^level chunk leaves over contiguous ranges,
+//     the peaks follow each other, and the chunk count matches;
+//   - every internal root is the digest of its children, every leaf's Data matches
+//     its Root, and leaves with retained element hashes match their digest;
+//   - chunk sizes stay within BlockMerge, gap leaves (only with Config.AllowGaps)
+//     match their range, and the committed blocks plus the partial chunk add up
+//     to the block total.
+//
+// Chunk leaves without element hashes can only be checked against their parents, so
+// Verify proves consistency, not that the blocks themselves are right. Errors wrap
+// ErrMalformedSnapshot.
+func (b *Builder) Verify() error {
+	next := b.startHeight()
+	var leaves uint64
+	for level := len(b.outer.peaks) - 1; level >= 0; level-- {
+		p := b.outer.peaks[level]
+		if p == nil {
+			continue
+		}
+		if p.Metadata.Start != next {
+			return fmt.Errorf("peak level %d starts at %d, want %d: %w", level, p.Metadata.Start, next, ErrMalformedSnapshot)
+		}
+		if err := b.verifyNode(p, level); err != nil {
+			return err
+		}
+		next += uint64(p.Metadata.Count)
+		leaves += 1 << uint(level)
+	}
+	if leaves != b.outer.leafCount {
+		return fmt.Errorf("peaks hold %d chunks, accumulator says %d: %w", leaves, b.outer.leafCount, ErrMalformedSnapshot)
+	}
+
+	if len(b.inChunkElems) > 0 {
+		if len(b.inChunkElems) > b.cfg.BlockMerge {
+			return fmt.Errorf("partial chunk holds %d blocks, blockMerge is %d: %w", len(b.inChunkElems), b.cfg.BlockMerge, ErrMalformedSnapshot)
+		}
+		if b.outer.leafCount > 0 && b.inChunkStart != next {
+			return fmt.Errorf("partial chunk starts at %d, want %d: %w", b.inChunkStart, next, ErrMalformedSnapshot)
+		}
+		next = b.inChunkStart + uint64(len(b.inChunkElems))
+	}
+
+	gaps := b.countGaps()
+	if gaps != b.gaps {
+		return fmt.Errorf("gap leaves cover %d heights, builder says %d: %w", gaps, b.gaps, ErrMalformedSnapshot)
+	}
+	if total := next - b.startHeight() - gaps; total != b.totalBlocks {
+		return fmt.Errorf("tree covers %d blocks, total says %d: %w", total, b.totalBlocks, ErrMalformedSnapshot)
+	}
+	if b.enforceHeights && b.totalBlocks > 0 && b.expectedNextHeight != next {
+		return fmt.Errorf("next height %d, want %d: %w", b.expectedNextHeight, next, ErrMalformedSnapshot)
+	}
+	return nil
+}
+
+// verifyNode checks the subtree under n, which must hold 2^level chunk leaves.
+func (b *Builder) verifyNode(n *Node, level int) error {
+	at := func(format string, args ...any) error {
+		return fmt.Errorf("node [%d+%d]: %s: %w", n.Metadata.Start, n.Metadata.Count, fmt.Sprintf(format, args...), ErrMalformedSnapshot)
+	}
+
+	if level == 0 {
+		if !n.HasData || n.Left != nil || n.Right != nil {
+			return at("expected a chunk leaf")
+		}
+		if n.Gap {
+			if !b.cfg.AllowGaps {
+				return at("gap leaf without Config.AllowGaps")
+			}
+			if n.Metadata.Count == 0 || n.Elems != nil || n.Data != n.Root || gapDigest(b.hf, n.Metadata.Start, n.Metadata.Count) != n.Root {
+				return at("gap digest mismatch")
+			}
+			return nil
+		}
+		if n.Metadata.Count == 0 || int(n.Metadata.Count) > b.cfg.BlockMerge {
+			return at("chunk size outside 1..%d", b.cfg.BlockMerge)
+		}
+		if n.Data != n.Root {
+			return at("leaf data does not match root")
+		}
+		if n.Elems != nil {
+			if len(n.Elems) != int(n.Metadata.Count) {
+				return at("%d retained elements", len(n.Elems))
+			}
+			if chunkDigest(b.hf, n.Metadata.Start, n.Metadata.Count, n.Elems) != n.Root {
+				return at("chunk digest mismatch")
+			}
+		}
+		return nil
+	}
+
+	if n.HasData || n.Left == nil || n.Right == nil {
+		return at("expected an internal node at level %d", level)
+	}
+	l, r := n.Left, n.Right
+	if l.Metadata.Start != n.Metadata.Start || r.Metadata.Start != l.Metadata.Start+uint64(l.Metadata.Count) ||
+		uint64(l.Metadata.Count)+uint64(r.Metadata.Count) != uint64(n.Metadata.Count) {
+		return at("children do not cover the node")
+	}
+	if b.outer.combiner(b.hf, n.Metadata.Start, n.Metadata.Count, l.Root, r.Root) != n.Root {
+		return at("root does not match children")
+	}
+	if err := b.verifyNode(l, level-1); err != nil {
+		return err
+	}
+	return b.verifyNode(r, level-1)
+}
@@ -1,34 +1,49 @@
 package merkletree
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
 
 // Visualize prints the internal state of the Builder to stdout.
 // Since this is a streaming builder, it only stores:
 // 1. Attempts to visualize the current incomplete chunk (buffer).
 // 2. The "Peaks" of the outer Merkle Mountain Range (accumulator).
 // It does NOT store the history of all chunks, so it cannot print the full history.
+//
+// It is Render(os.Stdout, RenderText, RenderOptions{}); use Render to write elsewhere
+// or to draw the full tree.
 func (b *Builder) Visualize() {
-	fmt.Println()
-	fmt.Println("════════════ Merkle Builder State ════════════")
-	fmt.Printf("Total Blocks Processed : %d\n", b.totalBlocks)
+	_ = b.Render(os.Stdout, RenderText, RenderOptions{})
+}
+
+// renderText writes the Visualize view: totals, the partial chunk and the peaks.
+func (b *Builder) renderText(w io.Writer, opts RenderOptions) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "════════════ Merkle Builder State ════════════")
+	fmt.Fprintf(w, "Total Blocks Processed : %d\n", b.totalBlocks)
 
 	// ---- Partial chunk ----
 	if len(b.inChunkElems) > 0 {
 		start := b.inChunkStart
 		end := start + uint64(len(b.inChunkElems)) - 1
-		fmt.Printf("Partial Chunk          : %d / %d blocks\n", len(b.inChunkElems), b.cfg.BlockMerge)
-		fmt.Printf("  Range                : [%d … %d]\n", start, end)
+		fmt.Fprintf(w, "Partial Chunk          : %d / %d blocks\n", len(b.inChunkElems), b.cfg.BlockMerge)
+		fmt.Fprintf(w, "  Range                : [%d … %d]\n", start, end)
+		if opts.highlighted(start, uint32(len(b.inChunkElems))) {
+			fmt.Fprintf(w, "  Diff                 : differs\n")
+		}
 	} else {
-		fmt.Printf("Partial Chunk          : (empty)\n")
+		fmt.Fprintf(w, "Partial Chunk          : (empty)\n")
 	}
 
-	fmt.Println()
+	fmt.Fprintln(w)
 
 	// ---- Outer accumulator (MMR peaks) ----
-	fmt.Println("Outer Merkle Accumulator (MMR Peaks):")
+	fmt.Fprintln(w, "Outer Merkle Accumulator (MMR Peaks):")
 
 	if len(b.outer.peaks) == 0 {
-		fmt.Println("  (no committed chunks)")
+		fmt.Fprintln(w, "  (no committed chunks)")
 	} else {
 		found := false
 		for level, p := range b.outer.peaks {
@@ -42,19 +57,26 @@ func (b *Builder) Visualize() {
 			start := p.Metadata.Start
 			end := start + uint64(p.Metadata.Count) - 1
 
-			fmt.Printf("  ├─ Level %-2d  (%d chunks)\n", level, chunks)
-			fmt.Printf("  │    Range : [%d … %d]\n", start, end)
-			fmt.Printf("  │    Count : %d blocks\n", p.Metadata.Count)
-			fmt.Printf("  │    Hash  : %s\n", shortHash(p.Root))
+			if p.Gap {
+				fmt.Fprintf(w, "  ├─ Level %-2d  (gap)\n", level)
+			} else {
+				fmt.Fprintf(w, "  ├─ Level %-2d  (%d chunks)\n", level, chunks)
+			}
+			fmt.Fprintf(w, "  │    Range : [%d … %d]\n", start, end)
+			fmt.Fprintf(w, "  │    Count : %d blocks\n", p.Metadata.Count)
+			fmt.Fprintf(w, "  │    Hash  : %s\n", shortHash(p.Root))
+			if opts.highlighted(start, p.Metadata.Count) {
+				fmt.Fprintf(w, "  │    Diff  : differs\n")
+			}
 		}
 
 		if !found {
-			fmt.Println("  (all peaks nil)")
+			fmt.Fprintln(w, "  (all peaks nil)")
 		}
 	}
 
-	fmt.Println("══════════════════════════════════════════════")
-	fmt.Println()
+	fmt.Fprintln(w, "══════════════════════════════════════════════")
+	fmt.Fprintln(w)
 }
 
 func shortHash(h Hash32) string {
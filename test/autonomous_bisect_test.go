@@ -2,7 +2,6 @@ package tests
 
 import (
 	"crypto/rand"
-	"fmt"
 	"testing"
 
 	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
@@ -25,7 +24,7 @@ func TestAutonomousBisection(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Snapshot failed: %v", err)
 	}
-	fmt.Printf("Snapshot Size: %d bytes\n", len(snapshot))
+	t.Logf("Snapshot Size: %d bytes", len(snapshot))
 
 	// 3. Setup: Create "Local" tree with ONE mismatch
 	localBuilder, _ := merkletree.NewBuilder(cfg)
@@ -47,19 +46,19 @@ func TestAutonomousBisection(t *testing.T) {
 	// 5. Run Bisection
 	// Local vs RestoredRemote
 	// If the snapshot contains the full tree, this should work perfectly.
-	fmt.Println("Running Autonomous Bisection...")
+	t.Log("Running Autonomous Bisection...")
 	start, bCount, err := localBuilder.Bisect(restoredRemote)
 	if err != nil {
 		t.Fatalf("Bisect failed: %v", err)
 	}
 
-	fmt.Printf("Mismatch identified at range [%d .. %d] (size %d)\n", start, start+uint64(bCount)-1, bCount)
+	t.Logf("Mismatch identified at range [%d .. %d] (size %d)", start, start+uint64(bCount)-1, bCount)
 
 	// 6. Verify
 	// Chunk size is 100 (BlockMerge).
 	// 5050 should be in range [5000 .. 5099].
 	if uint64(mismatchIndex) >= start && uint64(mismatchIndex) < start+uint64(bCount) {
-		fmt.Println("SUCCESS: Mismatch correctly identified.")
+		t.Log("SUCCESS: Mismatch correctly identified.")
 	} else {
 		t.Fatalf("FAILURE: Mismatch index %d NOT in range [%d .. %d]", mismatchIndex, start, start+uint64(bCount))
 	}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestBlockDiffAcrossBlockMerge(t *testing.T) {
+	count := 5000
+
+	hashes := make([]merkletree.Hash32, count)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+	mutated := make([]merkletree.Hash32, count)
+	copy(mutated, hashes)
+	for _, idx := range []int{7, 1234, 1235, 4999} {
+		mutated[idx][0] ^= 0xFF
+	}
+
+	// Different ExpectedTotal hints derive different BlockMerge values (25 vs 50).
+	b1, _ := merkletree.NewBuilder(merkletree.Config{ExpectedTotal: 5000, RetainElements: true})
+	b1.Push(0, hashes)
+	b2, _ := merkletree.NewBuilder(merkletree.Config{ExpectedTotal: 10000, RetainElements: true})
+	b2.Push(0, mutated)
+
+	// Plain TreeDiff sees nothing in common.
+	raw, _ := b1.Fork().TreeDiff(b2.Fork())
+	t.Logf("TreeDiff without normalization: %d ranges", len(raw))
+
+	diffs, err := b1.BlockDiff(b2)
+	if err != nil {
+		t.Fatalf("BlockDiff failed: %v", err)
+	}
+
+	want := []merkletree.DiffRange{{Start: 7, Count: 1}, {Start: 1234, Count: 2}, {Start: 4999, Count: 1}}
+	for _, d := range diffs {
+		if d.Kind != merkletree.DiffMismatch {
+			t.Errorf("Expected mismatch kind, got %v for %+v", d.Kind, d)
+		}
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("Expected %d ranges, got %v", len(want), diffs)
+	}
+	for i := range want {
+		if diffs[i].Start != want[i].Start || diffs[i].Count != want[i].Count {
+			t.Errorf("Range %d: got %+v want %+v", i, diffs[i], want[i])
+		}
+	}
+
+	// Builders are untouched.
+	if st := b1.State(); st.TotalBlocks != uint64(count) {
+		t.Errorf("b1 modified: %+v", st)
+	}
+}
+
+func TestBlockDiffUnequalLengths(t *testing.T) {
+	hashes := make([]merkletree.Hash32, 1000)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+
+	b1, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 7, RetainElements: true})
+	b1.Push(0, hashes)
+	b2, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 16, RetainElements: true})
+	b2.Push(0, hashes[:900])
+
+	diffs, err := b1.BlockDiff(b2)
+	if err != nil {
+		t.Fatalf("BlockDiff failed: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].Start != 900 || diffs[0].Count != 100 || diffs[0].Kind != merkletree.DiffLocalOnly {
+		t.Errorf("Expected single local-only range [900..999], got %v", diffs)
+	}
+}
+
+func TestRechunkMatchesDirectBuild(t *testing.T) {
+	hashes := make([]merkletree.Hash32, 333)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, RetainElements: true})
+	b.Push(0, hashes)
+	r, err := b.Rechunk(32)
+	if err != nil {
+		t.Fatalf("Rechunk failed: %v", err)
+	}
+
+	ref, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 32})
+	ref.Push(0, hashes)
+
+	r1, _ := r.Finalize()
+	r2, _ := ref.Finalize()
+	if r1 != r2 {
+		t.Errorf("Rechunked root mismatch.\nGot:  %x\nWant: %x", r1, r2)
+	}
+
+	plain, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10})
+	plain.Push(0, hashes)
+	if _, err := plain.Rechunk(32); !errors.Is(err, merkletree.ErrElementsNotRetained) {
+		t.Errorf("Expected ErrElementsNotRetained, got %v", err)
+	}
+}
+
+func TestBlockDiffLeavesInstrumentationAlone(t *testing.T) {
+	m := merkletree.NewMetrics()
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	b1, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 25, RetainElements: true, Metrics: m, Logger: logger})
+	pushRange(t, b1, 0, 200)
+	// b1 is the coarser tree, so BlockDiff re-chunks it to b2's chunk size.
+	b2, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, RetainElements: true})
+	pushRange(t, b2, 0, 200)
+
+	pushed, committed, hashes := m.BlocksPushed.Value(), m.ChunksCommitted.Value(), m.HashesComputed.Value()
+	logs.Reset()
+	if _, err := b1.BlockDiff(b2); err != nil {
+		t.Fatalf("BlockDiff failed: %v", err)
+	}
+	if m.BlocksPushed.Value() != pushed || m.ChunksCommitted.Value() != committed || m.HashesComputed.Value() != hashes {
+		t.Errorf("BlockDiff changed the build metrics: pushed %d, committed %d, hashes %d",
+			m.BlocksPushed.Value()-pushed, m.ChunksCommitted.Value()-committed, m.HashesComputed.Value()-hashes)
+	}
+	if strings.Contains(logs.String(), "chunk committed") {
+		t.Errorf("BlockDiff logged chunk commits:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestDiffBudgets(t *testing.T) {
+	cfg := merkletree.Config{BlockMerge: 10}
+
+	// Two completely unrelated trees: every chunk differs.
+	unrelated := func() *merkletree.Builder {
+		hashes := make([]merkletree.Hash32, 3000)
+		for i := range hashes {
+			rand.Read(hashes[i][:])
+		}
+		b, _ := merkletree.NewBuilder(cfg)
+		b.Push(0, hashes)
+		return b
+	}
+	b1, b2 := unrelated(), unrelated()
+
+	full, err := b1.TreeDiffWithOptions(b2, merkletree.DiffOptions{})
+	if err != nil {
+		t.Fatalf("TreeDiffWithOptions failed: %v", err)
+	}
+	if full.Truncated || len(full.Ranges) != 300 {
+		t.Fatalf("Unbounded diff: truncated=%v ranges=%d", full.Truncated, len(full.Ranges))
+	}
+	t.Logf("Full diff visited %d nodes, %d bytes", full.NodesVisited, full.BytesRead)
+
+	res, _ := b1.TreeDiffWithOptions(b2, merkletree.DiffOptions{MaxRanges: 10})
+	if !res.Truncated || res.TruncatedBy != merkletree.LimitMaxRanges || len(res.Ranges) != 10 {
+		t.Errorf("MaxRanges: truncated=%v by=%v ranges=%d", res.Truncated, res.TruncatedBy, len(res.Ranges))
+	}
+
+	res, _ = b1.TreeDiffWithOptions(b2, merkletree.DiffOptions{MaxNodesVisited: 50})
+	if !res.Truncated || res.TruncatedBy != merkletree.LimitMaxNodes || res.NodesVisited > 51 {
+		t.Errorf("MaxNodesVisited: truncated=%v by=%v visited=%d", res.Truncated, res.TruncatedBy, res.NodesVisited)
+	}
+
+	res, _ = b1.TreeDiffWithOptions(b2, merkletree.DiffOptions{MaxBytes: 1000})
+	if !res.Truncated || res.TruncatedBy != merkletree.LimitMaxBytes {
+		t.Errorf("MaxBytes: truncated=%v by=%v bytes=%d", res.Truncated, res.TruncatedBy, res.BytesRead)
+	}
+
+	res, _ = b1.TreeDiffWithOptions(b2, merkletree.DiffOptions{StopAtFirst: true})
+	if res.Truncated || len(res.Ranges) != 1 || res.Ranges[0] != full.Ranges[0] {
+		t.Errorf("StopAtFirst: truncated=%v ranges=%v", res.Truncated, res.Ranges)
+	}
+
+	// MultiBisect merges adjacent ranges, so unrelated trees yield a single range;
+	// the node budget is what bounds the work there.
+	mres, err := b1.MultiBisectWithOptions(context.Background(), b2, 4, merkletree.DiffOptions{MaxNodesVisited: 50})
+	if err != nil {
+		t.Fatalf("MultiBisectWithOptions failed: %v", err)
+	}
+	if !mres.Truncated || mres.TruncatedBy != merkletree.LimitMaxNodes {
+		t.Errorf("MultiBisect MaxNodesVisited: truncated=%v by=%v", mres.Truncated, mres.TruncatedBy)
+	}
+
+	s1, s2 := buildMutated(t, cfg, 3000, []int{5, 505, 1005, 1505, 2005, 2505})
+	mres, err = s1.MultiBisectWithOptions(context.Background(), s2, 4, merkletree.DiffOptions{MaxRanges: 3})
+	if err != nil {
+		t.Fatalf("MultiBisectWithOptions failed: %v", err)
+	}
+	if !mres.Truncated || mres.TruncatedBy != merkletree.LimitMaxRanges || len(mres.Ranges) != 3 || mres.Ranges[0].Start != 0 {
+		t.Errorf("MultiBisect MaxRanges: truncated=%v by=%v ranges=%v", mres.Truncated, mres.TruncatedBy, mres.Ranges)
+	}
+
+	mres, err = b1.MultiBisectWithOptions(context.Background(), b2, 4, merkletree.DiffOptions{StopAtFirst: true})
+	if err != nil || mres.Truncated || len(mres.Ranges) != 1 {
+		t.Errorf("MultiBisect StopAtFirst: %+v (err %v)", mres, err)
+	}
+
+	bres, _ := b1.BisectWithOptions(b2, merkletree.DiffOptions{MaxNodesVisited: 2})
+	if !bres.Truncated || len(bres.Ranges) != 0 {
+		t.Errorf("Bisect MaxNodesVisited: %+v", bres)
+	}
+	bres, _ = b1.TreeBisectWithOptions(b2, merkletree.DiffOptions{})
+	if bres.Truncated || len(bres.Ranges) != 1 || bres.Ranges[0].Start != 0 {
+		t.Errorf("TreeBisect unbounded: %+v", bres)
+	}
+}
+
+func TestDiffBudgetCountsNodesOnce(t *testing.T) {
+	// Local holds four chunks under one peak, remote the first two of them. The
+	// walk breaks the local peak down while the remote peak stays on its stack,
+	// then matches it against the left child: four distinct nodes in all.
+	local := buildRange(t, 0, 40)
+	remote := buildRange(t, 0, 20)
+	res, err := local.TreeDiffWithOptions(remote, merkletree.DiffOptions{MaxNodesVisited: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.NodesVisited != 4 || len(res.Ranges) != 1 || res.Ranges[0].Kind != merkletree.DiffLocalOnly {
+		t.Errorf("visited %d nodes, ranges %+v", res.NodesVisited, res.Ranges)
+	}
+	if res, _ := local.TreeDiffWithOptions(remote, merkletree.DiffOptions{MaxNodesVisited: 4}); res.Truncated {
+		t.Error("a budget of four nodes truncated the diff")
+	}
+}
+
+func buildRange(t *testing.T, start, count int) *merkletree.Builder {
+	t.Helper()
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10})
+	pushRange(t, b, uint64(start), count)
+	return b
+}
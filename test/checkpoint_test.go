@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func testKeys(t *testing.T, n int) ([]ed25519.PublicKey, []ed25519.PrivateKey) {
+	t.Helper()
+	pubs := make([]ed25519.PublicKey, n)
+	privs := make([]ed25519.PrivateKey, n)
+	for i := range privs {
+		seed := make([]byte, ed25519.SeedSize)
+		seed[0] = byte(i + 1)
+		privs[i] = ed25519.NewKeyFromSeed(seed)
+		pubs[i] = privs[i].Public().(ed25519.PublicKey)
+	}
+	return pubs, privs
+}
+
+func TestCheckpointEncoding(t *testing.T) {
+	start := uint64(100)
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, StartHeight: &start})
+	pushRange(t, b, 100, 10)
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.FixedZone("X", 3600))
+	c, err := b.Checkpoint(merkletree.HashSuiteSHA256, at)
+	if err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	root, _ := b.Fork().Finalize()
+	if c.Root != root || c.TotalBlocks != 10 || c.Height != 109 || b.State().InChunkCount != 2 {
+		t.Errorf("Checkpoint = %+v, want root %s", c, root)
+	}
+
+	enc, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if len(enc) != 1+32+8+8+1+len("sha256")+8+4+4 {
+		t.Errorf("encoding is %d bytes", len(enc))
+	}
+	var got merkletree.Checkpoint
+	if err := got.UnmarshalBinary(enc); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if !got.Equal(c) || !got.Timestamp.Equal(at) || got.HashSuite != "sha256" {
+		t.Errorf("round trip = %+v, want %+v", got, c)
+	}
+	// The same instant in another zone encodes identically.
+	utc := c
+	utc.Timestamp = at.UTC()
+	if enc2, _ := utc.MarshalBinary(); string(enc2) != string(enc) {
+		t.Errorf("encoding depends on the time zone")
+	}
+
+	for _, bad := range [][]byte{nil, enc[:len(enc)-1], append(append([]byte(nil), enc...), 0), append([]byte{0xC2}, enc[1:]...)} {
+		if err := got.UnmarshalBinary(bad); err == nil {
+			t.Errorf("UnmarshalBinary(%x) succeeded", bad)
+		}
+	}
+}
+
+func TestCheckpointSignatures(t *testing.T) {
+	pubs, privs := testKeys(t, 4)
+	c := merkletree.Checkpoint{Root: mockHash(1), TotalBlocks: 50, Height: 49, HashSuite: merkletree.HashSuiteSHA256, Timestamp: time.Unix(1700000000, 0)}
+
+	s, err := c.Sign(privs[0])
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := c.Verify(s); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+	for name, mutate := range map[string]func(*merkletree.Checkpoint){
+		"root":   func(c *merkletree.Checkpoint) { c.Root[0] ^= 1 },
+		"total":  func(c *merkletree.Checkpoint) { c.TotalBlocks++ },
+		"height": func(c *merkletree.Checkpoint) { c.Height++ },
+		"suite":  func(c *merkletree.Checkpoint) { c.HashSuite = "blake3" },
+		"time":   func(c *merkletree.Checkpoint) { c.Timestamp = c.Timestamp.Add(time.Nanosecond) },
+	} {
+		m := c
+		mutate(&m)
+		if err := m.Verify(s); !errors.Is(err, merkletree.ErrInvalidSignature) {
+			t.Errorf("%s changed: %v", name, err)
+		}
+	}
+	// The signature covers a domain-separated message, not the bare encoding.
+	enc, _ := c.MarshalBinary()
+	if ed25519.Verify(pubs[0], enc, s.Signature) {
+		t.Errorf("signature verifies over the bare encoding")
+	}
+
+	bundle := merkletree.CheckpointBundle{Checkpoint: c}
+	for _, k := range privs[:2] {
+		if err := bundle.Sign(k); err != nil {
+			t.Fatalf("bundle Sign failed: %v", err)
+		}
+	}
+	bundle.Sign(privs[0]) // duplicate signer
+	if len(bundle.Signatures) != 2 {
+		t.Errorf("%d signatures after a duplicate", len(bundle.Signatures))
+	}
+	other, _ := merkletree.Checkpoint{Root: mockHash(2)}.Sign(privs[2])
+	if err := bundle.Add(other); !errors.Is(err, merkletree.ErrInvalidSignature) {
+		t.Errorf("Add of a signature over another checkpoint: %v", err)
+	}
+
+	if signers, err := bundle.Verify(pubs, 2); err != nil || len(signers) != 2 || signers[0] != 0 || signers[1] != 1 {
+		t.Errorf("2-of-4 = %v, %v", signers, err)
+	}
+	if _, err := bundle.Verify(pubs, 3); !errors.Is(err, merkletree.ErrInsufficientSignatures) {
+		t.Errorf("3-of-4: %v", err)
+	}
+	// A trust set listing the same key twice does not count it twice.
+	if _, err := bundle.Verify([]ed25519.PublicKey{pubs[0], pubs[0], pubs[3]}, 2); !errors.Is(err, merkletree.ErrInsufficientSignatures) {
+		t.Errorf("duplicate trusted key: %v", err)
+	}
+	// Forged signatures are ignored.
+	forged := bundle
+	forged.Signatures = append([]merkletree.CheckpointSignature(nil), bundle.Signatures...)
+	forged.Signatures[1].Signature = append([]byte(nil), forged.Signatures[1].Signature...)
+	forged.Signatures[1].Signature[0] ^= 1
+	if _, err := forged.Verify(pubs, 2); !errors.Is(err, merkletree.ErrInsufficientSignatures) {
+		t.Errorf("forged signature: %v", err)
+	}
+
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded merkletree.CheckpointBundle
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if _, err := decoded.Verify(pubs, 2); err != nil {
+		t.Errorf("bundle after JSON round trip: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestConcatMatchesSequential(t *testing.T) {
+	start := uint64(100)
+	for _, cfg := range []merkletree.Config{
+		{BlockMerge: 4, RetainElements: true},
+		{BlockMerge: 3, RetainElements: true, StartHeight: &start},
+		{BlockMerge: 5, RetainElements: true, Domain: []byte("chain-a")},
+	} {
+		for _, total := range []int{0, 1, 37, 128, 301} {
+			seq, _ := merkletree.NewBuilder(cfg)
+			pushRange(t, seq, start, total)
+			want, _ := seq.Snapshot()
+
+			for _, split := range []int{0, 1, 3, 4, 12, 64, total / 2, total - 1, total} {
+				if split < 0 || split > total {
+					continue
+				}
+				left, _ := merkletree.NewBuilder(cfg)
+				pushRange(t, left, start, split)
+				rcfg := cfg
+				rs := start + uint64(split)
+				rcfg.StartHeight = &rs
+				right, _ := merkletree.NewBuilder(rcfg)
+				pushRange(t, right, rs, total-split)
+
+				out, err := merkletree.Concat(left, right)
+				if err != nil {
+					t.Fatalf("bm %d, %d+%d: Concat failed: %v", cfg.BlockMerge, split, total-split, err)
+				}
+				if got, _ := out.Snapshot(); !bytes.Equal(got, want) {
+					t.Errorf("bm %d, %d+%d: snapshot differs from the sequential build", cfg.BlockMerge, split, total-split)
+				}
+				if err := out.Verify(); err != nil {
+					t.Errorf("bm %d, %d+%d: Verify: %v", cfg.BlockMerge, split, total-split, err)
+				}
+				// The result keeps extending like the sequential build.
+				pushRange(t, out, start+uint64(total), 9)
+				ext := seq.Fork()
+				pushRange(t, ext, start+uint64(total), 9)
+				r1, _ := out.Finalize()
+				r2, _ := ext.Finalize()
+				if r1 != r2 {
+					t.Errorf("bm %d, %d+%d: root after extending differs", cfg.BlockMerge, split, total-split)
+				}
+			}
+		}
+	}
+}
+
+func TestConcatAlignedWithoutElements(t *testing.T) {
+	seq, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 8})
+	pushRange(t, seq, 0, 8*100+5)
+	want, _ := seq.Finalize()
+
+	// Segments built on different machines, each a multiple of the chunk size.
+	var acc *merkletree.Builder
+	for _, seg := range [][2]int{{0, 8 * 24}, {8 * 24, 8 * 40}, {8 * 64, 8 * 36}, {8 * 100, 5}} {
+		b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 8})
+		pushRange(t, b, uint64(seg[0]), seg[1])
+		if acc == nil {
+			acc = b
+			continue
+		}
+		var err error
+		if acc, err = merkletree.Concat(acc, b); err != nil {
+			t.Fatalf("Concat at %d failed: %v", seg[0], err)
+		}
+	}
+	if got, _ := acc.Finalize(); got != want {
+		t.Errorf("root %s, want %s", got, want)
+	}
+}
+
+func TestConcatErrors(t *testing.T) {
+	build := func(cfg merkletree.Config, start uint64, count int) *merkletree.Builder {
+		b, _ := merkletree.NewBuilder(cfg)
+		pushRange(t, b, start, count)
+		return b
+	}
+	cfg := merkletree.Config{BlockMerge: 4}
+	left := build(cfg, 0, 10)
+
+	if _, err := merkletree.Concat(left, build(merkletree.Config{BlockMerge: 8}, 10, 8)); !errors.Is(err, merkletree.ErrConfigMismatch) {
+		t.Errorf("different blockMerge: %v", err)
+	}
+	if _, err := merkletree.Concat(left, build(merkletree.Config{BlockMerge: 4, Domain: []byte("x")}, 10, 8)); !errors.Is(err, merkletree.ErrDomainMismatch) {
+		t.Errorf("different domain: %v", err)
+	}
+	if _, err := merkletree.Concat(left, build(cfg, 11, 8)); err == nil {
+		t.Error("non-adjacent builders should fail")
+	}
+	// left has a partial chunk, right's elements are gone.
+	if _, err := merkletree.Concat(left, build(cfg, 10, 8)); !errors.Is(err, merkletree.ErrElementsNotRetained) {
+		t.Errorf("re-chunking without elements: %v", err)
+	}
+	finalized := build(cfg, 0, 10)
+	finalized.Finalize()
+	if _, err := merkletree.Concat(finalized, build(cfg, 10, 8)); err == nil {
+		t.Error("a left side finalized with a partial chunk should fail")
+	}
+	if out, err := merkletree.Concat(left, build(cfg, 99, 0)); err != nil || out.State() != left.State() {
+		t.Errorf("empty right side: %v", err)
+	}
+}
+
+func TestConcatGaps(t *testing.T) {
+	heights := sparseHeights(80, pruned)
+	want, _ := gapBuilder(t, heights, 80).Finalize()
+	for _, split := range []int{4, 10, 13, 40} {
+		var i int
+		for i < len(heights) && heights[i] < uint64(split) {
+			i++
+		}
+		left := gapBuilder(t, heights[:i], 80)
+		right := gapBuilder(t, heights[i:], 80)
+		if heights[i] != uint64(split) {
+			// right starts after a gap; give left the gap up to right's start.
+			left.PushSparse(heights[i:i+1], sparseHashes(heights[i:i+1]))
+			right = gapBuilder(t, heights[i+1:], 80)
+		}
+		out, err := merkletree.Concat(left, right)
+		if err != nil {
+			t.Fatalf("split %d: Concat failed: %v", split, err)
+		}
+		if got, _ := out.Finalize(); got != want {
+			t.Errorf("split %d: root %s, want %s", split, got, want)
+		}
+	}
+}
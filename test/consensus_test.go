@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"crypto/rand"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestConsensusDiff(t *testing.T) {
+	count := 1000
+	cfg := merkletree.Config{BlockMerge: 10}
+
+	base := make([]merkletree.Hash32, count)
+	for i := range base {
+		rand.Read(base[i][:])
+	}
+	peer := func(n int, mutate ...int) *merkletree.Builder {
+		hashes := make([]merkletree.Hash32, n)
+		copy(hashes, base[:n])
+		for _, idx := range mutate {
+			hashes[idx][0] ^= 0xFF
+		}
+		b, _ := merkletree.NewBuilder(cfg)
+		b.Push(0, hashes)
+		return b
+	}
+
+	peers := []*merkletree.Builder{
+		peer(count),
+		peer(count, 700),
+		peer(count, 700),
+		peer(count, 150),
+		peer(905),
+	}
+
+	ranges, err := merkletree.ConsensusDiff(peers)
+	if err != nil {
+		t.Fatalf("ConsensusDiff failed: %v", err)
+	}
+	for _, r := range ranges {
+		t.Logf("[%d..%d] majority=%v dissenters=%v missing=%v", r.Start, r.Start+uint64(r.Count)-1, r.Majority, r.Dissenters, r.Missing)
+	}
+
+	find := func(h uint64) *merkletree.ConsensusRange {
+		for i := range ranges {
+			if h >= ranges[i].Start && h < ranges[i].Start+uint64(ranges[i].Count) {
+				return &ranges[i]
+			}
+		}
+		return nil
+	}
+
+	r := find(150)
+	if r == nil || r.Start != 150 || r.Count != 10 {
+		t.Fatalf("Expected chunk [150..159], got %+v", r)
+	}
+	if !reflect.DeepEqual(r.Majority, []int{0, 1, 2, 4}) || !reflect.DeepEqual(r.Dissenters, []int{3}) {
+		t.Errorf("Chunk 150: majority %v dissenters %v", r.Majority, r.Dissenters)
+	}
+
+	r = find(700)
+	if r == nil || !reflect.DeepEqual(r.Majority, []int{0, 3, 4}) || !reflect.DeepEqual(r.Dissenters, []int{1, 2}) {
+		t.Errorf("Chunk 700: %+v", r)
+	} else if len(r.Groups) != 2 || r.MajorityRoot != r.Groups[0].Root {
+		t.Errorf("Chunk 700 groups: %+v", r.Groups)
+	}
+
+	// Peer 4 stops at 905: its partial chunk [900..904] differs, the rest is missing.
+	r = find(900)
+	if r == nil || !reflect.DeepEqual(r.Dissenters, []int{4}) {
+		t.Errorf("Chunk 900: %+v", r)
+	}
+	var missing uint64
+	for _, r := range ranges {
+		if r.Start >= 910 {
+			if !reflect.DeepEqual(r.Missing, []int{4}) || len(r.Dissenters) != 0 {
+				t.Errorf("Tail range %+v should only miss peer 4", r)
+			}
+			missing += uint64(r.Count)
+		}
+	}
+	if missing != 90 {
+		t.Errorf("Expected 90 missing blocks, got %d", missing)
+	}
+
+	// Nothing to report when everyone agrees.
+	if same, _ := merkletree.ConsensusDiff([]*merkletree.Builder{peer(count), peer(count)}); len(same) != 0 {
+		t.Errorf("Expected no ranges for identical peers, got %d", len(same))
+	}
+
+	other, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 20})
+	if _, err := merkletree.ConsensusDiff([]*merkletree.Builder{peers[0], other}); !errors.Is(err, merkletree.ErrConfigMismatch) {
+		t.Errorf("Expected ErrConfigMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestDiffKinds(t *testing.T) {
+	cfg := merkletree.Config{BlockMerge: 10}
+
+	hashes := make([]merkletree.Hash32, 1000)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+	mutated := make([]merkletree.Hash32, len(hashes))
+	copy(mutated, hashes)
+	mutated[305][0] ^= 0xFF
+
+	local, _ := merkletree.NewBuilder(cfg)
+	local.Push(0, hashes)
+	remote, _ := merkletree.NewBuilder(cfg)
+	remote.Push(0, mutated[:800])
+
+	diffs, err := local.TreeDiff(remote)
+	if err != nil {
+		t.Fatalf("TreeDiff failed: %v", err)
+	}
+
+	var tail uint64
+	foundMismatch := false
+	for _, d := range diffs {
+		switch {
+		case d.Start >= 800:
+			if d.Kind != merkletree.DiffLocalOnly {
+				t.Errorf("Tail range [%d..%d] has kind %v, want local_only", d.Start, d.Start+uint64(d.Count)-1, d.Kind)
+			}
+			if d.LocalRoot == (merkletree.Hash32{}) || d.RemoteRoot != (merkletree.Hash32{}) {
+				t.Errorf("Local-only range should carry only a local root: %+v", d)
+			}
+			tail += uint64(d.Count)
+		case d.Start == 300:
+			foundMismatch = true
+			if d.Kind != merkletree.DiffMismatch {
+				t.Errorf("Chunk [300..309] has kind %v, want mismatch", d.Kind)
+			}
+			if d.LocalRoot == d.RemoteRoot {
+				t.Error("Mismatched chunk should carry differing roots")
+			}
+		}
+	}
+	if !foundMismatch {
+		t.Error("Mismatched chunk [300..309] not reported")
+	}
+	if tail != 200 {
+		t.Errorf("Expected 200 local-only blocks, got %d", tail)
+	}
+
+	// Swapping sides flips the kind.
+	reverse, _ := remote.TreeDiff(local)
+	for _, d := range reverse {
+		if d.Start >= 800 && d.Kind != merkletree.DiffRemoteOnly {
+			t.Errorf("Reverse tail range has kind %v, want remote_only", d.Kind)
+		}
+	}
+}
+
+func TestDiffRangeJSON(t *testing.T) {
+	d := merkletree.DiffRange{Start: 10, Count: 5, Kind: merkletree.DiffShapeMismatch}
+	d.LocalRoot[0] = 0xAB
+
+	out, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(out), `"kind":"shape_mismatch"`) || !strings.Contains(string(out), `"local_root":"ab00`) {
+		t.Errorf("Unexpected JSON: %s", out)
+	}
+
+	var back merkletree.DiffRange
+	if err := json.Unmarshal(out, &back); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if back != d {
+		t.Errorf("Round trip mismatch: %+v != %+v", back, d)
+	}
+}
+
+func TestDiffRangeJSONScope(t *testing.T) {
+	// Only diff ranges encode their roots as hex; other Hash32 fields keep the
+	// default array form.
+	n := merkletree.Node{HasData: true}
+	n.Root[0] = 0x01
+	out, err := json.Marshal(n)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(out), `"Root":[1,0,`) {
+		t.Errorf("Unexpected Node JSON: %s", out)
+	}
+
+	// Keyed ranges add their keys to the DiffRange fields.
+	r := merkletree.KeyedRange[string]{
+		DiffRange:  merkletree.DiffRange{Start: 8, Count: 8, Kind: merkletree.DiffRemoteOnly},
+		RemoteKeys: &merkletree.KeyBounds[string]{First: "a", Last: "b"},
+	}
+	r.RemoteRoot[31] = 0xff
+	out, err = json.Marshal(r)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(out), `"remote_root":"00`) || !strings.Contains(string(out), `"remote_keys":{"first":"a","last":"b"}`) {
+		t.Errorf("Unexpected KeyedRange JSON: %s", out)
+	}
+	var back merkletree.KeyedRange[string]
+	if err := json.Unmarshal(out, &back); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if back.DiffRange != r.DiffRange || back.LocalKeys != nil || *back.RemoteKeys != *r.RemoteKeys {
+		t.Errorf("Round trip mismatch: %+v != %+v", back, r)
+	}
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	mrand "math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// coverage returns the set of heights covered by ranges.
+func coverage(ranges []merkletree.DiffRange) map[uint64]bool {
+	set := make(map[uint64]bool)
+	for _, d := range ranges {
+		for h := d.Start; h < d.Start+uint64(d.Count); h++ {
+			set[h] = true
+		}
+	}
+	return set
+}
+
+// TestDifferCrossCheck runs every diff entry point on randomized pairs of trees
+// (different lengths, partial chunks, scattered mutations) and checks that they
+// agree with each other and with the chunks that actually differ.
+func TestDifferCrossCheck(t *testing.T) {
+	rng := mrand.New(mrand.NewSource(34))
+
+	for iter := 0; iter < 60; iter++ {
+		blockMerge := 1 + rng.Intn(16)
+		len1, len2 := rng.Intn(1500), rng.Intn(1500)
+		if iter%5 == 0 {
+			len2 = len1
+		}
+
+		data := make([]merkletree.Hash32, max(len1, len2))
+		for i := range data {
+			rng.Read(data[i][:])
+		}
+		mutated := make([]merkletree.Hash32, len(data))
+		copy(mutated, data)
+		shared := min(len1, len2)
+		var mutations []int
+		if shared > 0 && iter%7 != 0 {
+			for m := rng.Intn(6); m > 0; m-- {
+				idx := rng.Intn(shared)
+				mutated[idx][0] ^= 0xFF
+				mutations = append(mutations, idx)
+			}
+		}
+
+		cfg := merkletree.Config{BlockMerge: blockMerge}
+		b1, _ := merkletree.NewBuilder(cfg)
+		b1.Push(0, data[:len1])
+		b2, _ := merkletree.NewBuilder(cfg)
+		b2.Push(0, mutated[:len2])
+		state := b1.State()
+
+		// Expected: every chunk holding a mutation, or lying past the shorter tree's
+		// end (including its partially filled last chunk).
+		want := make(map[uint64]bool)
+		markChunk := func(h int) {
+			c := h / blockMerge * blockMerge
+			for i := c; i < c+blockMerge && i < len(data); i++ {
+				want[uint64(i)] = true
+			}
+		}
+		for _, m := range mutations {
+			markChunk(m)
+		}
+		for h := shared; h < len(data); h++ {
+			markChunk(h)
+		}
+
+		ctx := context.Background()
+		results := map[string][]merkletree.DiffRange{}
+		results["TreeDiff"], _ = b1.TreeDiff(b2)
+		results["MultiBisect/1"], _ = b1.MultiBisect(b2, 1)
+		results["MultiBisect/4"], _ = b1.MultiBisect(b2, 4)
+		for d, err := range b1.DiffSeq(b2) {
+			if err != nil {
+				t.Fatalf("iter %d: DiffSeq: %v", iter, err)
+			}
+			results["DiffSeq"] = append(results["DiffSeq"], d)
+		}
+		for name, traversal := range map[string]merkletree.DiffTraversal{"root": merkletree.TraverseRoot, "peaks": merkletree.TraversePeaks} {
+			seq, err := merkletree.Differ{Traversal: traversal}.Diff(ctx, b1, b2)
+			if err != nil {
+				t.Fatalf("iter %d: Differ: %v", iter, err)
+			}
+			par, err := merkletree.Differ{Traversal: traversal, Concurrency: 3}.Diff(ctx, b1, b2)
+			if err != nil {
+				t.Fatalf("iter %d: parallel Differ: %v", iter, err)
+			}
+			if !reflect.DeepEqual(seq.Ranges, par.Ranges) {
+				t.Errorf("iter %d %s: parallel result differs:\n seq %v\n par %v", iter, name, seq.Ranges, par.Ranges)
+			}
+			results["Differ/"+name] = seq.Ranges
+		}
+		if !reflect.DeepEqual(results["DiffSeq"], results["TreeDiff"]) {
+			t.Errorf("iter %d: DiffSeq %v != TreeDiff %v", iter, results["DiffSeq"], results["TreeDiff"])
+		}
+		if !reflect.DeepEqual(results["MultiBisect/1"], results["MultiBisect/4"]) {
+			t.Errorf("iter %d: MultiBisect depends on concurrency", iter)
+		}
+
+		for name, ranges := range results {
+			got := coverage(ranges)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("iter %d (bm=%d, %d vs %d, mutations %v): %s covers %d heights, want %d: %v",
+					iter, blockMerge, len1, len2, mutations, name, len(got), len(want), ranges)
+			}
+			for i := 1; i < len(ranges); i++ {
+				if ranges[i].Start < ranges[i-1].Start+uint64(ranges[i-1].Count) {
+					t.Errorf("iter %d: %s ranges overlap or are unordered: %v", iter, name, ranges)
+				}
+			}
+		}
+
+		// Bisect and TreeBisect report the leftmost differing range.
+		first := uint64(len(data))
+		for h := range want {
+			first = min(first, h)
+		}
+		for name, bisect := range map[string]func(*merkletree.Builder) (uint64, uint32, error){
+			"Bisect":     b1.Bisect,
+			"TreeBisect": b1.TreeBisect,
+		} {
+			start, count, err := bisect(b2)
+			if err != nil {
+				t.Fatalf("iter %d: %s: %v", iter, name, err)
+			}
+			if len(want) == 0 {
+				if count != 0 {
+					t.Errorf("iter %d: %s found [%d,+%d) in identical trees", iter, name, start, count)
+				}
+				continue
+			}
+			if count == 0 || start != first {
+				t.Errorf("iter %d: %s = [%d,+%d), want start %d", iter, name, start, count, first)
+			}
+		}
+
+		// None of the diffs commit the partial chunk.
+		if b1.State() != state {
+			t.Errorf("iter %d: diff modified the local builder", iter)
+		}
+	}
+}
+
+func TestDifferBisectPartialBuffers(t *testing.T) {
+	// Partial chunks of different fill used to be reported with the smaller count
+	// (zero when one side had none, which read as "no difference").
+	cfg := merkletree.Config{BlockMerge: 10}
+	b1, b2 := buildMutated(t, cfg, 25, nil)
+	b3, _ := merkletree.NewBuilder(cfg)
+	hashes := make([]merkletree.Hash32, 20)
+	b3.Push(0, hashes)
+	b1.Push(25, hashes[:3])
+
+	start, count, err := b1.Bisect(b2)
+	if err != nil || start != 20 || count != 8 {
+		t.Errorf("Bisect(28 vs 25 blocks) = [%d,+%d) %v, want [20,+8)", start, count, err)
+	}
+
+	res, err := merkletree.Differ{Strategy: merkletree.DiffFirst, Traversal: merkletree.TraversePeaks}.Diff(context.Background(), b2, b3)
+	if err != nil || len(res.Ranges) != 1 {
+		t.Fatalf("Differ first: %+v %v", res, err)
+	}
+	if r := res.Ranges[0]; r.Start != 0 || r.Kind != merkletree.DiffMismatch {
+		t.Errorf("Differ first = %+v, want a mismatch at 0", r)
+	}
+}
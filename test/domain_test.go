@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func domainBuilder(t *testing.T, domain string, count int) *merkletree.Builder {
+	t.Helper()
+	cfg := merkletree.Config{BlockMerge: 4, RetainElements: true}
+	if domain != "" {
+		cfg.Domain = []byte(domain)
+	}
+	b, _ := merkletree.NewBuilder(cfg)
+	pushRange(t, b, 0, count)
+	return b
+}
+
+func TestDomainRoots(t *testing.T) {
+	plain, _ := domainBuilder(t, "", 50).Finalize()
+	empty, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, Domain: []byte{}})
+	pushRange(t, empty, 0, 50)
+	if r, _ := empty.Finalize(); r != plain {
+		t.Errorf("empty domain changed the root")
+	}
+
+	a, _ := domainBuilder(t, "chain-a", 50).Finalize()
+	a2, _ := domainBuilder(t, "chain-a", 50).Finalize()
+	b, _ := domainBuilder(t, "chain-b", 50).Finalize()
+	if a != a2 || a == b || a == plain {
+		t.Errorf("roots: a %s, a again %s, b %s, none %s", a, a2, b, plain)
+	}
+
+	// Domain returns a copy; writing to it leaves the builder alone.
+	da := domainBuilder(t, "chain-a", 50)
+	da.Domain()[0] = 'X'
+	if string(da.Domain()) != "chain-a" {
+		t.Errorf("Domain after writing to its result: %q", da.Domain())
+	}
+	if r, _ := da.Finalize(); r != a {
+		t.Errorf("writing to Domain changed the root")
+	}
+
+	// DomainHashFactory computes the builder's chunk digests, also after Reset.
+	hf := merkletree.DomainHashFactory(nil, []byte("chain-a"))
+	h := hf()
+	h.Write([]byte("junk"))
+	h.Reset()
+	if fresh := hf(); string(h.Sum(nil)) != string(fresh.Sum(nil)) {
+		t.Errorf("Reset dropped the domain prefix")
+	}
+	one, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, Domain: []byte("chain-a")})
+	pushRange(t, one, 0, 4)
+	if r, _ := one.Finalize(); r != merkletree.ComputeChunkDigest(hf, 0, mockHashes(0, 4)) {
+		t.Errorf("chunk digest differs from DomainHashFactory")
+	}
+	if r, _ := domainBuilder(t, "", 4).Finalize(); r != merkletree.ComputeChunkDigest(merkletree.DomainHashFactory(sha256.New, nil), 0, mockHashes(0, 4)) {
+		t.Errorf("DomainHashFactory without a domain changed the digest")
+	}
+}
+
+func TestDomainSnapshots(t *testing.T) {
+	src := domainBuilder(t, "chain-a", 50)
+	root, _ := src.Fork().Finalize()
+
+	data, err := src.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if data[0] != 0xA2 {
+		t.Errorf("snapshot version %x, want a2", data[0])
+	}
+	if plain, _ := domainBuilder(t, "", 50).Snapshot(); plain[0] != 0xA1 {
+		t.Errorf("snapshot without a domain has version %x", plain[0])
+	}
+
+	restored, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, Domain: []byte("chain-a")})
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if r, _ := restored.Finalize(); r != root {
+		t.Errorf("restored root %s, want %s", r, root)
+	}
+	for _, domain := range []string{"", "chain-b"} {
+		other, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, Domain: []byte(domain)})
+		if err := other.Restore(data); !errors.Is(err, merkletree.ErrDomainMismatch) {
+			t.Errorf("Restore into domain %q: %v", domain, err)
+		}
+	}
+	plain, _ := domainBuilder(t, "", 50).Snapshot()
+	if err := restored.Restore(plain); !errors.Is(err, merkletree.ErrDomainMismatch) {
+		t.Errorf("Restore of a v1 snapshot into a domain: %v", err)
+	}
+	if err := restored.Restore(data[:3]); err == nil {
+		t.Errorf("Restore of a truncated domain succeeded")
+	}
+
+	r, err := merkletree.NewSnapshotReader(data, nil)
+	if err != nil {
+		t.Fatalf("NewSnapshotReader failed: %v", err)
+	}
+	if string(r.Domain()) != "chain-a" {
+		t.Errorf("reader domain %q", r.Domain())
+	}
+	if got, _ := r.Root(); got != root {
+		t.Errorf("reader root %s, want %s", got, root)
+	}
+	if _, err := merkletree.NewSnapshotReader(data[:8], nil); !errors.Is(err, merkletree.ErrMalformedSnapshot) {
+		t.Errorf("reader of a truncated domain: %v", err)
+	}
+
+	local := domainBuilder(t, "chain-a", 60)
+	if ranges, err := merkletree.DiffSnapshotReader(local, r); err != nil || len(ranges) == 0 {
+		t.Errorf("DiffSnapshotReader = %v, %v", ranges, err)
+	}
+	if _, err := merkletree.DiffSnapshotReader(domainBuilder(t, "chain-b", 60), r); !errors.Is(err, merkletree.ErrDomainMismatch) {
+		t.Errorf("DiffSnapshotReader across domains: %v", err)
+	}
+
+	js, _ := json.Marshal(src.ToSnapshot())
+	var snap merkletree.MerkleTreeSnapshot
+	if err := json.Unmarshal(js, &snap); err != nil {
+		t.Fatal(err)
+	}
+	if snap.Version != 2 || string(snap.Config.Domain) != "chain-a" {
+		t.Errorf("JSON snapshot version %d, domain %q", snap.Version, snap.Config.Domain)
+	}
+	fromJSON, err := snap.FromSnapshot(nil)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %v", err)
+	}
+	if r, _ := fromJSON.Finalize(); r != root {
+		t.Errorf("root from JSON %s, want %s", r, root)
+	}
+	if ranges, err := merkletree.DiffSnapshot(local, &snap); err != nil || len(ranges) == 0 {
+		t.Errorf("DiffSnapshot = %v, %v", ranges, err)
+	}
+	if _, err := merkletree.DiffSnapshot(domainBuilder(t, "", 60), &snap); !errors.Is(err, merkletree.ErrDomainMismatch) {
+		t.Errorf("DiffSnapshot across domains: %v", err)
+	}
+}
+
+func TestDomainDiffsAndProofs(t *testing.T) {
+	a, b := domainBuilder(t, "chain-a", 40), domainBuilder(t, "chain-b", 40)
+	if _, err := a.TreeDiff(b); !errors.Is(err, merkletree.ErrDomainMismatch) {
+		t.Errorf("TreeDiff across domains: %v", err)
+	}
+	if _, _, err := a.Bisect(b); !errors.Is(err, merkletree.ErrDomainMismatch) {
+		t.Errorf("Bisect across domains: %v", err)
+	}
+	if _, err := merkletree.ConsensusDiff([]*merkletree.Builder{a, domainBuilder(t, "chain-a", 40), b}); !errors.Is(err, merkletree.ErrDomainMismatch) {
+		t.Errorf("ConsensusDiff across domains: %v", err)
+	}
+	if ranges, err := a.TreeDiff(domainBuilder(t, "chain-a", 40)); err != nil || len(ranges) != 0 {
+		t.Errorf("TreeDiff within a domain = %v, %v", ranges, err)
+	}
+
+	p, err := a.ProveBlock(17)
+	if err != nil {
+		t.Fatalf("ProveBlock failed: %v", err)
+	}
+	if string(p.Domain) != "chain-a" {
+		t.Errorf("proof domain %q", p.Domain)
+	}
+	if err := p.Verify(nil, p.Root, mockHash(17)); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+	// The same blocks under another domain give another root, so the proof does not
+	// carry over.
+	rootB, _ := b.Fork().Finalize()
+	if err := p.Verify(nil, rootB, mockHash(17)); !errors.Is(err, merkletree.ErrInvalidProof) {
+		t.Errorf("Verify against another domain's root: %v", err)
+	}
+
+	at := time.Unix(1700000000, 0)
+	ca, _ := a.Checkpoint(merkletree.HashSuiteSHA256, at)
+	cb, _ := b.Checkpoint(merkletree.HashSuiteSHA256, at)
+	if string(ca.Domain) != "chain-a" || ca.Equal(cb) {
+		t.Errorf("checkpoints %+v, %+v", ca, cb)
+	}
+	enc, _ := ca.MarshalBinary()
+	var decoded merkletree.Checkpoint
+	if err := decoded.UnmarshalBinary(enc); err != nil || !decoded.Equal(ca) || string(decoded.Domain) != "chain-a" {
+		t.Errorf("round trip = %+v, %v", decoded, err)
+	}
+	if err := ca.VerifyProof(p, nil, mockHash(17)); err != nil {
+		t.Errorf("VerifyProof failed: %v", err)
+	}
+	if err := cb.VerifyProof(p, nil, mockHash(17)); !errors.Is(err, merkletree.ErrDomainMismatch) {
+		t.Errorf("VerifyProof across domains: %v", err)
+	}
+}
@@ -3,7 +3,6 @@ package tests
 import (
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"os"
 	"testing"
 
@@ -32,7 +31,7 @@ func TestPaginationAndRestorationFlow(t *testing.T) {
 	// ---------------------------------------------------------
 	// 1. SENDER: Construct Tree from Pages
 	// ---------------------------------------------------------
-	fmt.Printf("[Sender] Processing %d pages (%d blocks total)...\n", totalPages, totalHashes)
+	t.Logf("[Sender] Processing %d pages (%d blocks total)...", totalPages, totalHashes)
 
 	senderBuilder, err := merkletree.NewBuilder(cfg)
 	if err != nil {
@@ -63,7 +62,7 @@ func TestPaginationAndRestorationFlow(t *testing.T) {
 	}
 
 	senderRoot, _ := senderBuilder.Finalize()
-	fmt.Printf("[Sender] Root: %x\n", senderRoot[:4])
+	t.Logf("[Sender] Root: %x", senderRoot[:4])
 
 	// ---------------------------------------------------------
 	// 2. SENDER: Serialize to JSON
@@ -83,13 +82,13 @@ func TestPaginationAndRestorationFlow(t *testing.T) {
 	if err != nil {
 		t.Fatalf("JSON marshal failed: %v", err)
 	}
-	fmt.Printf("[Network] Transporting JSON payload (%d bytes)...\n", len(jsonBytes))
+	t.Logf("[Network] Transporting JSON payload (%d bytes)...", len(jsonBytes))
 
 	// User Request: Save to file for inspection
 	if err := os.WriteFile("payload.json", jsonBytes, 0644); err != nil {
 		t.Fatalf("Failed to write payload.json: %v", err)
 	}
-	fmt.Println("[File] Saved payload to test/payload.json")
+	t.Log("[File] Saved payload to test/payload.json")
 
 	// ---------------------------------------------------------
 	// 3. RECEIVER: Deserialize and Reconstruct
@@ -128,7 +127,7 @@ func TestPaginationAndRestorationFlow(t *testing.T) {
 	}
 
 	receiverRoot, _ := receiverBuilder.Finalize()
-	fmt.Printf("[Receiver] Root: %x\n", receiverRoot[:4])
+	t.Logf("[Receiver] Root: %x", receiverRoot[:4])
 
 	// ---------------------------------------------------------
 	// 4. VERIFICATION
@@ -136,7 +135,7 @@ func TestPaginationAndRestorationFlow(t *testing.T) {
 	if senderRoot != receiverRoot {
 		t.Fatalf("Root Mismatch!\nSender:   %x\nReceiver: %x", senderRoot, receiverRoot)
 	}
-	fmt.Println("[Success] Sender and Receiver roots match.")
+	t.Log("[Success] Sender and Receiver roots match.")
 
 	// Verify Receiver is "Live" (can append more data)
 	// Let's add one more block to both
@@ -151,7 +150,7 @@ func TestPaginationAndRestorationFlow(t *testing.T) {
 	if newSenderRoot != newReceiverRoot {
 		t.Fatalf("Post-Restore Append Mismatch!")
 	}
-	fmt.Println("[Success] Both trees updated correctly with new data.")
+	t.Log("[Success] Both trees updated correctly with new data.")
 }
 
 func mockHash(i int) merkletree.Hash32 {
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestForkIsIndependent(t *testing.T) {
+	cfg := merkletree.Config{BlockMerge: 10}
+
+	hashes := make([]merkletree.Hash32, 1000)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+
+	// Base tree ends mid-chunk so the partial buffer is exercised too.
+	base, _ := merkletree.NewBuilder(cfg)
+	base.Push(0, hashes[:555])
+
+	fork := base.Fork()
+	if fork.State() != base.State() {
+		t.Fatalf("Fork state differs.\nBase: %+v\nFork: %+v", base.State(), fork.State())
+	}
+
+	// Candidate branch: apply the canonical blocks to the fork only.
+	if _, err := fork.Push(555, hashes[555:]); err != nil {
+		t.Fatalf("Push to fork failed: %v", err)
+	}
+
+	// Reference tree built sequentially.
+	ref, _ := merkletree.NewBuilder(cfg)
+	ref.Push(0, hashes)
+	refRoot, _ := ref.Finalize()
+
+	forkRoot, _ := fork.Finalize()
+	if forkRoot != refRoot {
+		t.Errorf("Fork root mismatch.\nFork: %x\nRef:  %x", forkRoot, refRoot)
+	}
+
+	// The original must be untouched by the fork's pushes.
+	if base.State().TotalBlocks != 555 {
+		t.Errorf("Base TotalBlocks changed: %d", base.State().TotalBlocks)
+	}
+
+	// A competing branch on the original must still produce a correct root.
+	alt := make([]merkletree.Hash32, len(hashes)-555)
+	copy(alt, hashes[555:])
+	alt[0][0] ^= 0xFF
+	base.Push(555, alt)
+
+	altRef, _ := merkletree.NewBuilder(cfg)
+	altRef.Push(0, hashes[:555])
+	altRef.Push(555, alt)
+	altRefRoot, _ := altRef.Finalize()
+
+	baseRoot, _ := base.Finalize()
+	if baseRoot != altRefRoot {
+		t.Errorf("Base root after competing push mismatch.\nBase: %x\nRef:  %x", baseRoot, altRefRoot)
+	}
+	if baseRoot == forkRoot {
+		t.Error("Competing branches should have different roots")
+	}
+}
@@ -0,0 +1,308 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// sparseHeights returns heights 0..n-1 without those in skip.
+func sparseHeights(n int, skip func(h uint64) bool) []uint64 {
+	var out []uint64
+	for h := uint64(0); h < uint64(n); h++ {
+		if !skip(h) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func sparseHashes(heights []uint64) []merkletree.Hash32 {
+	out := make([]merkletree.Hash32, len(heights))
+	for i, h := range heights {
+		out[i] = mockHash(int(h))
+	}
+	return out
+}
+
+// gapBuilder pushes the heights in batches of batch with PushSparse.
+func gapBuilder(t *testing.T, heights []uint64, batch int) *merkletree.Builder {
+	t.Helper()
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, RetainElements: true, AllowGaps: true})
+	hashes := sparseHashes(heights)
+	for i := 0; i < len(heights); i += batch {
+		j := min(i+batch, len(heights))
+		if _, err := b.PushSparse(heights[i:j], hashes[i:j]); err != nil {
+			t.Fatalf("PushSparse(%v) failed: %v", heights[i:j], err)
+		}
+	}
+	return b
+}
+
+// pruned skips heights 10-16 and 30-49.
+func pruned(h uint64) bool { return (h >= 10 && h < 17) || (h >= 30 && h < 50) }
+
+func TestGapRoots(t *testing.T) {
+	heights := sparseHeights(80, pruned)
+	want, _ := gapBuilder(t, heights, len(heights)).Finalize()
+	for _, batch := range []int{1, 3, 7} {
+		if got, _ := gapBuilder(t, heights, batch).Finalize(); got != want {
+			t.Errorf("batches of %d: root %s, want %s", batch, got, want)
+		}
+	}
+
+	// Push with jumps between batches builds the same tree.
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, AllowGaps: true})
+	pushRange(t, b, 0, 10)
+	pushRange(t, b, 17, 13)
+	pushRange(t, b, 50, 30)
+	if got, _ := b.Finalize(); got != want {
+		t.Errorf("Push with jumps: root %s, want %s", got, want)
+	}
+
+	contiguous, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, AllowGaps: true})
+	pushRange(t, contiguous, 0, 80)
+	if got, _ := contiguous.Finalize(); got == want {
+		t.Error("gaps did not change the root")
+	}
+
+	g := gapBuilder(t, heights, 5)
+	if s := g.Stats(); s.TotalBlocks != uint64(len(heights)) || s.GapHeights != 27 {
+		t.Errorf("stats: %d blocks, %d gap heights", s.TotalBlocks, s.GapHeights)
+	}
+	if err := g.Verify(); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+	// Gap digests hash only tag, start and count.
+	h := g.Stats().Hashing
+	if h.GapDigests != 2 || h.BytesHashed != h.ElementDigests*41+h.ChunkDigests*45+h.GapDigests*13+h.NodeDigests*77 {
+		t.Errorf("hashing %+v", h)
+	}
+	if _, err := g.RootAt(20); err == nil {
+		t.Error("RootAt should fail on a tree with gaps")
+	}
+}
+
+func TestGapErrors(t *testing.T) {
+	plain, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4})
+	if _, err := plain.PushSparse([]uint64{0, 2}, sparseHashes([]uint64{0, 2})); err == nil {
+		t.Error("PushSparse without AllowGaps should fail")
+	}
+
+	b := gapBuilder(t, []uint64{0, 1, 5}, 3)
+	if _, err := b.PushSparse([]uint64{4}, sparseHashes([]uint64{4})); err == nil {
+		t.Error("a height below the next one should fail")
+	}
+	if _, err := b.PushSparse([]uint64{8, 7}, sparseHashes([]uint64{8, 7})); err == nil {
+		t.Error("decreasing heights should fail")
+	}
+	if _, err := b.Push(5, mockHashes(5, 1)); err == nil {
+		t.Error("pushing a height again should fail")
+	}
+}
+
+func TestGapSnapshots(t *testing.T) {
+	heights := sparseHeights(80, pruned)
+	src := gapBuilder(t, heights, 9)
+	root, _ := src.Fork().Finalize()
+
+	data, err := src.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	restored, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, RetainElements: true, AllowGaps: true})
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if err := restored.Verify(); err != nil {
+		t.Errorf("Verify after Restore: %v", err)
+	}
+	if r, _ := restored.Fork().Finalize(); r != root {
+		t.Errorf("restored root %s, want %s", r, root)
+	}
+	// Restored trees keep extending with gaps.
+	more := []uint64{90, 91}
+	if _, err := restored.PushSparse(more, sparseHashes(more)); err != nil {
+		t.Errorf("PushSparse after Restore: %v", err)
+	}
+	// The binary snapshot records AllowGaps, so the builder need not set it.
+	plain, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4})
+	if err := plain.Restore(data); err != nil {
+		t.Fatalf("Restore without AllowGaps: %v", err)
+	}
+	if _, err := plain.PushSparse(more, sparseHashes(more)); err != nil {
+		t.Errorf("PushSparse after Restore without AllowGaps: %v", err)
+	}
+	tampered := bytes.Clone(data)
+	tampered[5] &^= 0x02 // flags after the version and BlockMerge
+	plain, _ = merkletree.NewBuilder(merkletree.Config{BlockMerge: 4})
+	if err := plain.Restore(tampered); !errors.Is(err, merkletree.ErrMalformedSnapshot) {
+		t.Errorf("Restore of gaps without the flag: %v", err)
+	}
+
+	var snap merkletree.MerkleTreeSnapshot
+	js, _ := json.Marshal(src.ToSnapshot())
+	if err := json.Unmarshal(js, &snap); err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := snap.FromSnapshot(nil)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %v", err)
+	}
+	if err := fromJSON.Verify(); err != nil {
+		t.Errorf("Verify after FromSnapshot: %v", err)
+	}
+	if r, _ := fromJSON.Finalize(); r != root {
+		t.Errorf("JSON root %s, want %s", r, root)
+	}
+
+	// The mode survives a JSON round trip even before the first gap.
+	empty, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, AllowGaps: true})
+	pushRange(t, empty, 0, 3)
+	js, _ = json.Marshal(empty.ToSnapshot())
+	snap = merkletree.MerkleTreeSnapshot{}
+	json.Unmarshal(js, &snap)
+	noGaps, err := snap.FromSnapshot(nil)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %v", err)
+	}
+	if _, err := noGaps.Push(10, mockHashes(10, 2)); err != nil {
+		t.Errorf("gap after a JSON round trip: %v", err)
+	}
+	js, _ = json.Marshal(noGaps.ToSnapshot())
+	if s := noGaps.Stats(); s.GapHeights != 7 || s.JSONSnapshotBytes != uint64(len(js)) {
+		t.Errorf("after the gap: %d gap heights, JSON size %d for %d", s.GapHeights, s.JSONSnapshotBytes, len(js))
+	}
+	js, _ = json.Marshal(src.ToSnapshot())
+
+	reader, err := merkletree.NewSnapshotReader(data, nil)
+	if err != nil {
+		t.Fatalf("NewSnapshotReader failed: %v", err)
+	}
+	if !reader.AllowGaps() {
+		t.Error("SnapshotReader lost AllowGaps")
+	}
+	if r, _ := reader.Root(); r != root {
+		t.Errorf("reader root %s, want %s", r, root)
+	}
+	if ranges, err := merkletree.DiffSnapshotReader(gapBuilder(t, heights, 4), reader); err != nil || len(ranges) != 0 {
+		t.Errorf("DiffSnapshotReader of equal trees: %v, %v", ranges, err)
+	}
+
+	s := src.Stats()
+	if s.BinarySnapshotBytes != uint64(len(data)) || s.JSONSnapshotBytes != uint64(len(js)) {
+		t.Errorf("snapshot sizes %d/%d, want %d/%d", s.BinarySnapshotBytes, s.JSONSnapshotBytes, len(data), len(js))
+	}
+}
+
+func TestGapDiff(t *testing.T) {
+	// Heights 8-11 are a gap locally and present remotely; 40-43 differ in content.
+	local := gapBuilder(t, sparseHeights(64, func(h uint64) bool { return h >= 8 && h < 12 }), 64)
+	remote, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, RetainElements: true, AllowGaps: true})
+	pushRange(t, remote, 0, 40)
+	changed := mockHashes(40, 4)
+	changed[1][0] ^= 0xff
+	remote.Push(40, changed)
+	pushRange(t, remote, 44, 20)
+
+	ranges, err := local.TreeDiff(remote)
+	if err != nil {
+		t.Fatalf("TreeDiff failed: %v", err)
+	}
+	if len(ranges) != 2 {
+		t.Fatalf("ranges: %+v", ranges)
+	}
+	if r := ranges[0]; r.Kind != merkletree.DiffGap || r.Start != 8 || r.Count != 4 || r.Kind.String() != "gap" {
+		t.Errorf("first range %+v, want a gap at [8, +4)", r)
+	}
+	if r := ranges[1]; r.Kind != merkletree.DiffMismatch || r.Start != 40 {
+		t.Errorf("second range %+v, want a mismatch at 40", r)
+	}
+}
+
+func TestGapProofs(t *testing.T) {
+	heights := sparseHeights(80, pruned)
+	b := gapBuilder(t, heights, 80)
+	root, _ := b.Fork().Finalize()
+
+	p, err := b.ProveBlock(55)
+	if err != nil {
+		t.Fatalf("ProveBlock(55) failed: %v", err)
+	}
+	if err := p.Verify(nil, root, mockHash(55)); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := p.VerifyGap(nil, root); !errors.Is(err, merkletree.ErrInvalidProof) {
+		t.Errorf("VerifyGap on a block proof: %v", err)
+	}
+
+	g, err := b.ProveBlock(33)
+	if err != nil {
+		t.Fatalf("ProveBlock(33) failed: %v", err)
+	}
+	if g.GapCount != 20 || g.ChunkStart != 30 || len(g.Elems) != 0 {
+		t.Errorf("gap proof %+v", g)
+	}
+	if err := g.VerifyGap(nil, root); err != nil {
+		t.Errorf("VerifyGap: %v", err)
+	}
+	if err := g.Verify(nil, root, mockHash(33)); !errors.Is(err, merkletree.ErrInvalidProof) {
+		t.Errorf("Verify on a gap proof: %v", err)
+	}
+	g.GapCount = 19
+	if err := g.VerifyGap(nil, root); !errors.Is(err, merkletree.ErrInvalidProof) {
+		t.Errorf("VerifyGap with a forged count: %v", err)
+	}
+	if r := merkletree.GapDigest(nil, 30, 20); r == (merkletree.Hash32{}) {
+		t.Error("zero gap digest")
+	}
+}
+
+func TestGapRechunk(t *testing.T) {
+	heights := sparseHeights(80, pruned)
+	b := gapBuilder(t, heights, 80)
+	r, err := b.Rechunk(8)
+	if err != nil {
+		t.Fatalf("Rechunk failed: %v", err)
+	}
+	if err := r.Verify(); err != nil {
+		t.Errorf("Verify after Rechunk: %v", err)
+	}
+	direct, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 8, AllowGaps: true})
+	direct.PushSparse(heights, sparseHashes(heights))
+	want, _ := direct.Finalize()
+	if got, _ := r.Finalize(); got != want {
+		t.Errorf("rechunked root %s, want %s", got, want)
+	}
+}
+
+func TestGapLimits(t *testing.T) {
+	// Gaps may cover up to the whole span a node can count.
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, AllowGaps: true})
+	pushRange(t, b, 0, 1)
+	last := uint64(math.MaxUint32) - 1
+	if _, err := b.PushSparse([]uint64{last}, sparseHashes([]uint64{last})); err != nil {
+		t.Fatalf("gap up to height %d: %v", last, err)
+	}
+	if err := b.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	root, _ := b.Fork().Finalize()
+	if root == (merkletree.Hash32{}) {
+		t.Error("zero root")
+	}
+
+	// Anything further cannot be counted by the root, and leaves b unchanged.
+	for _, h := range []uint64{last + 2, 1 << 40} {
+		if _, err := b.PushSparse([]uint64{h}, sparseHashes([]uint64{h})); err == nil {
+			t.Errorf("height %d: the tree would span more than MaxUint32 heights", h)
+		}
+	}
+	if r, _ := b.Finalize(); r != root {
+		t.Errorf("rejected gaps changed the root")
+	}
+}
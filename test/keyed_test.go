@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// accountBuckets buckets account keys by hundreds: "acct/0012xx" is bucket "12".
+var accountBuckets = merkletree.KeyBuckets{Skip: 7, Bytes: 2}
+
+// accounts returns n sparse account keys with their value hashes.
+func accounts(n int) ([]string, []merkletree.Hash32) {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("acct/%06d", i*7)
+	}
+	return keys, mockHashes(0, n)
+}
+
+func keyedBuilder(t *testing.T, keys []string, values []merkletree.Hash32) *merkletree.KeyedBuilder[string] {
+	t.Helper()
+	kb, err := merkletree.NewKeyedBuilder(merkletree.Config{BlockMerge: 8}, merkletree.StringKeys(), accountBuckets)
+	if err != nil {
+		t.Fatalf("NewKeyedBuilder failed: %v", err)
+	}
+	// Push in uneven batches to split buckets and chunks across batches.
+	for i := 0; i < len(keys); i += 13 {
+		j := min(i+13, len(keys))
+		if _, err := kb.Push(keys[i:j], values[i:j]); err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+	}
+	return kb
+}
+
+// without returns a copy of s without its element i.
+func without[T any](s []T, i int) []T {
+	return append(append([]T(nil), s[:i]...), s[i+1:]...)
+}
+
+func TestKeyedBuilderEqual(t *testing.T) {
+	keys, values := accounts(500)
+	a, b := keyedBuilder(t, keys, values), keyedBuilder(t, keys, values)
+	ra, _ := a.Root()
+	rb, _ := b.Root()
+	if ra != rb || ra == (merkletree.Hash32{}) || a.Len() != 500 {
+		t.Errorf("roots %s, %s", ra, rb)
+	}
+	if _, found, err := a.Bisect(b); found || err != nil {
+		t.Errorf("Bisect of equal trees = %v, %v", found, err)
+	}
+
+	// The root does not depend on the batches.
+	whole, _ := merkletree.NewKeyedBuilder(merkletree.Config{BlockMerge: 8}, merkletree.StringKeys(), accountBuckets)
+	whole.Push(keys, values)
+	if rw, _ := whole.Root(); rw != ra {
+		t.Errorf("root %s after one batch, %s after several", rw, ra)
+	}
+
+	// The same values under other keys give another root, even in the same bucket.
+	shifted := append([]string(nil), keys...)
+	shifted[250] = "acct/001751"
+	if rc, _ := keyedBuilder(t, shifted, values).Root(); rc == ra {
+		t.Errorf("root does not commit the keys")
+	}
+	// Domains apply to keyed trees too.
+	kd, _ := merkletree.NewKeyedBuilder(merkletree.Config{BlockMerge: 8, Domain: []byte("x")}, merkletree.StringKeys(), accountBuckets)
+	kd.Push(keys, values)
+	if rd, _ := kd.Root(); rd == ra {
+		t.Errorf("root ignores the domain")
+	}
+}
+
+func TestKeyedBuilderDiff(t *testing.T) {
+	keys, values := accounts(500)
+	local := keyedBuilder(t, keys, values)
+
+	changed := append([]merkletree.Hash32(nil), values...)
+	changed[123][0] ^= 1 // acct/000861, bucket "08"
+	remote := keyedBuilder(t, keys, changed)
+
+	r, found, err := local.Bisect(remote)
+	if err != nil || !found {
+		t.Fatalf("Bisect = %v, %v", found, err)
+	}
+	// The chunk of buckets "08" to "0?" holds acct/000805 to acct/000994.
+	if r.Start != '0'<<8|'8' || r.Count != 8 || r.Kind != merkletree.DiffMismatch {
+		t.Errorf("Bisect range %+v", r.DiffRange)
+	}
+	if r.LocalKeys == nil || r.LocalKeys.First != keys[115] || r.LocalKeys.Last != keys[142] || *r.RemoteKeys != *r.LocalKeys {
+		t.Errorf("Bisect keys %+v, %+v", r.LocalKeys, r.RemoteKeys)
+	}
+	if ranges, err := local.TreeDiff(remote); err != nil || len(ranges) != 1 || ranges[0].DiffRange != r.DiffRange || *ranges[0].LocalKeys != *r.LocalKeys {
+		t.Errorf("TreeDiff = %+v, %v", ranges, err)
+	}
+}
+
+func TestKeyedBuilderMissingKey(t *testing.T) {
+	keys, values := accounts(500)
+	local := keyedBuilder(t, keys, values)
+
+	// A key missing on one side changes only its chunk, whichever key it is.
+	for _, i := range []int{0, 1, 115, 300, 386, 499} {
+		remote := keyedBuilder(t, without(keys, i), without(values, i))
+		ranges, err := local.TreeDiff(remote)
+		if err != nil || len(ranges) != 1 {
+			t.Errorf("key %s missing: %d ranges %+v, %v", keys[i], len(ranges), ranges, err)
+			continue
+		}
+		r := ranges[0]
+		if r.LocalKeys == nil || r.LocalKeys.First > keys[i] || r.LocalKeys.Last < keys[i] {
+			t.Errorf("key %s missing: range %+v holds %+v", keys[i], r.DiffRange, r.LocalKeys)
+		}
+	}
+
+	// A key alone in an otherwise empty chunk shows up as a gap on the other side.
+	extraKeys := append(append(append([]string(nil), keys[:143]...), "acct/000~"), keys[143:]...)
+	extraValues := append(append(append([]merkletree.Hash32(nil), values[:143]...), mockHash(9999)), values[143:]...)
+	remote := keyedBuilder(t, extraKeys, extraValues)
+	ranges, err := local.TreeDiff(remote)
+	if err != nil || len(ranges) != 1 {
+		t.Fatalf("extra key: ranges %+v, %v", ranges, err)
+	}
+	r := ranges[0]
+	if r.Kind != merkletree.DiffGap || r.Start != '0'<<8|'x' || r.LocalKeys != nil || r.RemoteKeys == nil || r.RemoteKeys.First != "acct/000~" {
+		t.Errorf("extra key: range %+v, keys %+v, %+v", r.DiffRange, r.LocalKeys, r.RemoteKeys)
+	}
+}
+
+func TestKeyedBuilderPushErrors(t *testing.T) {
+	low16 := merkletree.KeyBuckets{Skip: 6, Bytes: 2}
+	kb, _ := merkletree.NewKeyedBuilder(merkletree.Config{BlockMerge: 4}, merkletree.Uint64Keys(), low16)
+	if _, err := kb.Push([]uint64{5, 9, 1000}, mockHashes(0, 3)); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	// 65541 is greater than 1000 but falls in bucket 5.
+	for _, keys := range [][]uint64{{1000}, {999}, {2000, 2000}, {2000, 1500}, {65541}} {
+		if _, err := kb.Push(keys, mockHashes(0, len(keys))); err == nil {
+			t.Errorf("Push(%v) succeeded", keys)
+		}
+	}
+	if _, err := kb.Push([]uint64{2000}, nil); err == nil {
+		t.Errorf("Push with a missing value succeeded")
+	}
+	if kb.Len() != 3 {
+		t.Errorf("rejected batches were applied: %d entries", kb.Len())
+	}
+	if k, ok := kb.KeysAt(4, 8); !ok || k.First != 5 || k.Last != 9 {
+		t.Errorf("KeysAt = %+v, %v", k, ok)
+	}
+	if _, ok := kb.KeysAt(12, 4); ok {
+		t.Errorf("KeysAt over an empty chunk succeeded")
+	}
+
+	other, _ := merkletree.NewKeyedBuilder(merkletree.Config{BlockMerge: 8}, merkletree.Uint64Keys(), low16)
+	if _, _, err := kb.Bisect(other); err == nil {
+		t.Errorf("Bisect across chunk sizes succeeded")
+	}
+	other, _ = merkletree.NewKeyedBuilder(merkletree.Config{BlockMerge: 4}, merkletree.Uint64Keys(), merkletree.KeyBuckets{Skip: 5, Bytes: 2})
+	if _, _, err := kb.Bisect(other); err == nil {
+		t.Errorf("Bisect across key buckets succeeded")
+	}
+	// Past the end of the key, or more than a million chunks of 4 buckets.
+	for _, kbk := range []merkletree.KeyBuckets{{Skip: 1, Bytes: 0}, {Bytes: 4}, {Skip: -1, Bytes: 1}, {Skip: 6, Bytes: 3}, {Skip: 5, Bytes: 3}} {
+		if _, err := merkletree.NewKeyedBuilder(merkletree.Config{BlockMerge: 4}, merkletree.Uint64Keys(), kbk); err == nil {
+			t.Errorf("NewKeyedBuilder with buckets %+v succeeded", kbk)
+		}
+	}
+	if _, err := merkletree.NewKeyedBuilder(merkletree.Config{BlockMerge: 16}, merkletree.StringKeys(), merkletree.KeyBuckets{}); err == nil {
+		t.Errorf("NewKeyedBuilder derived buckets for strings")
+	}
+
+	byID, _ := merkletree.NewKeyedBuilder(merkletree.Config{BlockMerge: 4}, merkletree.BytesKeys(), merkletree.KeyBuckets{Bytes: 1})
+	if _, err := byID.Push([][]byte{{0x01}, {0x01, 0x00}, {0x02}}, mockHashes(0, 3)); err != nil {
+		t.Errorf("Push of byte keys failed: %v", err)
+	}
+}
+
+func TestKeyedBuilderDefaultBuckets(t *testing.T) {
+	// Integer keys default to their low three bytes: one bucket per small key.
+	m := merkletree.NewMetrics()
+	kb, err := merkletree.NewKeyedBuilder(merkletree.Config{BlockMerge: 16, Metrics: m}, merkletree.Uint64Keys(), merkletree.KeyBuckets{})
+	if err != nil {
+		t.Fatalf("NewKeyedBuilder failed: %v", err)
+	}
+	if _, err := kb.Push([]uint64{1, 2, 100, 1000}, mockHashes(0, 4)); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if k, ok := kb.KeysAt(96, 16); !ok || k.First != 100 || k.Last != 100 {
+		t.Errorf("KeysAt = %+v, %v", k, ok)
+	}
+
+	// Only entries count as pushed blocks, and looking at the root commits nothing.
+	committed := m.ChunksCommitted.Value()
+	kb.Root()
+	kb.Root()
+	if m.BlocksPushed.Value() != 4 || m.ChunksCommitted.Value() != committed {
+		t.Errorf("pushed %d, committed %d then %d", m.BlocksPushed.Value(), committed, m.ChunksCommitted.Value())
+	}
+	if _, err := kb.Push([]uint64{1 << 24}, mockHashes(4, 1)); err == nil {
+		t.Error("a key past the buckets wrapped around to bucket 0")
+	}
+}
@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merklehttp"
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// newMerkleServer serves b and counts the GET /node requests.
+func newMerkleServer(t *testing.T, b *merkletree.Builder) (*merklehttp.Client, *atomic.Int64) {
+	t.Helper()
+	var mu sync.RWMutex
+	h := merklehttp.NewHandler(b, merklehttp.Options{Lock: mu.RLocker()})
+	var nodes atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/node" {
+			nodes.Add(1)
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return merklehttp.NewClient(srv.URL + "/"), &nodes
+}
+
+func TestMerkleHTTPEndpoints(t *testing.T) {
+	ctx := context.Background()
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, RetainElements: true})
+	pushRange(t, b, 0, 103)
+	c, _ := newMerkleServer(t, b)
+
+	want, _ := b.RootView()
+	root, err := c.Root(ctx)
+	if err != nil {
+		t.Fatalf("Root failed: %v", err)
+	}
+	if root.Root != want.Root || root.TotalBlocks != 103 {
+		t.Errorf("Root = %+v, want %s", root, want.Root)
+	}
+	if b.State().TotalBlocks != 103 || b.State().InChunkCount != 3 {
+		t.Errorf("GET /root committed the partial chunk")
+	}
+
+	stats, err := c.State(ctx)
+	if err != nil || !reflect.DeepEqual(stats, b.Stats()) {
+		t.Errorf("State = %+v, %v", stats, err)
+	}
+
+	data, err := c.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	restored, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4})
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if r, _ := restored.Finalize(); r != want.Root {
+		t.Errorf("restored root %s, want %s", r, want.Root)
+	}
+
+	n, err := c.Node(ctx, want.Left.Metadata.Start, want.Left.Metadata.Count)
+	if err != nil {
+		t.Fatalf("Node failed: %v", err)
+	}
+	if n.Root != want.Left.Root || n.Leaf || n.Left.Root != want.Left.Left.Root || n.Right.Root != want.Left.Right.Root {
+		t.Errorf("Node = %+v", n)
+	}
+
+	p, err := c.ProveBlock(ctx, 57)
+	if err != nil {
+		t.Fatalf("ProveBlock failed: %v", err)
+	}
+	if err := p.Verify(nil, root.Root, mockHash(57)); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
+
+func TestMerkleHTTPErrors(t *testing.T) {
+	ctx := context.Background()
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4})
+	c, _ := newMerkleServer(t, b)
+
+	if n, err := c.RootNode(ctx); n != nil || err != nil {
+		t.Errorf("RootNode of an empty tree = %v, %v", n, err)
+	}
+	pushRange(t, b, 0, 20)
+
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"missing node", func() error { _, err := c.Node(ctx, 1, 4); return err }(), http.StatusNotFound},
+		{"not retained", func() error { _, err := c.ProveBlock(ctx, 3); return err }(), http.StatusUnprocessableEntity},
+		{"past the end", func() error { _, err := c.ProveBlock(ctx, 20); return err }(), http.StatusNotFound},
+		{"bad snapshot", func() error { _, err := c.DiffSnapshot(ctx, []byte("junk"), merkletree.Differ{}); return err }(), http.StatusBadRequest},
+	} {
+		var se *merklehttp.StatusError
+		if !errors.As(tc.err, &se) || se.StatusCode != tc.status || se.Message == "" {
+			t.Errorf("%s: %v, want status %d", tc.name, tc.err, tc.status)
+		}
+	}
+
+	resp, err := http.Get(c.BaseURL + "/snapshot?format=xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d", resp.StatusCode)
+	}
+
+	small := httptest.NewServer(merklehttp.NewHandler(b, merklehttp.Options{MaxSnapshotBytes: 16}))
+	defer small.Close()
+	data, _ := b.Snapshot()
+	_, err = merklehttp.NewClient(small.URL).DiffSnapshot(ctx, data, merkletree.Differ{})
+	var se *merklehttp.StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized snapshot: %v", err)
+	}
+}
+
+func TestMerkleHTTPRemoteDiff(t *testing.T) {
+	ctx := context.Background()
+	remote, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4})
+	pushRange(t, remote, 0, 4000)
+	c, nodes := newMerkleServer(t, remote)
+
+	local, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4})
+	hashes := mockHashes(0, 3990)
+	hashes[1234][0] ^= 1
+	hashes[2900][0] ^= 1
+	if _, err := local.Push(0, hashes); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	wantStart, wantCount, _ := local.TreeBisect(remote)
+	start, count, err := c.Bisect(ctx, local)
+	if err != nil {
+		t.Fatalf("Bisect failed: %v", err)
+	}
+	if start != wantStart || count != wantCount {
+		t.Errorf("Bisect = [%d, +%d), want [%d, +%d)", start, count, wantStart, wantCount)
+	}
+	if got := nodes.Load(); got > 20 {
+		t.Errorf("Bisect fetched %d nodes", got)
+	}
+
+	want, _ := local.TreeDiff(remote)
+	res, err := c.Diff(ctx, local)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if !reflect.DeepEqual(res.Ranges, want) {
+		t.Errorf("Diff = %v, want %v", res.Ranges, want)
+	}
+
+	// The server diffs its own tree against a posted snapshot.
+	data, _ := local.Snapshot()
+	want, _ = remote.TreeDiff(local)
+	res, err = c.DiffSnapshot(ctx, data, merkletree.Differ{})
+	if err != nil {
+		t.Fatalf("DiffSnapshot failed: %v", err)
+	}
+	if !reflect.DeepEqual(res.Ranges, want) {
+		t.Errorf("DiffSnapshot = %v, want %v", res.Ranges, want)
+	}
+	res, err = c.DiffSnapshot(ctx, data, merkletree.Differ{Strategy: merkletree.DiffFirst})
+	if err != nil || len(res.Ranges) != 1 || res.Ranges[0] != want[0] {
+		t.Errorf("DiffSnapshot first = %v, %v", res.Ranges, err)
+	}
+
+	// JSON snapshots are accepted too.
+	js, _ := json.Marshal(local.ToSnapshot())
+	res, err = c.DiffSnapshot(ctx, js, merkletree.Differ{Options: merkletree.DiffOptions{MaxRanges: 1}})
+	if err != nil || !res.Truncated || len(res.Ranges) != 1 {
+		t.Errorf("JSON DiffSnapshot = %+v, %v", res, err)
+	}
+}
+
+func TestMerkleHTTPRemoteDomain(t *testing.T) {
+	ctx := context.Background()
+	c, nodes := newMerkleServer(t, domainBuilder(t, "chain-a", 100))
+
+	if res, err := c.Diff(ctx, domainBuilder(t, "chain-a", 100)); err != nil || len(res.Ranges) != 0 {
+		t.Errorf("Diff within the domain: %v, %v", res.Ranges, err)
+	}
+	nodes.Store(0)
+	for _, domain := range []string{"", "chain-b"} {
+		local := domainBuilder(t, domain, 100)
+		if _, err := c.Diff(ctx, local); !errors.Is(err, merkletree.ErrDomainMismatch) {
+			t.Errorf("Diff from domain %q: %v", domain, err)
+		}
+		if _, _, err := c.Bisect(ctx, local); !errors.Is(err, merkletree.ErrDomainMismatch) {
+			t.Errorf("Bisect from domain %q: %v", domain, err)
+		}
+	}
+	if got := nodes.Load(); got != 0 {
+		t.Errorf("mismatched domains fetched %d nodes", got)
+	}
+}
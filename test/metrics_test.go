@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merklehttp"
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestMetrics(t *testing.T) {
+	m := merkletree.NewMetrics()
+	local, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, Metrics: m})
+	pushRange(t, local, 0, 165)
+	remote, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, Metrics: m})
+	remote.Push(0, mockHashes(1, 165))
+
+	snap, _ := local.Snapshot()
+	if err := local.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := local.TreeDiffWithOptions(remote, merkletree.DiffOptions{})
+	other := merkletree.NewMetrics()
+	local.TreeDiffWithOptions(remote, merkletree.DiffOptions{Metrics: other})
+
+	// 330 blocks in 32 chunks, 15 merges per builder.
+	if m.BlocksPushed.Value() != 330 || m.ChunksCommitted.Value() != 32 || m.HashesComputed.Value() != 330+32+30 {
+		t.Errorf("Build metrics: pushed %d, committed %d, hashes %d",
+			m.BlocksPushed.Value(), m.ChunksCommitted.Value(), m.HashesComputed.Value())
+	}
+	if m.SnapshotBytes.Count() != 1 || m.SnapshotBytes.Sum() != float64(len(snap)) || m.RestoreDuration.Count() != 1 {
+		t.Error("Snapshot and restore were not observed")
+	}
+	if m.Diffs.Value() != 1 || m.DiffNodesVisited.Value() != res.NodesVisited || m.DiffRanges.Value() != uint64(len(res.Ranges)) {
+		t.Errorf("Diff metrics: %d runs, %d nodes, %d ranges", m.Diffs.Value(), m.DiffNodesVisited.Value(), m.DiffRanges.Value())
+	}
+	if other.Diffs.Value() != 1 {
+		t.Error("DiffOptions.Metrics should override the builder's")
+	}
+
+	// JSON restores are timed too, and the restored builder reports to m.
+	fromJSON, err := local.ToSnapshot().FromSnapshotWithMetrics(nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushRange(t, fromJSON, 165, 5)
+	if m.RestoreDuration.Count() != 2 || m.BlocksPushed.Value() != 335 {
+		t.Errorf("JSON restore: %d restores, %d blocks pushed", m.RestoreDuration.Count(), m.BlocksPushed.Value())
+	}
+
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	for _, want := range []string{
+		"# TYPE merkletree_blocks_pushed_total counter\nmerkletree_blocks_pushed_total 335\n",
+		"# TYPE merkletree_snapshot_bytes histogram\n",
+		`merkletree_snapshot_bytes_bucket{le="1024"} 0`,
+		`merkletree_snapshot_bytes_bucket{le="4096"} 1`,
+		`merkletree_snapshot_bytes_bucket{le="+Inf"} 1`,
+		"merkletree_restore_duration_seconds_count 2\n",
+		fmt.Sprintf("merkletree_diff_ranges_total %d\n", len(res.Ranges)),
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Exposition lacks %q:\n%s", want, text)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	merklehttp.MetricsHandler(m).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") || rec.Body.String() != text {
+		t.Error("MetricsHandler does not serve the exposition")
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	h := merkletree.NewHistogram([]float64{1, 2, 5})
+	for _, v := range []float64{0.5, 1, 1.5, 3, 100} {
+		h.Observe(v)
+	}
+	m := &merkletree.Metrics{SnapshotBytes: h, RestoreDuration: merkletree.NewHistogram(nil)}
+	var buf bytes.Buffer
+	m.WritePrometheus(&buf)
+	want := `merkletree_snapshot_bytes_bucket{le="1"} 2
+merkletree_snapshot_bytes_bucket{le="2"} 3
+merkletree_snapshot_bytes_bucket{le="5"} 4
+merkletree_snapshot_bytes_bucket{le="+Inf"} 5
+merkletree_snapshot_bytes_sum 106
+merkletree_snapshot_bytes_count 5
+`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("Histogram exposition:\n%s", buf.String())
+	}
+}
+
+func TestZeroMetrics(t *testing.T) {
+	// The zero Metrics counts and discards histogram observations without panicking.
+	m := &merkletree.Metrics{}
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, Metrics: m})
+	pushRange(t, b, 0, 25)
+	snap, err := b.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if m.BlocksPushed.Value() != 25 || m.SnapshotBytes.Count() != 0 || m.SnapshotBytes.Sum() != 0 {
+		t.Errorf("pushed %d, snapshot count %d", m.BlocksPushed.Value(), m.SnapshotBytes.Count())
+	}
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "merkletree_snapshot_bytes_bucket{le=\"+Inf\"} 0\nmerkletree_snapshot_bytes_sum 0\n") {
+		t.Errorf("Exposition of nil histograms:\n%s", buf.String())
+	}
+}
@@ -2,7 +2,6 @@ package tests
 
 import (
 	"crypto/rand"
-	"fmt"
 	"testing"
 
 	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
@@ -28,23 +27,23 @@ func TestMultiBisect(t *testing.T) {
 	indices := []int{105, 500, 1500, 1990}
 	for _, idx := range indices {
 		hashes2[idx][0] ^= 0xFF
-		fmt.Printf("Mutated block at index %d\n", idx)
+		t.Logf("Mutated block at index %d", idx)
 	}
 
 	b2, _ := merkletree.NewBuilder(cfg)
 	b2.Push(0, hashes2)
 
 	// 3. Run MultiBisect
-	fmt.Println("Running MultiBisect...")
+	t.Log("Running MultiBisect...")
 	diffs, err := b1.MultiBisect(b2, 4) // Concurrency 4
 	if err != nil {
 		t.Fatalf("MultiBisect failed: %v", err)
 	}
 
 	// 4. Verify Results
-	fmt.Printf("Found %d differing ranges:\n", len(diffs))
+	t.Logf("Found %d differing ranges:", len(diffs))
 	for _, d := range diffs {
-		fmt.Printf(" - Range [%d .. %d]\n", d.Start, d.Start+uint64(d.Count)-1)
+		t.Logf(" - Range [%d .. %d]", d.Start, d.Start+uint64(d.Count)-1)
 	}
 
 	if len(diffs) < len(indices) {
@@ -81,7 +80,7 @@ func TestMultiBisectUnequalLengths(t *testing.T) {
 	cfg := merkletree.Config{BlockMerge: 10}
 
 	// 1. Build Tree A (2000)
-	fmt.Println("Building Tree A (2000)...")
+	t.Log("Building Tree A (2000)...")
 	hashes := make([]merkletree.Hash32, countA)
 	for i := 0; i < countA; i++ {
 		rand.Read(hashes[i][:])
@@ -90,12 +89,12 @@ func TestMultiBisectUnequalLengths(t *testing.T) {
 	b1.Push(0, hashes)
 
 	// 2. Build Tree B (1500)
-	fmt.Println("Building Tree B (1500)...")
+	t.Log("Building Tree B (1500)...")
 	// Mutate blocks at different indices
 	indices := []int{1605, 1700, 1990}
 	for _, idx := range indices {
 		hashes[idx][0] ^= 0xFF
-		fmt.Printf("Mutated block at index %d\n", idx)
+		t.Logf("Mutated block at index %d", idx)
 	}
 
 	// Use same hashes for first 1500
@@ -103,7 +102,7 @@ func TestMultiBisectUnequalLengths(t *testing.T) {
 	b2.Push(0, hashes[:countB])
 
 	// 3. Run MultiBisect
-	fmt.Println("Running MultiBisect(A, B)...")
+	t.Log("Running MultiBisect(A, B)...")
 	diffs, err := b1.MultiBisect(b2, 1)
 	if err != nil {
 		t.Fatalf("MultiBisect failed: %v", err)
@@ -117,9 +116,9 @@ func TestMultiBisectUnequalLengths(t *testing.T) {
 	t.Logf("Bisect found difference at start=%d count=%d", start, count)
 
 	// 4. Verify Results
-	fmt.Printf("Found %d differing ranges:\n", len(diffs))
+	t.Logf("Found %d differing ranges:", len(diffs))
 	for _, d := range diffs {
-		fmt.Printf(" - Range [%d .. %d]\n", d.Start, d.Start+uint64(d.Count)-1)
+		t.Logf(" - Range [%d .. %d]", d.Start, d.Start+uint64(d.Count)-1)
 	}
 
 	// We expect the difference to cover blocks [1500, 1999].
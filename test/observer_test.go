@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// recordingObserver logs every event it receives.
+type recordingObserver struct {
+	events []string
+	chunks []merkletree.Hash32
+	merged map[int]int
+}
+
+func (o *recordingObserver) OnChunkCommitted(start uint64, count uint32, digest merkletree.Hash32) {
+	o.events = append(o.events, fmt.Sprintf("chunk %d+%d", start, count))
+	o.chunks = append(o.chunks, digest)
+}
+
+func (o *recordingObserver) OnPeakMerged(level int, node *merkletree.Node) {
+	o.events = append(o.events, fmt.Sprintf("merge L%d %d+%d", level, node.Metadata.Start, node.Metadata.Count))
+	o.merged[level]++
+}
+
+func (o *recordingObserver) OnFinalize(root merkletree.Hash32) {
+	o.events = append(o.events, fmt.Sprintf("finalize %x", root[:4]))
+}
+
+func (o *recordingObserver) OnRestore(state merkletree.State) {
+	o.events = append(o.events, fmt.Sprintf("restore %d", state.TotalBlocks))
+}
+
+func TestObserver(t *testing.T) {
+	obs := &recordingObserver{merged: map[int]int{}}
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, Observer: obs})
+	pushRange(t, b, 0, 45)
+
+	// A chunk is reported after the merges its arrival caused.
+	want := "[merge L1 0+20 chunk 10+10 chunk 20+10 merge L1 20+20 merge L2 0+40 chunk 30+10]"
+	if got := fmt.Sprint(obs.events[1:]); obs.events[0] != "chunk 0+10" || got != want {
+		t.Errorf("Events = %v", obs.events)
+	}
+
+	// Forks and query paths report nothing.
+	obs.events = nil
+	f := b.Fork()
+	pushRange(t, f, 45, 100)
+	f.Finalize()
+	b.TreeDiff(f)
+	b.RootAt(44)
+	if len(obs.events) != 0 {
+		t.Errorf("Fork or queries reported %v", obs.events)
+	}
+
+	root, _ := b.Finalize()
+	if want := []string{"chunk 40+5", fmt.Sprintf("finalize %x", root[:4])}; fmt.Sprint(obs.events) != fmt.Sprint(want) {
+		t.Errorf("Finalize events = %v, want %v", obs.events, want)
+	}
+	if len(obs.chunks) != 5 || obs.chunks[4] != merkletree.ComputeChunkDigest(nil, 40, mockHashes(40, 5)) {
+		t.Error("Committed chunk digests do not match ComputeChunkDigest")
+	}
+	if obs.merged[1] != 2 || obs.merged[2] != 1 {
+		t.Errorf("Merges per level = %v", obs.merged)
+	}
+
+	snap, _ := b.Snapshot()
+	obs.events = nil
+	if err := b.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	pushRange(t, b, 45, 15) // the restored accumulator still reports merges
+	if want := "[restore 45 merge L1 40+15 chunk 45+10]"; fmt.Sprint(obs.events) != want {
+		t.Errorf("Events after Restore = %v, want %s", obs.events, want)
+	}
+}
+
+// finalizeCounter only cares about roots.
+type finalizeCounter struct {
+	merkletree.NopObserver
+	roots int
+}
+
+func (c *finalizeCounter) OnFinalize(merkletree.Hash32) { c.roots++ }
+
+func TestNopObserverEmbedding(t *testing.T) {
+	c := &finalizeCounter{}
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, Observer: c})
+	pushRange(t, b, 0, 10)
+	b.Finalize()
+	b.RootNode()
+	if c.roots != 1 {
+		t.Errorf("OnFinalize called %d times, want 1", c.roots)
+	}
+}
+
+func mockHashes(start, count int) []merkletree.Hash32 {
+	hashes := make([]merkletree.Hash32, count)
+	for i := range hashes {
+		hashes[i] = mockHash(start + i)
+	}
+	return hashes
+}
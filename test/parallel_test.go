@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// mockSource serves mockHash(h) for every height and counts the blocks read.
+type mockSource struct {
+	reads atomic.Int64
+	fail  uint64 // height whose read fails, if non-zero
+}
+
+func (s *mockSource) BlockHashes(ctx context.Context, start uint64, out []merkletree.Hash32) error {
+	if s.fail != 0 && s.fail >= start && s.fail < start+uint64(len(out)) {
+		return errors.New("block store unavailable")
+	}
+	for i := range out {
+		out[i] = mockHash(int(start) + i)
+	}
+	s.reads.Add(int64(len(out)))
+	return nil
+}
+
+func TestBuildParallelMatchesSequential(t *testing.T) {
+	start := uint64(500)
+	for _, cfg := range []merkletree.Config{
+		{BlockMerge: 4},
+		{BlockMerge: 7, RetainElements: true, StartHeight: &start},
+		{BlockMerge: 16, Domain: []byte("chain-a")},
+	} {
+		for _, count := range []int{1, 3, 100, 5000, 20011} {
+			seq, _ := merkletree.NewBuilder(cfg)
+			pushRange(t, seq, start, count)
+			want, _ := seq.Snapshot()
+
+			for _, workers := range []int{0, 1, 3, 8} {
+				src := &mockSource{}
+				b, err := merkletree.BuildParallel(context.Background(), cfg, src, start, uint64(count), workers)
+				if err != nil {
+					t.Fatalf("bm %d, %d blocks, %d workers: %v", cfg.BlockMerge, count, workers, err)
+				}
+				if got, _ := b.Snapshot(); !bytes.Equal(got, want) {
+					t.Errorf("bm %d, %d blocks, %d workers: snapshot differs", cfg.BlockMerge, count, workers)
+				}
+				if src.reads.Load() != int64(count) {
+					t.Errorf("bm %d, %d blocks: read %d blocks", cfg.BlockMerge, count, src.reads.Load())
+				}
+				got, want := b.Stats().Hashing, seq.Stats().Hashing
+				if got.ElementDigests != want.ElementDigests || got.ChunkDigests != want.ChunkDigests || got.NodeDigests != want.NodeDigests {
+					t.Errorf("bm %d, %d blocks, %d workers: hashing %+v, want %+v", cfg.BlockMerge, count, workers, got, want)
+				}
+			}
+
+			// The result keeps building like the sequential one.
+			b, _ := merkletree.BuildParallel(context.Background(), cfg, &mockSource{}, start, uint64(count), 4)
+			pushRange(t, b, start+uint64(count), 10)
+			pushRange(t, seq, start+uint64(count), 10)
+			r1, _ := b.Finalize()
+			r2, _ := seq.Finalize()
+			if r1 != r2 {
+				t.Errorf("bm %d, %d blocks: root after extending differs", cfg.BlockMerge, count)
+			}
+		}
+	}
+}
+
+func TestBuildParallelErrors(t *testing.T) {
+	cfg := merkletree.Config{BlockMerge: 8}
+	if _, err := merkletree.BuildParallel(context.Background(), cfg, &mockSource{fail: 7000}, 0, 10000, 4); err == nil {
+		t.Error("a source error should fail the build")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := merkletree.BuildParallel(ctx, cfg, &mockSource{}, 0, 10000, 4); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled build: %v", err)
+	}
+
+	start := uint64(5)
+	if _, err := merkletree.BuildParallel(context.Background(), merkletree.Config{BlockMerge: 8, StartHeight: &start}, &mockSource{}, 0, 100, 4); err == nil {
+		t.Error("a start other than Config.StartHeight should fail")
+	}
+
+	b, err := merkletree.BuildParallel(context.Background(), cfg, &mockSource{}, 0, 0, 4)
+	if err != nil || b.State().TotalBlocks != 0 {
+		t.Errorf("empty build: %v", err)
+	}
+}
+
+func TestBuildParallelObserver(t *testing.T) {
+	obs := &recordingObserver{merged: map[int]int{}}
+	b, err := merkletree.BuildParallel(context.Background(), merkletree.Config{BlockMerge: 4, Observer: obs}, &mockSource{}, 0, 1000, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obs.chunks) != 0 {
+		t.Errorf("observer saw %d chunks during the build", len(obs.chunks))
+	}
+	pushRange(t, b, 1000, 4)
+	if len(obs.chunks) != 1 {
+		t.Errorf("observer saw %d chunks after the build, want 1", len(obs.chunks))
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestProveBlock(t *testing.T) {
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4, RetainElements: true})
+	pushRange(t, b, 0, 203) // 50 chunks and a partial chunk of 3
+
+	root, err := b.Fork().Finalize()
+	if err != nil {
+		t.Fatalf("Finalize failed: %v", err)
+	}
+	for _, h := range []uint64{0, 1, 99, 197, 199, 200, 202} {
+		p, err := b.ProveBlock(h)
+		if err != nil {
+			t.Fatalf("ProveBlock(%d) failed: %v", h, err)
+		}
+		if p.Root != root {
+			t.Errorf("ProveBlock(%d): root %s, want %s", h, p.Root, root)
+		}
+		if err := p.Verify(nil, root, mockHash(int(h))); err != nil {
+			t.Errorf("Verify(%d) failed: %v", h, err)
+		}
+		if err := p.Verify(nil, root, mockHash(int(h)+1)); !errors.Is(err, merkletree.ErrInvalidProof) {
+			t.Errorf("Verify(%d) with the wrong block hash: %v", h, err)
+		}
+	}
+	if b.State().TotalBlocks != 203 {
+		t.Errorf("ProveBlock modified the builder")
+	}
+
+	p, _ := b.ProveBlock(42)
+	tampered := *p
+	tampered.Path = append([]merkletree.ProofStep(nil), p.Path...)
+	tampered.Path[1].Root[0] ^= 1
+	if err := tampered.Verify(nil, root, mockHash(42)); !errors.Is(err, merkletree.ErrInvalidProof) {
+		t.Errorf("tampered path: %v", err)
+	}
+	tampered = *p
+	tampered.Height = 43
+	if err := tampered.Verify(nil, root, mockHash(42)); !errors.Is(err, merkletree.ErrInvalidProof) {
+		t.Errorf("wrong height: %v", err)
+	}
+	tampered = *p
+	tampered.ChunkStart++
+	if err := tampered.Verify(nil, root, mockHash(42)); !errors.Is(err, merkletree.ErrInvalidProof) {
+		t.Errorf("shifted chunk: %v", err)
+	}
+
+	if _, err := b.ProveBlock(203); err == nil {
+		t.Errorf("ProveBlock past the end succeeded")
+	}
+}
+
+func TestProveBlockNotRetained(t *testing.T) {
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4})
+	pushRange(t, b, 0, 10)
+
+	if _, err := b.ProveBlock(3); !errors.Is(err, merkletree.ErrElementsNotRetained) {
+		t.Errorf("committed chunk: %v", err)
+	}
+	// The partial chunk is always held in full.
+	p, err := b.ProveBlock(9)
+	if err != nil {
+		t.Fatalf("partial chunk: %v", err)
+	}
+	root, _ := b.Finalize()
+	if err := p.Verify(nil, root, mockHash(9)); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestReassemblerOutOfOrder(t *testing.T) {
+	seq, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 8})
+	pushRange(t, seq, 0, 500)
+	want, _ := seq.Finalize()
+
+	// Pages of varying size, shuffled, some fetched twice from different peers.
+	type page struct{ start, count int }
+	var pages []page
+	rng := rand.New(rand.NewSource(1))
+	for at := 0; at < 500; {
+		n := min(1+rng.Intn(30), 500-at)
+		pages = append(pages, page{at, n})
+		at += n
+	}
+	pages = append(pages, pages[3], pages[len(pages)/2], page{100, 50})
+	rng.Shuffle(len(pages), func(i, j int) { pages[i], pages[j] = pages[j], pages[i] })
+
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 8})
+	r, err := merkletree.NewReassembler(b, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pushed int
+	for _, p := range pages {
+		n, err := r.Add(uint64(p.start), mockHashes(p.start, p.count))
+		if err != nil {
+			t.Fatalf("Add(%d, %d) failed: %v", p.start, p.count, err)
+		}
+		pushed += n
+	}
+	s := r.Stats()
+	if pushed != 500 || r.Next() != 500 || s.Pushed != 500 || s.Buffered != 0 || s.Pages != 0 || s.Duplicates == 0 {
+		t.Errorf("pushed %d, next %d, stats %+v", pushed, r.Next(), s)
+	}
+	if got, _ := b.Finalize(); got != want {
+		t.Errorf("root %s, want %s", got, want)
+	}
+}
+
+func TestReassemblerBuffering(t *testing.T) {
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4})
+	r, _ := merkletree.NewReassembler(b, 0, 10)
+
+	if n, err := r.Add(20, mockHashes(20, 5)); n != 0 || err != nil {
+		t.Fatalf("Add(20): %d, %v", n, err)
+	}
+	if n, err := r.Add(10, mockHashes(10, 5)); n != 0 || err != nil {
+		t.Fatalf("Add(10): %d, %v", n, err)
+	}
+	if _, err := r.Add(30, mockHashes(30, 1)); !errors.Is(err, merkletree.ErrReassemblyFull) {
+		t.Errorf("Add beyond the bound: %v", err)
+	}
+	want := []merkletree.HeightRange{{Start: 0, End: 10}, {Start: 15, End: 20}}
+	if got := r.Missing(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Missing() = %v, want %v", got, want)
+	}
+
+	// A page continuing the builder is never refused, and drains what it reaches.
+	if n, err := r.Add(0, mockHashes(0, 15)); n != 15 || err != nil {
+		t.Fatalf("Add(0): %d, %v", n, err)
+	}
+	if n, err := r.Add(15, mockHashes(15, 5)); n != 10 || err != nil {
+		t.Fatalf("Add(15): %d, %v", n, err)
+	}
+	if r.Next() != 25 || len(r.Missing()) != 0 {
+		t.Errorf("next %d, missing %v", r.Next(), r.Missing())
+	}
+}
+
+func TestReassemblerConflicts(t *testing.T) {
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 4})
+	r, _ := merkletree.NewReassembler(b, 0, 0)
+	r.Add(0, mockHashes(0, 6)) // chunk [0, 4) committed, [4, 6) partial
+	r.Add(10, mockHashes(10, 4))
+
+	bad := mockHashes(8, 4)
+	bad[3][0] ^= 1 // height 11, buffered
+	if _, err := r.Add(8, bad); !errors.Is(err, merkletree.ErrPageConflict) {
+		t.Errorf("conflict with a buffered page: %v", err)
+	}
+	bad = mockHashes(4, 4)
+	bad[1][0] ^= 1 // height 5, in the partial chunk
+	if _, err := r.Add(4, bad); !errors.Is(err, merkletree.ErrPageConflict) {
+		t.Errorf("conflict with a pushed block: %v", err)
+	}
+	if s := r.Stats(); s.Duplicates != 0 || s.Buffered != 4 || r.Next() != 6 {
+		t.Errorf("rejected pages changed the reassembler: next %d, %+v", r.Next(), s)
+	}
+
+	// Heights of committed chunks cannot be checked without RetainElements.
+	if n, err := r.Add(2, mockHashes(2, 8)); n != 8 || err != nil {
+		t.Fatalf("Add(2): %d, %v", n, err)
+	}
+	if s := r.Stats(); s.Duplicates != 4 || s.Unchecked != 2 || r.Next() != 14 {
+		t.Errorf("next %d, %+v", r.Next(), s)
+	}
+
+	if _, err := merkletree.NewReassembler(b, 20, 0); err == nil {
+		t.Error("NewReassembler should fail when next does not continue the builder")
+	}
+}
+
+func TestReassemblerConcurrent(t *testing.T) {
+	seq, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 16})
+	pushRange(t, seq, 1000, 2000)
+	want, _ := seq.Finalize()
+
+	start := uint64(1000)
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 16, StartHeight: &start})
+	r, _ := merkletree.NewReassembler(b, start, 0)
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := w; p < 100; p += 4 {
+				if _, err := r.Add(1000+uint64(p)*20, mockHashes(1000+p*20, 20)); err != nil {
+					t.Errorf("Add page %d: %v", p, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := b.Finalize(); got != want {
+		t.Errorf("root %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestRenderFormats(t *testing.T) {
+	local, remote := buildMutated(t, merkletree.Config{BlockMerge: 10}, 165, []int{12})
+	diffs, _ := local.TreeDiff(remote)
+	opts := merkletree.RenderOptions{Highlight: diffs}
+
+	render := func(format merkletree.RenderFormat, opts merkletree.RenderOptions) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := local.Render(&buf, format, opts); err != nil {
+			t.Fatalf("Render(%s) failed: %v", format, err)
+		}
+		return buf.String()
+	}
+
+	text := render(merkletree.RenderText, merkletree.RenderOptions{})
+	if !strings.Contains(text, "Total Blocks Processed : 165") || !strings.Contains(text, "Level 4") {
+		t.Errorf("Unexpected text view:\n%s", text)
+	}
+	if strings.Contains(text, "differs") || !strings.Contains(render(merkletree.RenderText, opts), "differs") {
+		t.Error("Text view should mark differing peaks only when highlighting")
+	}
+
+	tree := render(merkletree.RenderTree, opts)
+	for _, want := range []string{"chunk [10 … 19]", "partial [160 … 164]", "✗ differs"} {
+		if !strings.Contains(tree, want) {
+			t.Errorf("Tree view lacks %q:\n%s", want, tree)
+		}
+	}
+	if got := strings.Count(tree, "chunk ["); got != 16 {
+		t.Errorf("Tree view shows %d chunks, want 16", got)
+	}
+	shallow := render(merkletree.RenderTree, merkletree.RenderOptions{MaxDepth: 1})
+	if strings.Contains(shallow, "chunk [") || !strings.Contains(shallow, "… 8 chunks") {
+		t.Errorf("Depth-limited tree view:\n%s", shallow)
+	}
+
+	var doc struct {
+		TotalBlocks uint64            `json:"total_blocks"`
+		Root        merkletree.Hash32 `json:"root"`
+		Peaks       []struct {
+			Start   uint64 `json:"start"`
+			Differs bool   `json:"differs"`
+		} `json:"peaks"`
+	}
+	if err := json.Unmarshal([]byte(render(merkletree.RenderJSON, opts)), &doc); err != nil {
+		t.Fatalf("JSON view does not parse: %v", err)
+	}
+	root, _ := local.Fork().Finalize()
+	if doc.TotalBlocks != 165 || doc.Root != root || len(doc.Peaks) != 1 || !doc.Peaks[0].Differs {
+		t.Errorf("Unexpected JSON view: %+v", doc)
+	}
+
+	dot := render(merkletree.RenderDOT, opts)
+	if !strings.HasPrefix(dot, "digraph merkle {") || strings.Count(dot, "fillcolor") != 5 {
+		t.Errorf("DOT view should highlight the 5 nodes from peak to leaf:\n%s", dot)
+	}
+	mermaid := render(merkletree.RenderMermaid, opts)
+	if !strings.HasPrefix(mermaid, "graph TD") || !strings.Contains(mermaid, "class n0,n1,n2,n3,n5 differs") {
+		t.Errorf("Unexpected Mermaid view:\n%s", mermaid)
+	}
+
+	// Rendering does not commit the partial chunk.
+	if local.State().InChunkCount != 5 {
+		t.Error("Render modified the builder")
+	}
+}
+
+func TestRenderGapLeaves(t *testing.T) {
+	// Chunks [0 … 3] and [4 … 7], a gap leaf [8 … 11] as the lowest peak, and a
+	// partial chunk at 12.
+	b := gapBuilder(t, []uint64{0, 1, 2, 3, 4, 5, 6, 7, 12}, 9)
+
+	for _, c := range []struct {
+		format merkletree.RenderFormat
+		want   string
+	}{
+		{merkletree.RenderText, "Level 0   (gap)"},
+		{merkletree.RenderTree, "gap [8 … 11]"},
+		{merkletree.RenderDOT, `label="gap [8 … 11]`},
+		{merkletree.RenderMermaid, `"gap [8 … 11]`},
+		{merkletree.RenderJSON, `"gap": true`},
+	} {
+		var buf bytes.Buffer
+		if err := b.Render(&buf, c.format, merkletree.RenderOptions{}); err != nil {
+			t.Fatalf("Render(%s) failed: %v", c.format, err)
+		}
+		if out := buf.String(); !strings.Contains(out, c.want) {
+			t.Errorf("%s view lacks %q:\n%s", c.format, c.want, out)
+		}
+	}
+
+	var tree bytes.Buffer
+	b.Render(&tree, merkletree.RenderTree, merkletree.RenderOptions{})
+	if got := strings.Count(tree.String(), "chunk ["); got != 2 {
+		t.Errorf("Tree view shows %d chunks, want 2:\n%s", got, tree.String())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func TestRenderReportsWriteErrors(t *testing.T) {
+	b, _ := buildMutated(t, merkletree.Config{BlockMerge: 10}, 100, nil)
+	for _, f := range []merkletree.RenderFormat{merkletree.RenderText, merkletree.RenderTree, merkletree.RenderDOT} {
+		if err := b.Render(failingWriter{}, f, merkletree.RenderOptions{}); !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("Render(%s) = %v, want the write error", f, err)
+		}
+	}
+	if err := b.Render(os.Stdout, merkletree.RenderFormat(99), merkletree.RenderOptions{}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
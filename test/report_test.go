@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestWriteDiffReport(t *testing.T) {
+	local, remote := buildMutated(t, merkletree.Config{BlockMerge: 10}, 165, []int{12, 163})
+	want, _ := local.TreeDiff(remote)
+
+	var buf bytes.Buffer
+	opts := merkletree.ReportOptions{Title: "node-a <vs> node-b", LocalName: "node-a", RemoteName: "node-b"}
+	if err := merkletree.WriteDiffReport(context.Background(), &buf, local, remote, opts); err != nil {
+		t.Fatalf("WriteDiffReport failed: %v", err)
+	}
+	page := buf.String()
+
+	for _, s := range []string{
+		"<!DOCTYPE html>",
+		"node-a &lt;vs&gt; node-b",
+		"2 differing range(s)",
+		"node-a root</th><th>node-b root",
+		"chunk [10 … 19]",
+		"partial [160 … 164]",
+		hex.EncodeToString(want[0].LocalRoot[:]),
+		hex.EncodeToString(want[0].RemoteRoot[:]),
+	} {
+		if !strings.Contains(page, s) {
+			t.Errorf("Report lacks %q", s)
+		}
+	}
+	// Self-contained: nothing is fetched.
+	for _, s := range []string{"<script", "<link", "src=", "url("} {
+		if strings.Contains(page, s) {
+			t.Errorf("Report references external content (%q)", s)
+		}
+	}
+	// Peak, three internal nodes and the chunk on each side, plus the partial chunks.
+	if got := strings.Count(page, "<details open>"); got != 8 {
+		t.Errorf("Report expands %d differing subtrees, want 8", got)
+	}
+
+	buf.Reset()
+	snapL, snapR := local.ToSnapshot(), local.Fork().ToSnapshot()
+	if err := merkletree.WriteSnapshotDiffReport(context.Background(), &buf, snapL, snapR, nil, merkletree.ReportOptions{MaxDepth: 2}); err != nil {
+		t.Fatalf("WriteSnapshotDiffReport failed: %v", err)
+	}
+	page = buf.String()
+	if !strings.Contains(page, "Identical") || strings.Contains(page, "<details open>") || !strings.Contains(page, "… 4 chunks") {
+		t.Errorf("Unexpected report for identical snapshots:\n%s", page)
+	}
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestRootAtMatchesHistory(t *testing.T) {
+	count := 257
+	start := uint64(1000)
+	cfg := merkletree.Config{BlockMerge: 8, StartHeight: &start, RetainElements: true}
+
+	hashes := make([]merkletree.Hash32, count)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+
+	// Record the root after every push using a throwaway fork.
+	b, _ := merkletree.NewBuilder(cfg)
+	history := make([]merkletree.Hash32, count+1)
+	for i := 0; i < count; i++ {
+		if _, err := b.Push(start+uint64(i), hashes[i:i+1]); err != nil {
+			t.Fatalf("Push(%d) failed: %v", i, err)
+		}
+		history[i+1], _ = b.Fork().Finalize()
+	}
+
+	for n := 0; n <= count; n++ {
+		got, err := b.RootAt(uint64(n))
+		if err != nil {
+			t.Fatalf("RootAt(%d) failed: %v", n, err)
+		}
+		if got != history[n] {
+			t.Fatalf("RootAt(%d) mismatch.\nGot:  %x\nWant: %x", n, got, history[n])
+		}
+	}
+
+	if _, err := b.RootAt(uint64(count + 1)); err == nil {
+		t.Error("Expected error for RootAt beyond total blocks")
+	}
+
+	// RootAt must not commit the partial chunk.
+	if st := b.State(); st.InChunkCount != count%8 {
+		t.Errorf("RootAt modified partial chunk: %+v", st)
+	}
+}
+
+func TestRootAtWithoutRetainedElements(t *testing.T) {
+	cfg := merkletree.Config{BlockMerge: 10}
+
+	hashes := make([]merkletree.Hash32, 55)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+	b, _ := merkletree.NewBuilder(cfg)
+	b.Push(0, hashes)
+
+	ref, _ := merkletree.NewBuilder(cfg)
+	ref.Push(0, hashes[:30])
+	want, _ := ref.Finalize()
+
+	// Chunk boundaries and the live partial buffer work without retention.
+	got, err := b.RootAt(30)
+	if err != nil || got != want {
+		t.Errorf("RootAt(30) = %x, %v; want %x", got, err, want)
+	}
+	if _, err := b.RootAt(52); err != nil {
+		t.Errorf("RootAt inside partial buffer failed: %v", err)
+	}
+
+	// Inside a committed chunk the elements are required.
+	if _, err := b.RootAt(35); !errors.Is(err, merkletree.ErrElementsNotRetained) {
+		t.Errorf("Expected ErrElementsNotRetained, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestDiffSnapshotMatchesRestoredBuilder(t *testing.T) {
+	cfg := merkletree.Config{BlockMerge: 10}
+	local, remote := buildMutated(t, cfg, 3005, []int{7, 1500, 2999})
+	// Give the remote a longer tail, ending in a partial chunk.
+	extra := make([]merkletree.Hash32, 33)
+	remote.Push(3005, extra)
+
+	restored, err := remote.ToSnapshot().FromSnapshot(nil)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %v", err)
+	}
+	want, err := local.TreeDiff(restored)
+	if err != nil {
+		t.Fatalf("TreeDiff failed: %v", err)
+	}
+	if len(want) == 0 {
+		t.Fatal("Expected differences")
+	}
+
+	got, err := merkletree.DiffSnapshot(local, remote.ToSnapshot())
+	if err != nil {
+		t.Fatalf("DiffSnapshot failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffSnapshot = %v, want %v", got, want)
+	}
+
+	data, err := remote.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	reader, err := merkletree.NewSnapshotReader(data, nil)
+	if err != nil {
+		t.Fatalf("NewSnapshotReader failed: %v", err)
+	}
+	got, err = merkletree.DiffSnapshotReader(local, reader)
+	if err != nil {
+		t.Fatalf("DiffSnapshotReader failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffSnapshotReader = %v, want %v", got, want)
+	}
+
+	// Peak traversal with workers agrees with MultiBisect on the restored builder.
+	multi, _ := local.MultiBisect(restored, 4)
+	res, err := merkletree.Differ{Traversal: merkletree.TraversePeaks, Concurrency: 4, Merge: true}.DiffReader(context.Background(), local, reader)
+	if err != nil {
+		t.Fatalf("DiffReader failed: %v", err)
+	}
+	if !reflect.DeepEqual(res.Ranges, multi) {
+		t.Errorf("DiffReader (peaks) = %v, want %v", res.Ranges, multi)
+	}
+
+	root, err := reader.Root()
+	if err != nil {
+		t.Fatalf("Root failed: %v", err)
+	}
+	if wantRoot, _ := remote.Fork().Finalize(); root != wantRoot {
+		t.Errorf("Reader root %x, want %x", root, wantRoot)
+	}
+	if reader.TotalBlocks() != 3038 || reader.BlockMerge() != 10 {
+		t.Errorf("Reader header: total=%d blockMerge=%d", reader.TotalBlocks(), reader.BlockMerge())
+	}
+}
+
+func TestSnapshotReaderSkipsMatchingSubtrees(t *testing.T) {
+	local, remote := buildMutated(t, merkletree.Config{BlockMerge: 10}, 10240, []int{5000})
+	data, _ := remote.Snapshot()
+	reader, err := merkletree.NewSnapshotReader(data, nil)
+	if err != nil {
+		t.Fatalf("NewSnapshotReader failed: %v", err)
+	}
+
+	res, err := merkletree.Differ{}.DiffReader(context.Background(), local, reader)
+	if err != nil {
+		t.Fatalf("DiffReader failed: %v", err)
+	}
+	if len(res.Ranges) != 1 || res.Ranges[0].Start != 5000 {
+		t.Fatalf("Expected one range at 5000, got %v", res.Ranges)
+	}
+	// One path down a 1024-chunk peak: about 2 nodes per level on each side.
+	if res.NodesVisited > 100 || res.BytesRead > uint64(len(data))/20 {
+		t.Errorf("Diff read too much: %d nodes, %d of %d bytes", res.NodesVisited, res.BytesRead, len(data))
+	}
+}
+
+func TestSnapshotReaderRejectsMalformedInput(t *testing.T) {
+	local, remote := buildMutated(t, merkletree.Config{BlockMerge: 10}, 10240, []int{5000})
+	data, _ := remote.Snapshot()
+
+	for name, bad := range map[string][]byte{
+		"truncated": data[:len(data)-1],
+		"trailing":  append(append([]byte{}, data...), 0),
+		"empty":     nil,
+	} {
+		if _, err := merkletree.NewSnapshotReader(bad, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// 1024 chunks form a single level-10 peak, preceded by ten nil peak tags and a
+	// 38-byte header. Corrupt the start of its left child, which the diff must read.
+	corrupt := append([]byte{}, data...)
+	leftStart := 38 + 10 + 45 + 1
+	corrupt[leftStart] ^= 0xFF
+	reader, err := merkletree.NewSnapshotReader(corrupt, nil)
+	if err != nil {
+		t.Fatalf("NewSnapshotReader failed: %v", err)
+	}
+	if _, err := merkletree.DiffSnapshotReader(local, reader); !errors.Is(err, merkletree.ErrMalformedSnapshot) {
+		t.Errorf("Expected ErrMalformedSnapshot, got %v", err)
+	}
+}
@@ -2,7 +2,6 @@ package tests
 
 import (
 	"crypto/rand"
-	"fmt"
 	"math/big"
 	"testing"
 
@@ -21,7 +20,7 @@ func TestSnapshotFileAndBisect(t *testing.T) {
 	cfg := merkletree.Config{BlockMerge: 100}
 
 	// ---- 1. Build Tree A (Original) ----
-	fmt.Println("Building Tree A (Original)...")
+	t.Log("Building Tree A (Original)...")
 	hashes := make([]merkletree.Hash32, count)
 	for i := 0; i < count; i++ {
 		rand.Read(hashes[i][:])
@@ -31,7 +30,7 @@ func TestSnapshotFileAndBisect(t *testing.T) {
 	b1.Push(0, hashes)
 
 	// ---- 2. Save to JSON File ----
-	fmt.Println("Saving Tree A to 'tree_snapshot.json'...")
+	t.Log("Saving Tree A to 'tree_snapshot.json'...")
 	snap := b1.ToSnapshot()
 	err := snap.SavetoJson("tree_snapshot.json")
 	if err != nil {
@@ -39,7 +38,7 @@ func TestSnapshotFileAndBisect(t *testing.T) {
 	}
 
 	// ---- 3. Build Tree B (Mutated) ----
-	fmt.Println("Building Tree B (Mutated)...")
+	t.Log("Building Tree B (Mutated)...")
 	hashes2 := make([]merkletree.Hash32, len(hashes))
 	copy(hashes2, hashes)
 
@@ -47,13 +46,13 @@ func TestSnapshotFileAndBisect(t *testing.T) {
 	mutateIdx, _ := rand.Int(rand.Reader, big.NewInt(int64(count)))
 	idx := int(mutateIdx.Int64())
 	hashes2[idx][0] ^= 0xFF
-	fmt.Printf(">> Mutating Block #%d\n", idx)
+	t.Logf(">> Mutating Block #%d", idx)
 
 	b2, _ := merkletree.NewBuilder(cfg)
 	b2.Push(0, hashes2)
 
 	// ---- 4. Load Tree A from JSON ----
-	fmt.Println("Loading Tree A from JSON...")
+	t.Log("Loading Tree A from JSON...")
 	loadedSnap, err := merkletree.LoadSnapshotfromJson("tree_snapshot.json")
 	if err != nil {
 		t.Fatalf("LoadSnapshotfromJson failed: %v", err)
@@ -65,7 +64,7 @@ func TestSnapshotFileAndBisect(t *testing.T) {
 	}
 
 	// ---- 5. Bisect ----
-	fmt.Println("Running Bisect(RestoredA, MutatedB)...")
+	t.Log("Running Bisect(RestoredA, MutatedB)...")
 
 	// Verify roots first (should differ)
 	r1, _ := b1Restored.Finalize()
@@ -79,10 +78,10 @@ func TestSnapshotFileAndBisect(t *testing.T) {
 		t.Fatalf("Bisect failed: %v", err)
 	}
 
-	fmt.Printf(">> Difference found at range [%d .. %d]\n", start, start+uint64(bCount)-1)
+	t.Logf(">> Difference found at range [%d .. %d]", start, start+uint64(bCount)-1)
 
 	if uint64(idx) >= start && uint64(idx) < start+uint64(bCount) {
-		fmt.Println("SUCCESS: Mutated index is within identified range.")
+		t.Log("SUCCESS: Mutated index is within identified range.")
 	} else {
 		t.Fatalf("FAILURE: Mutated index %d NOT in range [%d .. %d]", idx, start, start+uint64(bCount)-1)
 	}
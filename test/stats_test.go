@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestStats(t *testing.T) {
+	start := uint64(7)
+	for _, cfg := range []merkletree.Config{
+		{BlockMerge: 10},
+		{BlockMerge: 10, StartHeight: &start, ExpectedTotal: 123456},
+		{BlockMerge: 3, RetainElements: true},
+		{BlockMerge: 10, Domain: []byte("mainnet")},
+	} {
+		b, _ := merkletree.NewBuilder(cfg)
+		pushRange(t, b, start, 1005)
+
+		s := b.Stats()
+		// 100 chunks = peaks of 64, 32 and 4 chunks with blockMerge 10.
+		wantChunks := uint64(1005 / cfg.BlockMerge)
+		if s.TotalBlocks != 1005 || s.CommittedChunks != wantChunks || s.PartialChunkFill != 1005%cfg.BlockMerge {
+			t.Errorf("%+v: totals %+v", cfg, s)
+		}
+		var covered uint64
+		for i, p := range s.Peaks {
+			if p.Start != start+covered || uint64(p.Count) != uint64(cfg.BlockMerge)<<p.Level {
+				t.Errorf("%+v: peak %d = %+v", cfg, i, p)
+			}
+			covered += uint64(p.Count)
+		}
+		if covered != wantChunks*uint64(cfg.BlockMerge) {
+			t.Errorf("%+v: peaks cover %d blocks", cfg, covered)
+		}
+		if s.Nodes != 2*wantChunks-uint64(len(s.Peaks)) {
+			t.Errorf("%+v: %d nodes for %d chunks in %d peaks", cfg, s.Nodes, wantChunks, len(s.Peaks))
+		}
+		if cfg.RetainElements && s.RetainedElements != wantChunks*uint64(cfg.BlockMerge) {
+			t.Errorf("%+v: %d retained elements", cfg, s.RetainedElements)
+		}
+		if s.MemoryBytes < s.Nodes*64 {
+			t.Errorf("%+v: memory estimate %d is too low for %d nodes", cfg, s.MemoryBytes, s.Nodes)
+		}
+
+		if snap, _ := b.Snapshot(); s.BinarySnapshotBytes != uint64(len(snap)) {
+			t.Errorf("%+v: binary snapshot size %d, want %d", cfg, s.BinarySnapshotBytes, len(snap))
+		}
+		if js, _ := json.Marshal(b.ToSnapshot()); s.JSONSnapshotBytes != uint64(len(js)) {
+			t.Errorf("%+v: JSON snapshot size %d, want %d", cfg, s.JSONSnapshotBytes, len(js))
+		}
+
+		h := s.Hashing
+		if h.ElementDigests != 1005 || h.ChunkDigests != wantChunks || h.NodeDigests != s.Nodes-wantChunks {
+			t.Errorf("%+v: hashing %+v", cfg, h)
+		}
+		if h.BytesHashed != 1005*41+wantChunks*45+h.NodeDigests*77 || h.PushTime <= 0 || h.BlocksPerSecond() <= 0 {
+			t.Errorf("%+v: hashing %+v", cfg, h)
+		}
+	}
+}
+
+func TestStatsEmptyAndForked(t *testing.T) {
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10})
+	s := b.Stats()
+	snap, _ := b.Snapshot()
+	js, _ := json.Marshal(b.ToSnapshot())
+	if s.Nodes != 0 || len(s.Peaks) != 0 || s.Hashing.BlocksPerSecond() != 0 ||
+		s.BinarySnapshotBytes != uint64(len(snap)) || s.JSONSnapshotBytes != uint64(len(js)) {
+		t.Errorf("Empty builder stats: %+v", s)
+	}
+
+	pushRange(t, b, 0, 55)
+	f := b.Fork()
+	if f.Stats().Hashing != (merkletree.HashStats{}) {
+		t.Error("A fork should start with zero hashing counters")
+	}
+	f.Finalize() // the sixth chunk merges with the fifth
+	if got := f.Stats().Hashing; got.ChunkDigests != 1 || got.NodeDigests != 1 {
+		t.Errorf("Committing the partial chunk: %+v", got)
+	}
+}
+
+// pushRange pushes count mock block hashes starting at height start.
+func pushRange(t *testing.T, b *merkletree.Builder, start uint64, count int) {
+	t.Helper()
+	if _, err := b.Push(start, mockHashes(int(start), count)); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func buildMutated(t *testing.T, cfg merkletree.Config, count int, mutate []int) (*merkletree.Builder, *merkletree.Builder) {
+	t.Helper()
+	hashes := make([]merkletree.Hash32, count)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+	mutated := make([]merkletree.Hash32, count)
+	copy(mutated, hashes)
+	for _, idx := range mutate {
+		mutated[idx][0] ^= 0xFF
+	}
+	b1, _ := merkletree.NewBuilder(cfg)
+	b1.Push(0, hashes)
+	b2, _ := merkletree.NewBuilder(cfg)
+	b2.Push(0, mutated)
+	return b1, b2
+}
+
+func TestDiffSeqMatchesTreeDiff(t *testing.T) {
+	b1, b2 := buildMutated(t, merkletree.Config{BlockMerge: 10}, 3005, []int{3, 105, 1500, 1501, 2999, 3004})
+
+	var streamed []merkletree.DiffRange
+	for d, err := range b1.DiffSeq(b2) {
+		if err != nil {
+			t.Fatalf("DiffSeq error: %v", err)
+		}
+		if n := len(streamed); n > 0 && d.Start < streamed[n-1].Start {
+			t.Errorf("Out of order: %d after %d", d.Start, streamed[n-1].Start)
+		}
+		streamed = append(streamed, d)
+	}
+
+	// DiffSeq must leave the partial chunks alone.
+	if st := b1.State(); st.InChunkCount != 5 {
+		t.Errorf("DiffSeq committed the partial chunk: %+v", st)
+	}
+
+	all, err := b1.TreeDiff(b2)
+	if err != nil {
+		t.Fatalf("TreeDiff failed: %v", err)
+	}
+	if len(all) != len(streamed) {
+		t.Fatalf("DiffSeq found %d ranges, TreeDiff %d", len(streamed), len(all))
+	}
+	for i := range all {
+		if all[i] != streamed[i] {
+			t.Errorf("Range %d differs: %+v vs %+v", i, streamed[i], all[i])
+		}
+	}
+
+	// Early termination.
+	n := 0
+	for range b1.DiffSeq(b2) {
+		n++
+		if n == 2 {
+			break
+		}
+	}
+	if n != 2 {
+		t.Errorf("Expected to stop after 2 ranges, got %d", n)
+	}
+}
+
+func TestMultiBisectStream(t *testing.T) {
+	b1, b2 := buildMutated(t, merkletree.Config{BlockMerge: 10}, 5000, []int{0, 105, 500, 1500, 1990, 4321})
+
+	want, err := b1.MultiBisect(b2, 4)
+	if err != nil {
+		t.Fatalf("MultiBisect failed: %v", err)
+	}
+
+	ranges, errc := b1.MultiBisectStream(context.Background(), b2, 4)
+	var got []merkletree.DiffRange
+	for d := range ranges {
+		if n := len(got); n > 0 && d.Start < got[n-1].Start {
+			t.Errorf("Out of order: %d after %d", d.Start, got[n-1].Start)
+		}
+		got = append(got, d)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Stream error: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Stream found %d ranges, MultiBisect %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Range %d differs: %+v vs %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMultiBisectWithContextCancelled(t *testing.T) {
+	b1, b2 := buildMutated(t, merkletree.Config{BlockMerge: 10}, 2000, []int{5, 1500})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := b1.MultiBisectWithContext(ctx, b2, 2); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	diffs, err := b1.MultiBisectWithContext(context.Background(), b2, 2)
+	if err != nil || len(diffs) != 2 {
+		t.Errorf("Expected 2 ranges, got %v (err %v)", diffs, err)
+	}
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestThreeWayDiff(t *testing.T) {
+	cfg := merkletree.Config{BlockMerge: 10}
+
+	// Common history up to the last agreed checkpoint.
+	hashes := make([]merkletree.Hash32, 1200)
+	for i := range hashes {
+		rand.Read(hashes[i][:])
+	}
+	base, _ := merkletree.NewBuilder(cfg)
+	base.Push(0, hashes[:1000])
+
+	// Restore the base from a snapshot, as after a partition.
+	snap := base.ToSnapshot()
+	restoredBase, err := snap.FromSnapshot(nil)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %v", err)
+	}
+
+	local := make([]merkletree.Hash32, len(hashes))
+	copy(local, hashes)
+	local[100][0] ^= 0x01 // local-only rewrite
+	local[500][0] ^= 0x01 // conflicting rewrite
+	local[700][0] ^= 0x07 // identical rewrite on both sides
+
+	remote := make([]merkletree.Hash32, len(hashes))
+	copy(remote, hashes)
+	remote[300][0] ^= 0x01 // remote-only rewrite
+	remote[500][0] ^= 0x02
+	remote[700][0] ^= 0x07
+
+	bl, _ := merkletree.NewBuilder(cfg)
+	bl.Push(0, local)
+	br, _ := merkletree.NewBuilder(cfg)
+	br.Push(0, remote[:1100])
+
+	ranges, err := merkletree.ThreeWayDiff(restoredBase, bl, br)
+	if err != nil {
+		t.Fatalf("ThreeWayDiff failed: %v", err)
+	}
+
+	want := map[uint64]merkletree.ThreeWayKind{
+		100: merkletree.ChangedLocal,
+		300: merkletree.ChangedRemote,
+		500: merkletree.Conflict,
+		700: merkletree.ChangedBoth,
+	}
+	var extended, localTail uint64
+	for _, r := range ranges {
+		t.Logf("[%d..%d] %v", r.Start, r.Start+uint64(r.Count)-1, r.Kind)
+		if r.Start >= 1000 {
+			// Both sides appended the same blocks up to 1100; only local goes further.
+			if r.Start < 1100 && r.Kind == merkletree.ChangedBoth {
+				extended += uint64(r.Count)
+			}
+			if r.Start >= 1100 && r.Kind == merkletree.ChangedLocal {
+				localTail += uint64(r.Count)
+			}
+			continue
+		}
+		k, ok := want[r.Start]
+		if !ok {
+			t.Errorf("Unexpected range [%d..%d] %v", r.Start, r.Start+uint64(r.Count)-1, r.Kind)
+			continue
+		}
+		if r.Kind != k {
+			t.Errorf("Range %d: got %v want %v", r.Start, r.Kind, k)
+		}
+		delete(want, r.Start)
+	}
+	if len(want) != 0 {
+		t.Errorf("Missing ranges: %v", want)
+	}
+	if extended != 100 || localTail != 100 {
+		t.Errorf("Appended ranges: both=%d local=%d, want 100/100", extended, localTail)
+	}
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+// logRecords decodes the records written by a slog JSON handler.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var rec map[string]any
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("Bad log record: %v", err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func countMessages(records []map[string]any) map[string]int {
+	n := map[string]int{}
+	for _, r := range records {
+		n[r["msg"].(string)]++
+	}
+	return n
+}
+
+func TestBuilderLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	start := uint64(0)
+	b, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, StartHeight: &start, Logger: logger})
+	pushRange(t, b, 0, 25)
+	b.Push(99, mockHashes(0, 1)) // rejected
+	snap, _ := b.Snapshot()
+	b.Restore(snap)
+
+	records := logRecords(t, &buf)
+	if got := countMessages(records); got["push batch"] != 2 || got["chunk committed"] != 2 || got["snapshot"] != 1 || got["restore"] != 1 {
+		t.Fatalf("Unexpected records: %v", got)
+	}
+	push := records[2]
+	if push["msg"] != "push batch" || push["start"] != 0.0 || push["count"] != 25.0 || push["accepted"] != 25.0 {
+		t.Errorf("Push record = %v", push)
+	}
+	if rejected := records[3]; rejected["error"] == nil {
+		t.Errorf("Rejected push record = %v", rejected)
+	}
+	digest := merkletree.ComputeChunkDigest(nil, 10, mockHashes(10, 10))
+	if commit := records[1]; commit["start"] != 10.0 || commit["digest"] != hex.EncodeToString(digest[:]) {
+		t.Errorf("Chunk record = %v", commit)
+	}
+
+	// Nothing is logged above the configured level.
+	buf.Reset()
+	quiet, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, Logger: slog.New(slog.NewJSONHandler(&buf, nil))})
+	pushRange(t, quiet, 0, 25)
+	if buf.Len() != 0 {
+		t.Errorf("Info-level logger received %q", buf.String())
+	}
+}
+
+func TestDiffLogging(t *testing.T) {
+	local, remote := buildMutated(t, merkletree.Config{BlockMerge: 10}, 165, []int{12, 163})
+
+	var buf bytes.Buffer
+	opts := merkletree.DiffOptions{Logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+	res, err := local.TreeBisectWithOptions(remote, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := logRecords(t, &buf)
+	got := countMessages(records)
+	// Root (L4 peak + partial) → L4 → L3 → L2 → L1 → chunk, on both sides.
+	if got["diff descend"] != 10 || got["diff range"] != 1 || got["diff done"] != 1 {
+		t.Errorf("Unexpected records: %v", got)
+	}
+	last := records[len(records)-1]
+	if last["msg"] != "diff done" || last["ranges"] != 1.0 || last["nodes_visited"] != float64(res.NodesVisited) {
+		t.Errorf("Summary record = %v", last)
+	}
+	for _, r := range records {
+		if r["msg"] == "diff range" && (r["start"] != 10.0 || r["kind"] != "mismatch") {
+			t.Errorf("Range record = %v", r)
+		}
+	}
+}
+
+// recordingTracer keeps every span it starts.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]slog.Value
+	err   error
+	ended bool
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, merkletree.Span) {
+	s := &recordedSpan{name: name, attrs: map[string]slog.Value{}}
+	s.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return ctx, s
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...slog.Attr) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+func TestTracer(t *testing.T) {
+	tr := &recordingTracer{}
+	local, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10, Tracer: tr})
+	pushRange(t, local, 0, 100)
+	remote, _ := merkletree.NewBuilder(merkletree.Config{BlockMerge: 10})
+	remote.Push(0, mockHashes(1, 100))
+
+	// The local builder's tracer is the default for diffs, in every form.
+	local.TreeDiff(remote)
+	d := merkletree.Differ{Concurrency: 4}
+	d.Diff(context.Background(), local, remote)
+	for range d.Seq(local, remote) {
+		break
+	}
+	for range (merkletree.Differ{}).Seq(local, remote) {
+	}
+	if err := local.Restore([]byte{0xFF}); err == nil {
+		t.Fatal("Expected Restore to fail")
+	}
+
+	var names []string
+	for _, s := range tr.spans {
+		names = append(names, s.name)
+		if !s.ended {
+			t.Errorf("Span %s was not ended", s.name)
+		}
+	}
+	want := []string{"merkletree.Push", "merkletree.Diff", "merkletree.Diff", "merkletree.Diff", "merkletree.Diff", "merkletree.Restore"}
+	if len(names) != len(want) {
+		t.Fatalf("Spans = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("Spans = %v, want %v", names, want)
+		}
+	}
+	if n := tr.spans[0].attrs["accepted"].Int64(); n != 100 {
+		t.Errorf("Push span accepted = %d", n)
+	}
+	if tr.spans[1].attrs["ranges"].Int64() != 10 || tr.spans[2].attrs["concurrency"].Int64() != 4 {
+		t.Errorf("Diff span attributes: %v, %v", tr.spans[1].attrs, tr.spans[2].attrs)
+	}
+	// A parallel Seq may have produced a few ranges ahead of the consumer.
+	if n := tr.spans[3].attrs["ranges"].Int64(); n < 1 || n > 10 || tr.spans[4].attrs["ranges"].Int64() != 10 {
+		t.Errorf("Seq span attributes: %v, %v", tr.spans[3].attrs, tr.spans[4].attrs)
+	}
+	if err := tr.spans[5].err; err == nil || errors.Is(err, context.Canceled) {
+		t.Errorf("Restore span error = %v", err)
+	}
+}
+
+func TestDisabledLoggingAllocations(t *testing.T) {
+	// Without a tracer or an enabled debug logger, Push allocates only for the
+	// digests of each block: a batch of two blocks costs twice a batch of one.
+	quiet := slog.New(slog.NewTextHandler(&bytes.Buffer{}, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	for _, cfg := range []merkletree.Config{
+		{BlockMerge: 1 << 20},
+		{BlockMerge: 1 << 20, Logger: quiet, Metrics: merkletree.NewMetrics()},
+	} {
+		allocs := func(batch int) float64 {
+			b, _ := merkletree.NewBuilder(cfg)
+			h := mockHashes(0, batch)
+			var height uint64
+			return testing.AllocsPerRun(200, func() {
+				b.Push(height, h)
+				height += uint64(batch)
+			})
+		}
+		if one, two := allocs(1), allocs(2); two != 2*one {
+			t.Errorf("logger %v: %v allocations for one block, %v for two", cfg.Logger != nil, one, two)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/JupiterMetaLabs/JMDN_Merkletree/merkletree"
+)
+
+func TestVerify(t *testing.T) {
+	cfg := merkletree.Config{BlockMerge: 10, RetainElements: true}
+	b, _ := buildMutated(t, cfg, 1234, nil)
+	if err := b.Verify(); err != nil {
+		t.Fatalf("Verify of a fresh builder: %v", err)
+	}
+
+	restored, err := b.ToSnapshot().FromSnapshot(nil)
+	if err != nil {
+		t.Fatalf("FromSnapshot failed: %v", err)
+	}
+	if err := restored.Verify(); err != nil {
+		t.Fatalf("Verify of a restored builder: %v", err)
+	}
+
+	// A retained element that no longer matches its chunk digest.
+	s := b.ToSnapshot()
+	s.Peaks[6].Right.Left.Left.Left.Left.Left.Elems[3][0] ^= 0xFF
+	tampered, _ := s.FromSnapshot(nil)
+	if err := tampered.Verify(); !errors.Is(err, merkletree.ErrMalformedSnapshot) {
+		t.Errorf("Expected ErrMalformedSnapshot for a tampered element, got %v", err)
+	}
+
+	// A block total that does not add up.
+	s = b.ToSnapshot()
+	s.TotalBlocks++
+	tampered, _ = s.FromSnapshot(nil)
+	if err := tampered.Verify(); !errors.Is(err, merkletree.ErrMalformedSnapshot) {
+		t.Errorf("Expected ErrMalformedSnapshot for a wrong total, got %v", err)
+	}
+}